@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"scheduler/middleware"
+	"scheduler/users"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 200
+)
+
+// any of these lets users read their own user, including through /me
+var selfViewPermissions = []users.Permission{
+	users.ViewUsersPermission,
+	users.ViewShiftsPermission,
+	users.CreateBookingsPermission,
+}
+
+// any of these lets users see bookings: their own as a recruit or volunteer, or everyone's
+var bookingsViewPermissions = []users.Permission{
+	users.CreateBookingsPermission,
+	users.SignupShiftsPermission,
+	users.ViewAllBookingsPermission,
+}
+
+// registers the v1 JSON routes on the router. errors are rendered as utils.ErrorBody,
+// so utils.JSONErrors must already be in the router's middleware chain
+func RegisterV1(v1 fiber.Router, cfg *middleware.AppConfig) {
+	v1.Get("/me", middleware.NewAnyPermissionValidator(selfViewPermissions...), func(c *fiber.Ctx) error {
+		return c.JSON(middleware.CurrentUser(c))
+	})
+
+	v1.Get("/users", middleware.NewPermissionValidator(users.ViewUsersPermission), listUsers(cfg))
+	v1.Post("/users", middleware.NewPermissionValidator(users.InviteUsersPermission), createUser(cfg))
+	v1.Get("/users/:id", middleware.NewAnyPermissionValidator(selfViewPermissions...), getUser(cfg))
+	v1.Patch("/users/:id", middleware.NewPermissionValidator(users.ManageUsersPermission), updateUser(cfg))
+
+	v1.Get("/shifts", middleware.NewAnyPermissionValidator(users.ViewShiftsPermission, users.CreateBookingsPermission), listShifts(cfg))
+	v1.Post("/shifts", middleware.NewPermissionValidator(users.ManageShiftsPermission), createShift(cfg))
+	v1.Get("/shifts/:id", middleware.NewAnyPermissionValidator(users.ViewShiftsPermission, users.CreateBookingsPermission), getShift(cfg))
+	v1.Patch("/shifts/:id", middleware.NewPermissionValidator(users.ManageShiftsPermission), updateShift(cfg))
+	v1.Get("/shifts/:id/slots", middleware.NewAnyPermissionValidator(users.ViewShiftsPermission, users.CreateBookingsPermission), listSlots(cfg))
+	v1.Get("/shifts/:id/intake-form", middleware.NewAnyPermissionValidator(users.ViewShiftsPermission, users.CreateBookingsPermission), getShiftIntakeForm(cfg))
+	v1.Post("/shifts/:id/volunteers", middleware.NewAnyPermissionValidator(users.SignupShiftsPermission, users.ManageShiftsPermission), addShiftVolunteer(cfg))
+	v1.Delete("/shifts/:id/volunteers/:user_id", middleware.NewAnyPermissionValidator(users.SignupShiftsPermission, users.ManageShiftsPermission), removeShiftVolunteer(cfg))
+
+	v1.Get("/bookings", middleware.NewAnyPermissionValidator(bookingsViewPermissions...), listBookings(cfg))
+	v1.Post("/bookings", middleware.NewAnyPermissionValidator(users.CreateBookingsPermission, users.ManageBookingsPermission), createBooking(cfg))
+	v1.Get("/bookings/:id", middleware.NewAnyPermissionValidator(bookingsViewPermissions...), getBooking(cfg))
+	v1.Patch("/bookings/:id", middleware.NewAnyPermissionValidator(users.CreateBookingsPermission, users.SignupShiftsPermission, users.ManageBookingsPermission), updateBooking(cfg))
+	v1.Post("/bookings/:id/outcome", middleware.NewAnyPermissionValidator(users.SignupShiftsPermission, users.ManageBookingsPermission), logBookingOutcome(cfg))
+
+	// keep unknown API routes from falling through to the HTML routes
+	v1.Use(func(c *fiber.Ctx) error {
+		return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("no route for %s %s", c.Method(), c.Path()))
+	})
+}
+
+// wraps a page of results
+type ListResponse struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// parses the page and per_page query params
+func paginationFromQuery(c *fiber.Ctx) (Pagination, error) {
+	p := Pagination{
+		Page:    1,
+		PerPage: defaultPerPage,
+	}
+	if page := c.Query("page"); len(page) > 0 {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid page %q", page)
+		}
+		p.Page = n
+	}
+	if perPage := c.Query("per_page"); len(perPage) > 0 {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > maxPerPage {
+			return p, fmt.Errorf("invalid per_page %q: must be between 1 and %d", perPage, maxPerPage)
+		}
+		p.PerPage = n
+	}
+	return p, nil
+}
+
+func (p Pagination) limit() int {
+	return p.PerPage
+}
+
+func (p Pagination) offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+func (p Pagination) respond(c *fiber.Ctx, data interface{}, total int) error {
+	p.Total = total
+	p.TotalPages = int(math.Ceil(float64(total) / float64(p.PerPage)))
+	return c.JSON(ListResponse{
+		Data:       data,
+		Pagination: p,
+	})
+}
+
+// parses a positive integer route param
+func paramID(c *fiber.Ctx, key string) (int, error) {
+	id, err := c.ParamsInt(key)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s %q", key, c.Params(key))
+	}
+	return id, nil
+}
+
+// parses an optional integer query param
+func queryInt(c *fiber.Ctx, key string) (int, error) {
+	value := c.Query(key)
+	if len(value) < 1 {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+	return n, nil
+}
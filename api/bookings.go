@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"scheduler/bookings"
+	"scheduler/intake"
+	"scheduler/middleware"
+	"scheduler/users"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type createBookingRequest struct {
+	ShiftID  int       `json:"shift_id"`
+	StartsAt time.Time `json:"starts_at"`
+	// defaults to the current user. booking for anyone else requires bookings.manage
+	RecruitID int `json:"recruit_id"`
+	// skills the volunteer needs, for shifts assigning calls by skill match. defaults to the recruit's skills
+	Skills []string `json:"skills"`
+	// the volunteer the recruit chose, for shifts assigning calls by recruit's choice
+	VolunteerID int `json:"volunteer_id"`
+	// answers to the shift's intake form, keyed by field key
+	Answers intake.Responses `json:"answers"`
+}
+
+type updateBookingRequest struct {
+	Status bookings.Status `json:"status"`
+}
+
+type bookingOutcomeRequest struct {
+	Outcome bookings.Outcome `json:"outcome"`
+	Notes   string           `json:"notes"`
+}
+
+// users without bookings.view_all only see the bookings they take part in
+func listBookings(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, err := paginationFromQuery(c)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		filter := bookings.Filter{
+			Limit:  page.limit(),
+			Offset: page.offset(),
+		}
+		if filter.ShiftID, err = queryInt(c, "shift_id"); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if filter.RecruitID, err = queryInt(c, "recruit_id"); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if filter.VolunteerID, err = queryInt(c, "volunteer_id"); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if s := c.Query("status"); len(s) > 0 {
+			if filter.Status, err = bookings.ParseStatus(s); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if o := c.Query("outcome"); len(o) > 0 {
+			// "none" lists calls still waiting for an outcome
+			if o == "none" {
+				filter.AwaitingOutcome = true
+			} else if filter.Outcome, err = bookings.ParseOutcome(o); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if from := c.Query("from"); len(from) > 0 {
+			if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid from %q: %w", from, err))
+			}
+		}
+		if to := c.Query("to"); len(to) > 0 {
+			if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid to %q: %w", to, err))
+			}
+		}
+		if current := middleware.CurrentUser(c); !current.HasPermission(users.ViewAllBookingsPermission) {
+			if !narrowToParticipant(current, &filter) {
+				return page.respond(c, []*bookings.Booking{}, 0)
+			}
+		}
+		found, total, err := bookings.FindBookings(c.Context(), filter, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return page.respond(c, found, total)
+	}
+}
+
+// narrows the filter to the bookings the user takes part in with the permission that goes with it, e.g. a token
+// scoped to bookings.create only sees the calls its user booked. returns false if the filter can't match any of them
+func narrowToParticipant(user *users.User, filter *bookings.Filter) bool {
+	asRecruit := user.HasPermission(users.CreateBookingsPermission)
+	asVolunteer := user.HasPermission(users.SignupShiftsPermission)
+	switch {
+	case asRecruit && asVolunteer:
+		filter.ParticipantID = user.ID
+	case asRecruit:
+		if filter.RecruitID > 0 && filter.RecruitID != user.ID {
+			return false
+		}
+		filter.RecruitID = user.ID
+	case asVolunteer:
+		if filter.VolunteerID > 0 && filter.VolunteerID != user.ID {
+			return false
+		}
+		filter.VolunteerID = user.ID
+	default:
+		return false
+	}
+	return true
+}
+
+// retrieves the booking identified by the id route param, rendering an error if it can't be found
+// or the current user isn't allowed to see it. returns nil when an error was rendered
+func bookingFromParams(c *fiber.Ctx, cfg *middleware.AppConfig) (*bookings.Booking, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusBadRequest, err)
+	}
+	booking, err := bookings.GetBookingByID(c.Context(), id, cfg.PGXPool)
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	current := middleware.CurrentUser(c)
+	// bookings the user can't see are reported as missing so their IDs aren't leaked
+	if booking == nil || (!isParticipant(current, booking) && !current.HasPermission(users.ViewAllBookingsPermission)) {
+		return nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("booking with ID %d not found", id))
+	}
+	return booking, nil
+}
+
+// reports whether the user is the booking's recruit or volunteer, and holds the permission that goes with it
+func isParticipant(user *users.User, booking *bookings.Booking) bool {
+	return (user.ID == booking.RecruitID && user.HasPermission(users.CreateBookingsPermission)) ||
+		(user.ID == booking.VolunteerID && user.HasPermission(users.SignupShiftsPermission))
+}
+
+func getBooking(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		booking, err := bookingFromParams(c, cfg)
+		if booking == nil {
+			return err
+		}
+		return c.JSON(booking)
+	}
+}
+
+func createBooking(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req createBookingRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		if req.ShiftID < 1 {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("shift_id is required"))
+		}
+		if req.StartsAt.IsZero() {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("starts_at is required"))
+		}
+		current := middleware.CurrentUser(c)
+		if req.RecruitID < 1 {
+			req.RecruitID = current.ID
+		}
+		if req.RecruitID != current.ID && !current.HasPermission(users.ManageBookingsPermission) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageBookingsPermission))
+		}
+		prefs := bookings.Preferences{
+			Skills:      req.Skills,
+			VolunteerID: req.VolunteerID,
+		}
+		if req.Skills == nil {
+			recruit, err := users.GetUserByID(c.Context(), req.RecruitID, cfg.PGXPool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if recruit == nil {
+				return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user with ID %d not found", req.RecruitID))
+			}
+			prefs.Skills = recruit.Skills
+		}
+		booking, err := bookings.Book(c.UserContext(), req.ShiftID, req.RecruitID, req.StartsAt, prefs, req.Answers, cfg.PGXPool)
+		if err != nil {
+			if errors.Is(err, bookings.ErrSlotUnavailable) || errors.Is(err, bookings.ErrRecruitBusy) ||
+				errors.Is(err, bookings.ErrNoSkillMatch) || errors.Is(err, bookings.ErrChosenVolunteerBusy) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		return c.Status(http.StatusCreated).JSON(booking)
+	}
+}
+
+// participants may cancel their own bookings. any other change requires bookings.manage
+func updateBooking(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req updateBookingRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		booking, err := bookingFromParams(c, cfg)
+		if booking == nil {
+			return err
+		}
+		current := middleware.CurrentUser(c)
+		canCancel := req.Status == bookings.CancelledStatus && isParticipant(current, booking)
+		if !canCancel && !current.HasPermission(users.ManageBookingsPermission) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageBookingsPermission))
+		}
+		if err := booking.UpdateStatus(c.UserContext(), req.Status, cfg.PGXPool); err != nil {
+			if errors.Is(err, bookings.ErrCannotRebook) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		return c.JSON(booking)
+	}
+}
+
+// the booking's volunteer logs how the call went. logging it for anyone else's call requires bookings.manage
+func logBookingOutcome(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req bookingOutcomeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		booking, err := bookingFromParams(c, cfg)
+		if booking == nil {
+			return err
+		}
+		current := middleware.CurrentUser(c)
+		isVolunteer := current.ID == booking.VolunteerID && current.HasPermission(users.SignupShiftsPermission)
+		if !isVolunteer && !current.HasPermission(users.ManageBookingsPermission) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("only the call's volunteer or users with the %q permission can log its outcome", users.ManageBookingsPermission))
+		}
+		if err := booking.LogOutcome(c.UserContext(), req.Outcome, req.Notes, cfg.PGXPool); err != nil {
+			if errors.Is(err, bookings.ErrCallNotStarted) || errors.Is(err, bookings.ErrCallNotBooked) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			if errors.Is(err, bookings.ErrInvalidOutcome) {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(booking)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// the OpenAPI 3 description of the v1 routes. update it alongside RegisterV1
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// serves the OpenAPI spec. doesn't require authentication, so integrators can fetch it before they have a token
+func OpenAPIHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Send(openAPISpec)
+}
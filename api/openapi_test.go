@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"scheduler/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const v1Prefix = "/api/v1"
+
+type openAPIDoc struct {
+	OpenAPI string `json:"openapi"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+var routeParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %s", err)
+	}
+	return doc
+}
+
+// returns "METHOD /path" for every route registered by RegisterV1, with params in OpenAPI's {param} form
+func registeredRoutes() map[string]bool {
+	app := fiber.New()
+	RegisterV1(app.Group(v1Prefix), &middleware.AppConfig{})
+	routes := map[string]bool{}
+	for _, stack := range app.Stack() {
+		for _, route := range stack {
+			// the group itself and its catch-all are mounted on the prefix. HEAD routes are added by fiber for every GET
+			if route.Path == v1Prefix || route.Method == fiber.MethodHead {
+				continue
+			}
+			path := routeParam.ReplaceAllString(strings.TrimPrefix(route.Path, v1Prefix), "{$1}")
+			routes[route.Method+" "+path] = true
+		}
+	}
+	return routes
+}
+
+func TestOpenAPISpecIsValid(t *testing.T) {
+	doc := loadSpec(t)
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != v1Prefix {
+		t.Errorf("expected a single server with URL %q", v1Prefix)
+	}
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	routes := registeredRoutes()
+	if len(routes) < 1 {
+		t.Fatal("no routes registered")
+	}
+	for route := range routes {
+		parts := strings.SplitN(route, " ", 2)
+		if _, ok := doc.Paths[parts[1]][strings.ToLower(parts[0])]; !ok {
+			t.Errorf("route %s is missing from openapi.json", route)
+		}
+	}
+}
+
+func TestOpenAPISpecHasNoStaleRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	routes := registeredRoutes()
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if route := strings.ToUpper(method) + " " + path; !routes[route] {
+				t.Errorf("openapi.json documents %s, which isn't registered", route)
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"scheduler/bookings"
+	"scheduler/intake"
+	"scheduler/middleware"
+	"scheduler/shifts"
+	"scheduler/users"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type createShiftRequest struct {
+	Title    string    `json:"title"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Capacity int       `json:"capacity"`
+	// defaults to round_robin
+	Assignment shifts.Assignment `json:"assignment"`
+	// the intake form recruits fill in when they book, if any
+	IntakeFormID *int `json:"intake_form_id"`
+}
+
+// only the provided fields are changed
+type updateShiftRequest struct {
+	Title    *string        `json:"title"`
+	StartsAt *time.Time     `json:"starts_at"`
+	EndsAt   *time.Time     `json:"ends_at"`
+	Capacity *int           `json:"capacity"`
+	Status   *shifts.Status `json:"status"`
+	// how calls are assigned to the shift's volunteers from now on
+	Assignment *shifts.Assignment `json:"assignment"`
+	// 0 removes the shift's intake form
+	IntakeFormID *int `json:"intake_form_id"`
+}
+
+type shiftVolunteerRequest struct {
+	// defaults to the current user
+	UserID int `json:"user_id"`
+}
+
+func listShifts(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, err := paginationFromQuery(c)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		filter := shifts.Filter{
+			Limit:  page.limit(),
+			Offset: page.offset(),
+		}
+		if from := c.Query("from"); len(from) > 0 {
+			if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid from %q: %w", from, err))
+			}
+		}
+		if to := c.Query("to"); len(to) > 0 {
+			if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid to %q: %w", to, err))
+			}
+		}
+		if s := c.Query("status"); len(s) > 0 {
+			if filter.Status, err = shifts.ParseStatus(s); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if filter.VolunteerID, err = queryInt(c, "volunteer_id"); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		found, total, err := shifts.FindShifts(c.Context(), filter, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := shifts.LoadVolunteers(c.Context(), found, cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return page.respond(c, found, total)
+	}
+}
+
+// retrieves the shift identified by the id route param, rendering an error if it can't be found.
+// returns nil when an error was rendered
+func shiftFromParams(c *fiber.Ctx, cfg *middleware.AppConfig) (*shifts.Shift, error) {
+	id, err := paramID(c, "id")
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusBadRequest, err)
+	}
+	shift, err := shifts.GetShiftByID(c.Context(), id, cfg.PGXPool)
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	if shift == nil {
+		return nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("shift with ID %d not found", id))
+	}
+	if err := shift.LoadVolunteers(c.Context(), cfg.PGXPool); err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	return shift, nil
+}
+
+func getShift(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		return c.JSON(shift)
+	}
+}
+
+func createShift(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req createShiftRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		shift, err := shifts.New(req.Title, req.StartsAt, req.EndsAt, req.Capacity)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if req.Assignment != shifts.UndefinedAssignment {
+			shift.Assignment = req.Assignment
+		}
+		if shift.IntakeFormID, err = intakeFormID(c, req.IntakeFormID, cfg); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := shift.Update(c.UserContext(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		shift.VolunteerIDs = []int{}
+		return c.Status(http.StatusCreated).JSON(shift)
+	}
+}
+
+func updateShift(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req updateShiftRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		if req.Title != nil {
+			shift.Title = *req.Title
+		}
+		if req.StartsAt != nil {
+			shift.StartsAt = *req.StartsAt
+		}
+		if req.EndsAt != nil {
+			shift.EndsAt = *req.EndsAt
+		}
+		if req.Capacity != nil {
+			shift.Capacity = *req.Capacity
+		}
+		if req.Status != nil {
+			shift.Status = *req.Status
+		}
+		if req.Assignment != nil {
+			shift.Assignment = *req.Assignment
+		}
+		if req.IntakeFormID != nil {
+			if shift.IntakeFormID, err = intakeFormID(c, req.IntakeFormID, cfg); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if err := shift.IsValid(); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := shift.Update(c.UserContext(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(shift)
+	}
+}
+
+// checks that the intake form exists. nil and 0 mean no form
+func intakeFormID(c *fiber.Ctx, id *int, cfg *middleware.AppConfig) (*int, error) {
+	if id == nil || *id == 0 {
+		return nil, nil
+	}
+	form, err := intake.GetFormByID(c.Context(), *id, cfg.PGXPool)
+	if err != nil {
+		return nil, err
+	}
+	if form == nil {
+		return nil, fmt.Errorf("intake form with ID %d not found", *id)
+	}
+	return &form.ID, nil
+}
+
+// returns the questions recruits answer when booking a call during the shift
+func getShiftIntakeForm(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		if shift.IntakeFormID == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("shift with ID %d doesn't have an intake form", shift.ID))
+		}
+		form, err := intake.GetFormByID(c.Context(), *shift.IntakeFormID, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if form == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("shift with ID %d doesn't have an intake form", shift.ID))
+		}
+		return c.JSON(form)
+	}
+}
+
+func listSlots(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		slots, err := bookings.Slots(c.Context(), shift, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(fiber.Map{"data": slots})
+	}
+}
+
+// volunteers with shifts.signup can only add or remove themselves. anyone else requires shifts.manage
+func canChangeShiftVolunteer(current *users.User, userID int) bool {
+	if current.HasPermission(users.ManageShiftsPermission) {
+		return true
+	}
+	return current.ID == userID && current.HasPermission(users.SignupShiftsPermission)
+}
+
+func addShiftVolunteer(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req shiftVolunteerRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&req); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			}
+		}
+		current := middleware.CurrentUser(c)
+		if req.UserID < 1 {
+			req.UserID = current.ID
+		}
+		if !canChangeShiftVolunteer(current, req.UserID) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageShiftsPermission))
+		}
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		volunteer, err := users.GetUserByID(c.Context(), req.UserID, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if volunteer == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user with ID %d not found", req.UserID))
+		}
+		if err := volunteer.LoadRoles(c.Context(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if !volunteer.HasPermission(users.SignupShiftsPermission) {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("user with ID %d cannot volunteer for shifts", volunteer.ID))
+		}
+		if err := shift.AddVolunteer(c.UserContext(), volunteer.ID, cfg.PGXPool); err != nil {
+			if errors.Is(err, shifts.ErrShiftFull) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(shift)
+	}
+}
+
+func removeShiftVolunteer(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := paramID(c, "user_id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		current := middleware.CurrentUser(c)
+		if !canChangeShiftVolunteer(current, userID) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageShiftsPermission))
+		}
+		shift, err := shiftFromParams(c, cfg)
+		if shift == nil {
+			return err
+		}
+		if err := shift.RemoveVolunteer(c.UserContext(), userID, cfg.PGXPool); err != nil {
+			if errors.Is(err, bookings.ErrVolunteerHasCalls) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(shift)
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+
+	"scheduler/middleware"
+	"scheduler/users"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type createUserRequest struct {
+	Name  string     `json:"name"`
+	Email string     `json:"email"`
+	Type  users.Type `json:"type"`
+	// IANA time zone. when empty, it's set from the user's browser the first time they log in
+	TimeZone string `json:"time_zone"`
+	// skills and languages the user offers as a volunteer, or needs in a volunteer as a recruit
+	Skills []string `json:"skills"`
+	// when true, the user is sent an invitation email after being created
+	Invite bool `json:"invite"`
+}
+
+// only the provided fields are changed
+type updateUserRequest struct {
+	Name   *string       `json:"name"`
+	Email  *string       `json:"email"`
+	Status *users.Status `json:"status"`
+	Type   *users.Type   `json:"type"`
+	// IANA time zone, e.g. America/Chicago. an empty string clears it
+	TimeZone *string `json:"time_zone"`
+	// replaces the user's skills
+	Skills []string `json:"skills"`
+}
+
+func listUsers(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, err := paginationFromQuery(c)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		filter := users.Filter{
+			Limit:  page.limit(),
+			Offset: page.offset(),
+		}
+		if t := c.Query("type"); len(t) > 0 {
+			if filter.Type, err = users.ParseType(t); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if s := c.Query("status"); len(s) > 0 {
+			if filter.Status, err = users.ParseStatus(s); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		if s := c.Query("stage"); len(s) > 0 {
+			if filter.Stage, err = users.ParseStage(s); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+		}
+		found, total, err := users.FindUsers(c.Context(), filter, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := users.LoadRoles(c.Context(), found, cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return page.respond(c, found, total)
+	}
+}
+
+// users can always view themselves. viewing anyone else requires the users.view permission
+func getUser(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c, "id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		current := middleware.CurrentUser(c)
+		if current.ID != id && !current.HasPermission(users.ViewUsersPermission) {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ViewUsersPermission))
+		}
+		user, err := users.GetUserByID(c.Context(), id, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user with ID %d not found", id))
+		}
+		if err := user.LoadRoles(c.Context(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(user)
+	}
+}
+
+func createUser(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req createUserRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		addr, err := netmail.ParseAddress(req.Email)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid email %q: %w", req.Email, err))
+		}
+		if req.Type == users.UndefinedType {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("type is required"))
+		}
+		existing, err := users.GetUserByEmail(c.Context(), addr.Address, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if existing != nil {
+			return utils.RenderError(c, http.StatusConflict, fmt.Errorf("user with email %q already exists", addr.Address))
+		}
+		user := &users.User{
+			Name:     req.Name,
+			Email:    addr.Address,
+			Status:   users.PendingStatus,
+			Type:     req.Type,
+			TimeZone: req.TimeZone,
+			Skills:   req.Skills,
+		}
+		if err := user.IsValid(); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if req.Invite {
+			err = user.Invite(c.UserContext(), cfg.ServerAddress, cfg.MailClient, cfg.Engine, cfg.PGXPool, cfg.AuthClient)
+		} else {
+			err = user.Update(c.UserContext(), cfg.PGXPool)
+		}
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Status(http.StatusCreated).JSON(user)
+	}
+}
+
+func updateUser(cfg *middleware.AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := paramID(c, "id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		var req updateUserRequest
+		if err := c.BodyParser(&req); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		}
+		user, err := users.GetUserByID(c.Context(), id, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user with ID %d not found", id))
+		}
+		if req.Name != nil {
+			user.Name = *req.Name
+		}
+		if req.Email != nil {
+			addr, err := netmail.ParseAddress(*req.Email)
+			if err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid email %q: %w", *req.Email, err))
+			}
+			existing, err := users.GetUserByEmail(c.Context(), addr.Address, cfg.PGXPool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if existing != nil && existing.ID != user.ID {
+				return utils.RenderError(c, http.StatusConflict, fmt.Errorf("user with email %q already exists", addr.Address))
+			}
+			user.Email = addr.Address
+		}
+		if req.Status != nil {
+			user.Status = *req.Status
+		}
+		if req.Type != nil {
+			if *req.Type == users.UndefinedType {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("type cannot be empty"))
+			}
+			user.Type = *req.Type
+		}
+		if req.TimeZone != nil {
+			user.TimeZone = *req.TimeZone
+		}
+		if req.Skills != nil {
+			user.Skills = req.Skills
+		}
+		if err := user.IsValid(); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := user.Update(c.UserContext(), cfg.PGXPool); err != nil {
+			if errors.Is(err, users.ErrLastAdmin) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := user.LoadRoles(c.Context(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.JSON(user)
+	}
+}
@@ -0,0 +1,90 @@
+// booking widget for campaign websites. add the snippet from the admin embeds page where the picker should go:
+//
+//   <div class="scheduler-booking" data-series="1"><iframe src="https://scheduler.example/embed/1"></iframe></div>
+//   <script src="https://scheduler.example/embed.js" async></script>
+//
+// the script swaps the iframe for a slot picker styled by the host page. if it can't load the slots, e.g. because the
+// site hasn't been allowed yet, the iframe is left in place. picking a time opens the booking page to finish booking
+(function () {
+  "use strict";
+
+  var script = document.currentScript;
+  var server = script ? new URL(script.src).origin : "";
+
+  function el(tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) {
+      node.className = "scheduler-booking-" + className;
+    }
+    if (text) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function render(data) {
+    var picker = el("div", "picker");
+    picker.appendChild(el("h3", "title", data.series.title));
+    if (data.days.length < 1) {
+      picker.appendChild(el("p", "empty", "There aren't any open times right now. Check back soon."));
+      return picker;
+    }
+    picker.appendChild(el("p", "note", "Pick a time for your call. Times are in " + data.series.time_zone + "."));
+    data.days.forEach(function (day) {
+      var group = el("div", "day");
+      group.appendChild(el("strong", "day-label", day.label));
+      var list = el("ul", "slots");
+      day.slots.forEach(function (slot) {
+        var link = el("a", "slot", slot.label);
+        link.href = data.booking_url + "?slot=" + encodeURIComponent(slot.value);
+        link.target = "_blank";
+        link.rel = "noopener";
+        var item = el("li");
+        item.appendChild(link);
+        list.appendChild(item);
+      });
+      group.appendChild(list);
+      picker.appendChild(group);
+    });
+    return picker;
+  }
+
+  function load(container) {
+    var id = container.getAttribute("data-series");
+    if (!server || !/^\d+$/.test(id || "") || !window.fetch) {
+      return;
+    }
+    fetch(server + "/embed/" + id + "/slots", { credentials: "omit" })
+      .then(function (res) {
+        if (!res.ok) {
+          throw new Error("failed to load booking slots: " + res.status);
+        }
+        return res.json();
+      })
+      .then(function (data) {
+        var picker = render(data);
+        while (container.firstChild) {
+          container.removeChild(container.firstChild);
+        }
+        container.appendChild(picker);
+      })
+      .catch(function (err) {
+        if (window.console) {
+          console.warn(err);
+        }
+      });
+  }
+
+  function init() {
+    var containers = document.querySelectorAll(".scheduler-booking[data-series]");
+    for (var i = 0; i < containers.length; i++) {
+      load(containers[i]);
+    }
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"scheduler/utils"
+)
+
+// writes events as CSV, including a header row. text cells are escaped so spreadsheets don't run them as formulas
+func WriteCSV(w io.Writer, events []*Event) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "created_at", "actor_id", "actor_name", "actor_email", "action", "target_type", "target_id", "before", "after"}); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	for _, e := range events {
+		actorID := ""
+		if e.ActorID != nil {
+			actorID = strconv.Itoa(*e.ActorID)
+		}
+		if err := writer.Write([]string{
+			strconv.Itoa(e.ID),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			utils.CSVCell(e.ActorName),
+			utils.CSVCell(e.ActorEmail),
+			utils.CSVCell(e.Action),
+			utils.CSVCell(e.TargetType),
+			strconv.Itoa(e.TargetID),
+			utils.CSVCell(e.Before),
+			utils.CSVCell(e.After),
+		}); err != nil {
+			return fmt.Errorf("failed to write csv row for event %d: %w", e.ID, err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"scheduler/utils"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Execer is satisfied by *pgxpool.Pool, *pgx.Conn and pgx.Tx,
+// so events can be recorded in the same transaction as the change they describe
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// an append-only record of a change made in the app.
+// Before and After hold JSON snapshots of the target, and are empty when not applicable
+type Event struct {
+	ID         int
+	ActorID    *int
+	ActorName  string
+	ActorEmail string
+	Action     string
+	TargetType string
+	TargetID   int
+	Before     string
+	After      string
+	CreatedAt  time.Time
+}
+
+type actorKey struct{}
+
+// returns a copy of ctx carrying the ID of the user responsible for any changes made with it
+func WithActor(ctx context.Context, actorID int) context.Context {
+	return context.WithValue(ctx, actorKey{}, actorID)
+}
+
+// returns the actor ID stored by WithActor, or nil for changes made by the system
+func ActorFrom(ctx context.Context) *int {
+	if id, ok := ctx.Value(actorKey{}).(int); ok {
+		return &id
+	}
+	return nil
+}
+
+// records an event, attributing it to the actor stored in ctx.
+// before and after are marshaled to JSON, and may be nil
+func Record(ctx context.Context, db Execer, action string, targetType string, targetID int, before interface{}, after interface{}) error {
+	beforeJSON, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(
+		ctx,
+		"insert into audit_events(actor_id, action, target_type, target_id, before, after) values ($1, $2, $3, $4, $5, $6)",
+		ActorFrom(ctx),
+		action,
+		targetType,
+		targetID,
+		beforeJSON,
+		afterJSON,
+	); err != nil {
+		return fmt.Errorf("failed to record %s audit event: %w", action, err)
+	}
+	return nil
+}
+
+func marshalSnapshot(v interface{}) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit snapshot: %w", err)
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// narrows the events returned by List. zero values are ignored
+type Filter struct {
+	ActorID    int
+	Action     string
+	TargetType string
+	TargetID   int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// returns events matching the filter, newest first
+func List(ctx context.Context, filter Filter, pool *pgxpool.Pool) ([]*Event, error) {
+	var where utils.Where
+	if filter.ActorID > 0 {
+		where.Add("e.actor_id = $%d", filter.ActorID)
+	}
+	if len(filter.Action) > 0 {
+		where.Add("e.action = $%d", filter.Action)
+	}
+	if len(filter.TargetType) > 0 {
+		where.Add("e.target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID > 0 {
+		where.Add("e.target_id = $%d", filter.TargetID)
+	}
+	if !filter.From.IsZero() {
+		where.Add("e.created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where.Add("e.created_at < $%d", filter.To)
+	}
+	query := `select e.id, e.actor_id, coalesce(u.name, '') as actor_name, coalesce(u.email, '') as actor_email,
+		e.action, e.target_type, e.target_id, coalesce(e.before::text, '') as before, coalesce(e.after::text, '') as after, e.created_at
+		from audit_events e left join users u on u.id = e.actor_id` + where.String() + " order by e.created_at desc, e.id desc"
+	query = where.Paginate(query, filter.Limit, 0)
+	var events []*Event
+	if err := pgxscan.Select(ctx, pool, &events, query, where.Args...); err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	return events, nil
+}
+
+// returns every distinct action that has been recorded, for use in filters
+func Actions(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	var actions []string
+	if err := pgxscan.Select(ctx, pool, &actions, "select distinct action from audit_events order by action"); err != nil {
+		return nil, fmt.Errorf("failed to get audit actions: %w", err)
+	}
+	return actions, nil
+}
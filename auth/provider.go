@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"scheduler/stytch"
+
+	"github.com/stytchauth/stytch-go/v5/stytch/config"
+)
+
+// AuthProvider is implemented by anything that can create users and issue/validate sessions for them.
+// stytch.Client is the real implementation; DevClient can be used for local development and testing
+type AuthProvider interface {
+	// on success, returns a session for the user identified by the oauth token
+	AuthenticateOauth(token string, current stytch.Session, validator func(stytchID string) error) (stytch.Session, error)
+	// on success, returns the stytch ID of the user the session belongs to,
+	// along with the session, which may have been refreshed and should be stored in place of the current one
+	AuthenticateSession(ctx context.Context, current stytch.Session) (string, stytch.Session, error)
+	RevokeSession(sessionToken string) error
+	// on success, returns a string representing the stytch user ID
+	CreateUser(email string) (string, error)
+}
+
+var _ AuthProvider = (*stytch.Client)(nil)
+
+const (
+	StytchProvider = "stytch"
+	DevProvider    = "dev"
+)
+
+type Config struct {
+	// either StytchProvider or DevProvider. defaults to StytchProvider when empty
+	Provider string
+	IsProd   bool
+	// the dev provider lets anyone sign in as any user, so it refuses to start unless this is set as well
+	AllowDev bool
+
+	StytchProjectID string
+	StytchSecret    string
+	// used to sign dev sessions. a random secret is generated when empty,
+	// which means dev sessions won't survive a restart
+	DevSecret string
+}
+
+// selects and creates the provider indicated by cfg.Provider
+func NewProvider(cfg Config) (AuthProvider, error) {
+	switch cfg.Provider {
+	case "", StytchProvider:
+		env := config.EnvTest
+		if cfg.IsProd {
+			env = config.EnvLive
+		}
+		client, err := stytch.NewClient(env, cfg.StytchProjectID, cfg.StytchSecret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new stytch client: %w", err)
+		}
+		return client, nil
+	case DevProvider:
+		if !cfg.AllowDev {
+			return nil, fmt.Errorf("the dev auth provider must be allowed explicitly, e.g. with ALLOW_DEV_AUTH=true")
+		}
+		return NewDevClient(cfg.DevSecret, cfg.IsProd)
+	default:
+		return nil, fmt.Errorf("unknown auth provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,303 @@
+package availability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about availability
+const auditTarget = "availability"
+
+const minutesPerDay = 24 * 60
+
+// a block of time a volunteer is available every week, e.g. Tuesdays from 6pm to 9pm.
+// times are wall clock times in the volunteer's time zone
+type Window struct {
+	ID      int          `json:"id"`
+	UserID  int          `json:"user_id"`
+	Weekday time.Weekday `json:"weekday"`
+	// minutes after midnight
+	StartMinute int `json:"start_minute"`
+	EndMinute   int `json:"end_minute"`
+}
+
+func (w *Window) IsValid() error {
+	var errs []string
+	if w.Weekday < time.Sunday || w.Weekday > time.Saturday {
+		errs = append(errs, fmt.Sprintf("invalid weekday %d provided", w.Weekday))
+	}
+	if w.StartMinute < 0 || w.EndMinute > minutesPerDay {
+		errs = append(errs, "times must be within the day")
+	} else if w.EndMinute <= w.StartMinute {
+		errs = append(errs, "availability must end after it starts")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// formats the window like "Tuesday 18:00–21:00"
+func (w *Window) String() string {
+	return fmt.Sprintf("%s %s–%s", w.Weekday, w.Start(), w.End())
+}
+
+// formats the start time like "18:00"
+func (w *Window) Start() string {
+	return formatMinute(w.StartMinute)
+}
+
+func (w *Window) End() string {
+	return formatMinute(w.EndMinute)
+}
+
+func formatMinute(m int) string {
+	return fmt.Sprintf("%02d:%02d", m/60, m%60)
+}
+
+// parses a time of day like "18:30" into minutes after midnight. "24:00" is accepted as the end of the day
+func ParseMinute(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return minutesPerDay, nil
+		}
+		return 0, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// a volunteer's weekly availability along with the dates they've blocked out
+type Availability struct {
+	UserID int
+	// the volunteer's time zone, which Windows and Blackouts are in
+	Location *time.Location
+	Windows  []*Window
+	// dates the volunteer is unavailable regardless of Windows, as midnight UTC
+	Blackouts []time.Time
+}
+
+// returns the user's weekly availability, ordered by day and time, and their upcoming blackout dates
+func Get(ctx context.Context, userID int, pool *pgxpool.Pool) (*Availability, error) {
+	found, err := GetForUsers(ctx, []int{userID}, time.Now(), pool)
+	if err != nil {
+		return nil, err
+	}
+	return found[userID], nil
+}
+
+// returns the availability of each of the users. only blackout dates on or after since are included.
+// every user is included in the result, even if they haven't set their availability
+func GetForUsers(ctx context.Context, userIDs []int, since time.Time, pool *pgxpool.Pool) (map[int]*Availability, error) {
+	byUser := map[int]*Availability{}
+	if len(userIDs) < 1 {
+		return byUser, nil
+	}
+	var zones []*users.User
+	if err := pgxscan.Select(ctx, pool, &zones, "select id, time_zone from users where id = any($1)", userIDs); err != nil {
+		return nil, fmt.Errorf("failed to get time zones from db: %w", err)
+	}
+	for _, u := range zones {
+		byUser[u.ID] = &Availability{UserID: u.ID, Location: u.Location()}
+	}
+	for _, id := range userIDs {
+		if _, ok := byUser[id]; !ok {
+			byUser[id] = &Availability{UserID: id, Location: users.DefaultLocation}
+		}
+	}
+	var windows []*Window
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&windows,
+		"select * from availability_windows where user_id = any($1) order by weekday, start_minute, end_minute",
+		userIDs,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get availability from db: %w", err)
+	}
+	for _, w := range windows {
+		byUser[w.UserID].Windows = append(byUser[w.UserID].Windows, w)
+	}
+	var blackouts []struct {
+		UserID int
+		Date   time.Time
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&blackouts,
+		"select user_id, date from blackout_dates where user_id = any($1) and date >= $2 order by date",
+		userIDs,
+		// blackout dates are in each volunteer's time zone, so allow for the zones ahead of since
+		dateOf(since.UTC()).AddDate(0, 0, -1),
+	); err != nil {
+		return nil, fmt.Errorf("failed to get blackout dates from db: %w", err)
+	}
+	for _, b := range blackouts {
+		byUser[b.UserID].Blackouts = append(byUser[b.UserID].Blackouts, b.Date)
+	}
+	return byUser, nil
+}
+
+// reports whether the volunteer is available for the whole time range
+func (a *Availability) Covers(startsAt time.Time, endsAt time.Time) bool {
+	if a == nil || !endsAt.After(startsAt) {
+		return false
+	}
+	start, end := startsAt.In(a.location()), endsAt.In(a.location())
+	// check each day the range touches separately
+	for day := dateOf(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if a.IsBlackedOut(day) {
+			return false
+		}
+		from, to := 0, minutesPerDay
+		if sameDate(day, start) {
+			from = start.Hour()*60 + start.Minute()
+		}
+		if sameDate(day, end) {
+			to = end.Hour()*60 + end.Minute()
+			if end.Second() > 0 || end.Nanosecond() > 0 {
+				to++
+			}
+		}
+		if from < to && !a.coversMinutes(day.Weekday(), from, to) {
+			return false
+		}
+	}
+	return true
+}
+
+// reports whether the windows on the weekday cover from to to, allowing adjacent or overlapping windows to be combined
+func (a *Availability) coversMinutes(weekday time.Weekday, from int, to int) bool {
+	var windows []*Window
+	for _, w := range a.Windows {
+		if w.Weekday == weekday {
+			windows = append(windows, w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].StartMinute < windows[j].StartMinute })
+	covered := from
+	for _, w := range windows {
+		if w.StartMinute > covered {
+			break
+		}
+		if w.EndMinute > covered {
+			covered = w.EndMinute
+		}
+		if covered >= to {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the date, in the volunteer's time zone, is one of their blackout dates
+func (a *Availability) IsBlackedOut(t time.Time) bool {
+	t = t.In(a.location())
+	for _, b := range a.Blackouts {
+		if b.Year() == t.Year() && b.YearDay() == t.YearDay() {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Availability) location() *time.Location {
+	if a.Location == nil {
+		return users.DefaultLocation
+	}
+	return a.Location
+}
+
+// adds a weekly window of availability for the user
+func AddWindow(ctx context.Context, w *Window, pool *pgxpool.Pool) error {
+	if err := w.IsValid(); err != nil {
+		return fmt.Errorf("invalid availability: %w", err)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&w.ID,
+			"insert into availability_windows(user_id, weekday, start_minute, end_minute) values ($1, $2, $3, $4) returning id",
+			w.UserID,
+			w.Weekday,
+			w.StartMinute,
+			w.EndMinute,
+		); err != nil {
+			return fmt.Errorf("failed to insert availability: %w", err)
+		}
+		return audit.Record(ctx, tx, "availability.add", auditTarget, w.UserID, nil, w)
+	})
+}
+
+// removes one of the user's weekly windows. removing a window that doesn't exist is a no-op
+func RemoveWindow(ctx context.Context, userID int, id int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var removed []*Window
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&removed,
+			"delete from availability_windows where id = $1 and user_id = $2 returning *",
+			id,
+			userID,
+		); err != nil {
+			return fmt.Errorf("failed to delete availability: %w", err)
+		}
+		if len(removed) < 1 {
+			return nil
+		}
+		return audit.Record(ctx, tx, "availability.remove", auditTarget, userID, removed[0], nil)
+	})
+}
+
+// marks the user as unavailable for the whole date. adding a date that's already blocked out is a no-op
+func AddBlackout(ctx context.Context, userID int, date time.Time, pool *pgxpool.Pool) error {
+	date = dateOf(date)
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "insert into blackout_dates(user_id, date) values ($1, $2) on conflict do nothing", userID, date)
+		if err != nil {
+			return fmt.Errorf("failed to insert blackout date: %w", err)
+		}
+		if tag.RowsAffected() < 1 {
+			return nil
+		}
+		return audit.Record(ctx, tx, "availability.blackout_add", auditTarget, userID, nil, date.Format("2006-01-02"))
+	})
+}
+
+// removing a date that isn't blocked out is a no-op
+func RemoveBlackout(ctx context.Context, userID int, date time.Time, pool *pgxpool.Pool) error {
+	date = dateOf(date)
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "delete from blackout_dates where user_id = $1 and date = $2", userID, date)
+		if err != nil {
+			return fmt.Errorf("failed to delete blackout date: %w", err)
+		}
+		if tag.RowsAffected() < 1 {
+			return nil
+		}
+		return audit.Record(ctx, tx, "availability.blackout_remove", auditTarget, userID, date.Format("2006-01-02"), nil)
+	})
+}
+
+// returns midnight at the start of t's date in t's location
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func sameDate(a time.Time, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
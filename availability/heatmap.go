@@ -0,0 +1,77 @@
+package availability
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// the number of volunteers available during each hour of a week
+type Heatmap struct {
+	Days []*HeatmapDay
+	// the largest count in the heatmap, used to scale its colors
+	Max int
+	// number of volunteers considered
+	Volunteers int
+}
+
+type HeatmapDay struct {
+	// midnight in the heatmap's time zone
+	Date  time.Time
+	Hours [24]int
+}
+
+// returns the heatmap for the 7 days starting on weekStart's date, with hours in loc.
+// each volunteer's availability is in their own time zone. only active and invited volunteers are counted,
+// including users granted the volunteer role
+func GetHeatmap(ctx context.Context, weekStart time.Time, loc *time.Location, pool *pgxpool.Pool) (*Heatmap, error) {
+	start := dateOf(weekStart.In(loc))
+	var volunteerIDs []int
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&volunteerIDs,
+		`select id from users u
+		where (u.type = $1 or exists (select 1 from user_roles r where r.user_id = u.id and r.role = $1))
+		and u.status in ($2, $3)`,
+		users.VolunteerType,
+		users.ActiveStatus,
+		users.InvitedStatus,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get volunteers from db: %w", err)
+	}
+	byUser, err := GetForUsers(ctx, volunteerIDs, start, pool)
+	if err != nil {
+		return nil, err
+	}
+	heatmap := &Heatmap{Volunteers: len(volunteerIDs)}
+	for d := 0; d < 7; d++ {
+		day := &HeatmapDay{Date: start.AddDate(0, 0, d)}
+		for h := range day.Hours {
+			hourStart := time.Date(day.Date.Year(), day.Date.Month(), day.Date.Day(), h, 0, 0, 0, loc)
+			for _, a := range byUser {
+				if a.Covers(hourStart, hourStart.Add(time.Hour)) {
+					day.Hours[h]++
+				}
+			}
+			if day.Hours[h] > heatmap.Max {
+				heatmap.Max = day.Hours[h]
+			}
+		}
+		heatmap.Days = append(heatmap.Days, day)
+	}
+	return heatmap, nil
+}
+
+// returns a CSS lightness percentage for the count, darker for more available volunteers
+func (h *Heatmap) Lightness(count int) int {
+	if h.Max < 1 {
+		return 100
+	}
+	return 100 - count*45/h.Max
+}
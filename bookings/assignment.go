@@ -0,0 +1,161 @@
+package bookings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+)
+
+var (
+	ErrNoSkillMatch        = errors.New("no volunteer with the skills the recruit needs is available at the requested time")
+	ErrChosenVolunteerBusy = errors.New("the chosen volunteer isn't available at the requested time")
+	ErrUnknownAssignment   = errors.New("unknown assignment")
+	errNoCandidates        = errors.New("no candidates to choose from")
+)
+
+// a volunteer on the shift who is free to take a call
+type Candidate struct {
+	VolunteerID int
+	// calls booked with the volunteer during the shift
+	Calls int
+	// when the volunteer was last assigned a call during the shift that is still booked. nil if they haven't been
+	LastAssignedAt *time.Time
+	Skills         []string
+}
+
+// what the recruit is looking for in the volunteer they're booked with
+type Preferences struct {
+	// skills the volunteer needs, e.g. "spanish". only used by shifts.SkillMatchAssignment
+	Skills []string
+	// the volunteer the recruit chose. only used by shifts.RecruitChoiceAssignment
+	VolunteerID int
+}
+
+// picks which of the free volunteers takes a call. candidates are never empty, and are in sign up order
+type Strategy interface {
+	Choose(candidates []*Candidate, prefs Preferences) (*Candidate, error)
+}
+
+var strategies = map[shifts.Assignment]Strategy{
+	shifts.RoundRobinAssignment:    RoundRobin{},
+	shifts.LeastLoadedAssignment:   LeastLoaded{},
+	shifts.SkillMatchAssignment:    SkillMatch{},
+	shifts.RecruitChoiceAssignment: RecruitChoice{},
+}
+
+// returns the strategy used for shifts with the assignment
+func StrategyFor(a shifts.Assignment) (Strategy, error) {
+	s, ok := strategies[a]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownAssignment, a)
+	}
+	return s, nil
+}
+
+// gives the call to whoever has gone longest without one. volunteers who haven't had a call go first, in sign up order
+type RoundRobin struct{}
+
+func (RoundRobin) Choose(candidates []*Candidate, prefs Preferences) (*Candidate, error) {
+	var chosen *Candidate
+	for _, c := range candidates {
+		if chosen == nil || waitedLonger(c, chosen) {
+			chosen = c
+		}
+	}
+	if chosen == nil {
+		return nil, errNoCandidates
+	}
+	return chosen, nil
+}
+
+// gives the call to the volunteer with the fewest calls during the shift, taking turns between volunteers with the same number
+type LeastLoaded struct{}
+
+func (LeastLoaded) Choose(candidates []*Candidate, prefs Preferences) (*Candidate, error) {
+	var chosen *Candidate
+	for _, c := range candidates {
+		if chosen == nil || c.Calls < chosen.Calls || (c.Calls == chosen.Calls && waitedLonger(c, chosen)) {
+			chosen = c
+		}
+	}
+	if chosen == nil {
+		return nil, errNoCandidates
+	}
+	return chosen, nil
+}
+
+// only gives the call to volunteers with every skill the recruit needs, spreading calls between them like LeastLoaded
+type SkillMatch struct{}
+
+func (SkillMatch) Choose(candidates []*Candidate, prefs Preferences) (*Candidate, error) {
+	var matches []*Candidate
+	for _, c := range candidates {
+		if users.HasSkills(c.Skills, prefs.Skills) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) < 1 {
+		return nil, ErrNoSkillMatch
+	}
+	return LeastLoaded{}.Choose(matches, prefs)
+}
+
+// gives the call to the volunteer the recruit chose. when they didn't choose anyone, calls are spread like LeastLoaded
+type RecruitChoice struct{}
+
+func (RecruitChoice) Choose(candidates []*Candidate, prefs Preferences) (*Candidate, error) {
+	if prefs.VolunteerID < 1 {
+		return LeastLoaded{}.Choose(candidates, prefs)
+	}
+	for _, c := range candidates {
+		if c.VolunteerID == prefs.VolunteerID {
+			return c, nil
+		}
+	}
+	return nil, ErrChosenVolunteerBusy
+}
+
+// reports whether a has gone longer without a call than b. ties go to b, which signed up first
+func waitedLonger(a *Candidate, b *Candidate) bool {
+	switch {
+	case b.LastAssignedAt == nil:
+		return false
+	case a.LastAssignedAt == nil:
+		return true
+	default:
+		return a.LastAssignedAt.Before(*b.LastAssignedAt)
+	}
+}
+
+// returns the shift's volunteers without a booking overlapping the time range, in sign up order
+func candidates(ctx context.Context, db pgxscan.Querier, shiftID int, startsAt time.Time, endsAt time.Time) ([]*Candidate, error) {
+	var found []*Candidate
+	if err := pgxscan.Select(
+		ctx,
+		db,
+		&found,
+		`select sv.user_id as volunteer_id, u.skills,
+			(select count(*) from bookings b where b.shift_id = sv.shift_id and b.volunteer_id = sv.user_id and b.status = $2) as calls,
+			(select max(b.created_at) from bookings b where b.shift_id = sv.shift_id and b.volunteer_id = sv.user_id and b.status = $2) as last_assigned_at
+		from shift_volunteers sv
+		join users u on u.id = sv.user_id
+		where sv.shift_id = $1 and not exists (
+			select 1 from bookings b
+			where b.volunteer_id = sv.user_id and b.status = $2 and b.starts_at < $3 and b.ends_at > $4
+		)
+		order by sv.created_at, sv.user_id`,
+		shiftID,
+		BookedStatus,
+		endsAt,
+		startsAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get free volunteers: %w", err)
+	}
+	return found, nil
+}
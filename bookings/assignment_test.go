@@ -0,0 +1,172 @@
+package bookings
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"scheduler/shifts"
+)
+
+// books calls one after another with the strategy, updating the candidates like the db would, and returns the
+// number of calls each volunteer was assigned. the clock carries on from the candidates' latest call
+func simulate(t *testing.T, strategy Strategy, candidates []*Candidate, calls int, prefs Preferences) map[int]int {
+	t.Helper()
+	now := time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC)
+	for _, c := range candidates {
+		if c.LastAssignedAt != nil && !c.LastAssignedAt.Before(now) {
+			now = c.LastAssignedAt.Add(time.Minute)
+		}
+	}
+	assigned := map[int]int{}
+	for i := 0; i < calls; i++ {
+		chosen, err := strategy.Choose(candidates, prefs)
+		if err != nil {
+			t.Fatalf("call %d: unexpected error: %s", i, err)
+		}
+		at := now
+		chosen.Calls++
+		chosen.LastAssignedAt = &at
+		assigned[chosen.VolunteerID]++
+		now = now.Add(time.Minute)
+	}
+	return assigned
+}
+
+func newCandidates(ids ...int) []*Candidate {
+	candidates := make([]*Candidate, len(ids))
+	for i, id := range ids {
+		candidates[i] = &Candidate{VolunteerID: id}
+	}
+	return candidates
+}
+
+// fails unless every volunteer was assigned a call and no two volunteers' counts differ by more than one
+func checkEven(t *testing.T, assigned map[int]int, ids ...int) {
+	t.Helper()
+	lowest, highest := -1, -1
+	for _, id := range ids {
+		n := assigned[id]
+		if lowest < 0 || n < lowest {
+			lowest = n
+		}
+		if n > highest {
+			highest = n
+		}
+	}
+	if lowest < 1 || highest-lowest > 1 {
+		t.Errorf("expected calls to be spread evenly between %v, got %v", ids, assigned)
+	}
+}
+
+func TestStrategyForEveryAssignment(t *testing.T) {
+	for _, a := range shifts.Assignments {
+		if _, err := StrategyFor(a); err != nil {
+			t.Errorf("no strategy for %s: %s", a, err)
+		}
+	}
+	if _, err := StrategyFor(shifts.UndefinedAssignment); !errors.Is(err, ErrUnknownAssignment) {
+		t.Errorf("expected ErrUnknownAssignment for an undefined assignment, got %v", err)
+	}
+}
+
+func TestRoundRobinTakesTurns(t *testing.T) {
+	candidates := newCandidates(1, 2, 3)
+	var order []int
+	for i := 0; i < 6; i++ {
+		chosen, err := RoundRobin{}.Choose(candidates, Preferences{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := time.Unix(int64(i), 0)
+		chosen.Calls++
+		chosen.LastAssignedAt = &at
+		order = append(order, chosen.VolunteerID)
+	}
+	expected := []int{1, 2, 3, 1, 2, 3}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected volunteers to take turns in sign up order %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestStrategiesAreFair(t *testing.T) {
+	for _, strategy := range []Strategy{RoundRobin{}, LeastLoaded{}, SkillMatch{}, RecruitChoice{}} {
+		assigned := simulate(t, strategy, newCandidates(1, 2, 3, 4, 5), 1000, Preferences{})
+		checkEven(t, assigned, 1, 2, 3, 4, 5)
+	}
+}
+
+func TestLeastLoadedCatchesUpLateJoiner(t *testing.T) {
+	candidates := newCandidates(1, 2, 3)
+	simulate(t, LeastLoaded{}, candidates, 30, Preferences{})
+	candidates = append(candidates, &Candidate{VolunteerID: 4})
+	assigned := simulate(t, LeastLoaded{}, candidates, 10, Preferences{})
+	if assigned[4] != 10 {
+		t.Errorf("expected the volunteer who joined late to get every call until they caught up, got %v", assigned)
+	}
+	simulate(t, LeastLoaded{}, candidates, 400, Preferences{})
+	totals := map[int]int{}
+	for _, c := range candidates {
+		totals[c.VolunteerID] = c.Calls
+	}
+	checkEven(t, totals, 1, 2, 3, 4)
+}
+
+func TestRoundRobinIncludesLateJoiner(t *testing.T) {
+	candidates := newCandidates(1, 2, 3)
+	simulate(t, RoundRobin{}, candidates, 30, Preferences{})
+	candidates = append(candidates, &Candidate{VolunteerID: 4})
+	assigned := simulate(t, RoundRobin{}, candidates, 400, Preferences{})
+	checkEven(t, assigned, 1, 2, 3, 4)
+}
+
+func TestSkillMatchOnlyAssignsMatchingVolunteers(t *testing.T) {
+	candidates := []*Candidate{
+		{VolunteerID: 1, Skills: []string{"spanish"}},
+		{VolunteerID: 2, Skills: []string{"asl", "spanish"}},
+		{VolunteerID: 3},
+		{VolunteerID: 4, Skills: []string{"spanish"}},
+	}
+	assigned := simulate(t, SkillMatch{}, candidates, 300, Preferences{Skills: []string{"Spanish "}})
+	if assigned[3] > 0 {
+		t.Errorf("expected only volunteers who speak spanish to be assigned, got %v", assigned)
+	}
+	checkEven(t, assigned, 1, 2, 4)
+
+	chosen, err := SkillMatch{}.Choose(candidates, Preferences{Skills: []string{"asl", "spanish"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chosen.VolunteerID != 2 {
+		t.Errorf("expected the only volunteer with both skills to be assigned, got %d", chosen.VolunteerID)
+	}
+	if _, err := (SkillMatch{}).Choose(candidates, Preferences{Skills: []string{"french"}}); !errors.Is(err, ErrNoSkillMatch) {
+		t.Errorf("expected ErrNoSkillMatch, got %v", err)
+	}
+}
+
+func TestRecruitChoice(t *testing.T) {
+	candidates := newCandidates(1, 2, 3)
+	for i := 0; i < 5; i++ {
+		chosen, err := RecruitChoice{}.Choose(candidates, Preferences{VolunteerID: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chosen.VolunteerID != 2 {
+			t.Fatalf("expected the chosen volunteer to be assigned, got %d", chosen.VolunteerID)
+		}
+		chosen.Calls++
+	}
+	if _, err := (RecruitChoice{}).Choose(candidates, Preferences{VolunteerID: 7}); !errors.Is(err, ErrChosenVolunteerBusy) {
+		t.Errorf("expected ErrChosenVolunteerBusy, got %v", err)
+	}
+	chosen, err := RecruitChoice{}.Choose(candidates, Preferences{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chosen.VolunteerID == 2 {
+		t.Errorf("expected a volunteer with fewer calls when the recruit didn't choose one")
+	}
+}
@@ -0,0 +1,334 @@
+package bookings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/intake"
+	"scheduler/shifts"
+	"scheduler/utils"
+	"scheduler/webhooks"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// length of the call a recruit books with a volunteer
+const SlotDuration = 15 * time.Minute
+
+// target type used for audit events about bookings
+const auditTarget = "booking"
+
+var (
+	ErrSlotUnavailable = errors.New("no volunteers are available for the requested time")
+	ErrRecruitBusy     = errors.New("recruit already has a call booked at the requested time")
+	ErrVolunteerBusy   = errors.New("volunteer already has a call booked at the same time")
+	ErrCannotRebook    = errors.New("cancelled calls can't be booked again. book a new call instead")
+)
+
+// a call between a recruit and a volunteer during one of the volunteer's shifts
+type Booking struct {
+	ID          int       `json:"id"`
+	ShiftID     int       `json:"shift_id"`
+	RecruitID   int       `json:"recruit_id"`
+	VolunteerID int       `json:"volunteer_id"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Status      Status    `json:"status"`
+	// the recruit's answers to the shift's intake form when they booked
+	Answers []*intake.Answer `json:"answers"`
+	// how the call went. logged by the volunteer after the call, or set to a no-show when they don't within NoShowAfter
+	Outcome      Outcome    `json:"outcome"`
+	OutcomeNotes string     `json:"outcome_notes"`
+	OutcomeAt    *time.Time `json:"outcome_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	// whether the recruit still needs to be told the call was cancelled because its shift was cancelled or moved
+	NotifyRecruit bool `json:"-"`
+}
+
+// books the slot starting at startsAt during the shift for the recruit, assigning one of the volunteers who are free at that time
+// using the shift's assignment strategy. the responses must answer the shift's intake form, if it has one.
+// returns ErrSlotUnavailable when every volunteer on the shift is busy
+func Book(ctx context.Context, shiftID int, recruitID int, startsAt time.Time, prefs Preferences, responses intake.Responses, pool *pgxpool.Pool) (*Booking, error) {
+	booking := Booking{
+		ShiftID:   shiftID,
+		RecruitID: recruitID,
+		StartsAt:  startsAt.UTC(),
+		EndsAt:    startsAt.UTC().Add(SlotDuration),
+		Status:    BookedStatus,
+		Answers:   []*intake.Answer{},
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// lock the shift so concurrent bookings can't assign the same volunteer twice
+		shift, err := shifts.GetShiftForUpdate(ctx, tx, shiftID)
+		if err != nil {
+			return err
+		}
+		if err := validateSlot(shift, booking.StartsAt); err != nil {
+			return err
+		}
+		if booking.Answers, err = answer(ctx, tx, shift, responses); err != nil {
+			return err
+		}
+		var recruitBookings int
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&recruitBookings,
+			"select count(*) from bookings where recruit_id = $1 and status = $2 and starts_at < $3 and ends_at > $4",
+			recruitID,
+			BookedStatus,
+			booking.EndsAt,
+			booking.StartsAt,
+		); err != nil {
+			return fmt.Errorf("failed to check recruit bookings: %w", err)
+		}
+		if recruitBookings > 0 {
+			return ErrRecruitBusy
+		}
+		strategy, err := StrategyFor(shift.Assignment)
+		if err != nil {
+			return err
+		}
+		free, err := candidates(ctx, tx, shiftID, booking.StartsAt, booking.EndsAt)
+		if err != nil {
+			return err
+		}
+		if len(free) < 1 {
+			return ErrSlotUnavailable
+		}
+		chosen, err := strategy.Choose(free, prefs)
+		if err != nil {
+			return err
+		}
+		booking.VolunteerID = chosen.VolunteerID
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&booking,
+			`insert into bookings(shift_id, recruit_id, volunteer_id, starts_at, ends_at, status, answers)
+			values ($1, $2, $3, $4, $5, $6, $7) returning *`,
+			booking.ShiftID,
+			booking.RecruitID,
+			booking.VolunteerID,
+			booking.StartsAt,
+			booking.EndsAt,
+			booking.Status,
+			booking.Answers,
+		); err != nil {
+			return fmt.Errorf("failed to insert booking: %w", err)
+		}
+		if err := audit.Record(ctx, tx, "booking.create", auditTarget, booking.ID, nil, booking); err != nil {
+			return err
+		}
+		if err := updateRecruitStage(ctx, tx, booking.RecruitID); err != nil {
+			return err
+		}
+		return webhooks.Enqueue(ctx, tx, webhooks.BookingCreatedEvent, booking)
+	}); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// checks that the slot is upcoming and lines up with the shift's 15 minute slots
+func validateSlot(shift *shifts.Shift, startsAt time.Time) error {
+	if shift.Status != shifts.ScheduledStatus {
+		return fmt.Errorf("cannot book a call during a %s shift", shift.Status.String())
+	}
+	if startsAt.Before(time.Now()) {
+		return fmt.Errorf("cannot book a call that has already started")
+	}
+	if startsAt.Before(shift.StartsAt) || startsAt.Add(SlotDuration).After(shift.EndsAt) {
+		return fmt.Errorf("requested time is outside of the shift")
+	}
+	if startsAt.Sub(shift.StartsAt)%SlotDuration != 0 {
+		return fmt.Errorf("requested time must start on a %s boundary from the start of the shift", SlotDuration)
+	}
+	return nil
+}
+
+// validates the responses against the shift's intake form. shifts without a form don't take any answers
+func answer(ctx context.Context, tx pgx.Tx, shift *shifts.Shift, responses intake.Responses) ([]*intake.Answer, error) {
+	var form *intake.Form
+	if shift.IntakeFormID != nil {
+		var err error
+		if form, err = intake.GetFormByID(ctx, *shift.IntakeFormID, tx); err != nil {
+			return nil, err
+		}
+	}
+	if form == nil {
+		if len(responses) > 0 {
+			return nil, fmt.Errorf("the shift doesn't have any intake questions to answer")
+		}
+		return []*intake.Answer{}, nil
+	}
+	return form.Answer(responses)
+}
+
+// moves the volunteer's booked calls during the shift to another volunteer. returns ErrVolunteerBusy if the other
+// volunteer has a call at the same time as one of them. the shift must be locked by tx
+func Reassign(ctx context.Context, tx pgx.Tx, shiftID int, fromID int, toID int) ([]*Booking, error) {
+	var conflicts int
+	if err := pgxscan.Get(
+		ctx,
+		tx,
+		&conflicts,
+		`select count(*) from bookings b
+		join bookings o on o.volunteer_id = $3 and o.status = $4 and o.starts_at < b.ends_at and o.ends_at > b.starts_at
+		where b.shift_id = $1 and b.volunteer_id = $2 and b.status = $4`,
+		shiftID,
+		fromID,
+		toID,
+		BookedStatus,
+	); err != nil {
+		return nil, fmt.Errorf("failed to check volunteer bookings: %w", err)
+	}
+	if conflicts > 0 {
+		return nil, ErrVolunteerBusy
+	}
+	var moved []*Booking
+	if err := pgxscan.Select(
+		ctx,
+		tx,
+		&moved,
+		"update bookings set volunteer_id = $1 where shift_id = $2 and volunteer_id = $3 and status = $4 returning *",
+		toID,
+		shiftID,
+		fromID,
+		BookedStatus,
+	); err != nil {
+		return nil, fmt.Errorf("failed to reassign bookings: %w", err)
+	}
+	for _, b := range moved {
+		before := *b
+		before.VolunteerID = fromID
+		if err := audit.Record(ctx, tx, "booking.reassign", auditTarget, b.ID, before, b); err != nil {
+			return nil, err
+		}
+	}
+	return moved, nil
+}
+
+// changes the status of the booking, e.g. to cancel it. returns ErrCannotRebook for cancelled bookings, since their
+// slot or volunteer may have been booked again since
+func (b *Booking) UpdateStatus(ctx context.Context, status Status, pool *pgxpool.Pool) error {
+	if status <= UndefinedStatus || status >= endStatus {
+		return fmt.Errorf("invalid status %d provided", status)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var before Booking
+		if err := pgxscan.Get(ctx, tx, &before, "select * from bookings where id = $1 for update", b.ID); err != nil {
+			if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+				return fmt.Errorf("booking with ID %d not found", b.ID)
+			}
+			return fmt.Errorf("failed to get booking: %w", err)
+		}
+		if before.Status == CancelledStatus && status != CancelledStatus {
+			return ErrCannotRebook
+		}
+		*b = before
+		if _, err := tx.Exec(ctx, "update bookings set status = $1 where id = $2", status, b.ID); err != nil {
+			return fmt.Errorf("failed to update booking: %w", err)
+		}
+		b.Status = status
+		// cancelling the recruit's latest call moves them back to the stage of the one before
+		if err := updateRecruitStage(ctx, tx, b.RecruitID); err != nil {
+			return err
+		}
+		if status != CancelledStatus {
+			return audit.Record(ctx, tx, "booking.update", auditTarget, b.ID, before, b)
+		}
+		if err := audit.Record(ctx, tx, "booking.cancel", auditTarget, b.ID, before, b); err != nil {
+			return err
+		}
+		// cancelling an already cancelled booking isn't worth notifying subscribers about
+		if before.Status == CancelledStatus {
+			return nil
+		}
+		return webhooks.Enqueue(ctx, tx, webhooks.BookingCancelledEvent, b)
+	})
+}
+
+func GetBookingByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Booking, error) {
+	var booking Booking
+	if err := pgxscan.Get(ctx, pool, &booking, "select * from bookings where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get booking: %w", err)
+	}
+	return &booking, nil
+}
+
+// narrows the bookings returned by FindBookings. zero values are ignored
+type Filter struct {
+	ShiftID     int
+	RecruitID   int
+	VolunteerID int
+	// only bookings where the user is either the recruit or the volunteer
+	ParticipantID int
+	Status        Status
+	Outcome       Outcome
+	// only bookings without an outcome logged
+	AwaitingOutcome bool
+	// only bookings ending after From
+	From time.Time
+	// only bookings starting before To
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+func (f Filter) where() *utils.Where {
+	var where utils.Where
+	if f.ShiftID > 0 {
+		where.Add("shift_id = $%d", f.ShiftID)
+	}
+	if f.RecruitID > 0 {
+		where.Add("recruit_id = $%d", f.RecruitID)
+	}
+	if f.VolunteerID > 0 {
+		where.Add("volunteer_id = $%d", f.VolunteerID)
+	}
+	if f.ParticipantID > 0 {
+		// the same placeholder is used twice
+		where.Add("(recruit_id = $%[1]d or volunteer_id = $%[1]d)", f.ParticipantID)
+	}
+	if f.Status != UndefinedStatus {
+		where.Add("status = $%d", f.Status)
+	}
+	if f.Outcome != UndefinedOutcome {
+		where.Add("outcome = $%d", f.Outcome)
+	}
+	if f.AwaitingOutcome {
+		where.Add("outcome = $%d", UndefinedOutcome)
+	}
+	if !f.From.IsZero() {
+		where.Add("ends_at > $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where.Add("starts_at < $%d", f.To)
+	}
+	return &where
+}
+
+// returns a page of bookings matching the filter, ordered by start time, along with the total number of matching bookings
+func FindBookings(ctx context.Context, filter Filter, pool *pgxpool.Pool) ([]*Booking, int, error) {
+	where := filter.where()
+	var total int
+	if err := pgxscan.Get(ctx, pool, &total, "select count(*) from bookings"+where.String(), where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count bookings: %w", err)
+	}
+	query := where.Paginate("select * from bookings"+where.String()+" order by starts_at, id", filter.Limit, filter.Offset)
+	var bookings []*Booking
+	if err := pgxscan.Select(ctx, pool, &bookings, query, where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get bookings from db: %w", err)
+	}
+	return bookings, total, nil
+}
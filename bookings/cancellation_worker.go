@@ -0,0 +1,77 @@
+package bookings
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how often cancelled calls are checked for recruits to notify
+const cancellationPollInterval = time.Minute
+
+// tells recruits their call was cancelled because its shift was cancelled or moved
+type CancellationNotifier interface {
+	NotifyCancelled(ctx context.Context, b *Booking) error
+}
+
+// emails recruits whose calls were cancelled along with their shift. any number of workers can run against the same db
+type CancellationWorker struct {
+	pool     *pgxpool.Pool
+	notifier CancellationNotifier
+}
+
+func NewCancellationWorker(pool *pgxpool.Pool, notifier CancellationNotifier) *CancellationWorker {
+	return &CancellationWorker{
+		pool:     pool,
+		notifier: notifier,
+	}
+}
+
+// runs until ctx is cancelled
+func (w *CancellationWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(cancellationPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.notifyDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to notify recruits of cancelled calls: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claims the cancellations that haven't been sent yet, then sends them once the claim is committed, so slow sends
+// don't hold locks on the calls. a cancellation that fails to send is put back to be tried again next time. a worker
+// stopping mid-send drops the rest of its claim rather than risk emailing recruits twice
+func (w *CancellationWorker) notifyDue(ctx context.Context) error {
+	var due []*Booking
+	if err := pgxscan.Select(
+		ctx,
+		w.pool,
+		&due,
+		`update bookings set notify_recruit = false
+		where id in (select id from bookings where notify_recruit order by id limit 100 for update skip locked)
+		returning *`,
+	); err != nil {
+		return fmt.Errorf("failed to claim cancelled calls: %w", err)
+	}
+	for _, b := range due {
+		// calls that have already happened aren't worth telling anyone about
+		if !b.StartsAt.After(time.Now()) {
+			continue
+		}
+		if err := w.notifier.NotifyCancelled(ctx, b); err != nil {
+			fmt.Println(fmt.Errorf("failed to notify recruit of cancelled call %d: %w", b.ID, err))
+			if _, err := w.pool.Exec(ctx, "update bookings set notify_recruit = true where id = $1", b.ID); err != nil {
+				return fmt.Errorf("failed to put back cancellation notification: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package bookings
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how often calls are checked for missing outcomes
+const noShowPollInterval = time.Minute
+
+// marks calls no-shows when their volunteer hasn't logged an outcome within NoShowAfter of the call ending.
+// any number of workers can run against the same db
+type NoShowWorker struct {
+	pool *pgxpool.Pool
+}
+
+func NewNoShowWorker(pool *pgxpool.Pool) *NoShowWorker {
+	return &NoShowWorker{
+		pool: pool,
+	}
+}
+
+// runs until ctx is cancelled
+func (w *NoShowWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(noShowPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.markDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to mark no-shows: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// marks a batch of calls that are overdue an outcome. calls are locked while they're marked so no other worker
+// or volunteer changes them at the same time
+func (w *NoShowWorker) markDue(ctx context.Context) error {
+	return w.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var due []*Booking
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&due,
+			`select * from bookings
+			where outcome = $1 and status = $2 and ends_at < $3
+			order by ends_at, id limit 100
+			for update skip locked`,
+			UndefinedOutcome,
+			BookedStatus,
+			time.Now().Add(-NoShowAfter),
+		); err != nil {
+			return fmt.Errorf("failed to get calls without outcomes from db: %w", err)
+		}
+		for _, b := range due {
+			before := *b
+			now := time.Now()
+			b.Outcome = NoShowOutcome
+			b.OutcomeAt = &now
+			if err := b.saveOutcome(ctx, tx, before, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
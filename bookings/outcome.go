@@ -0,0 +1,220 @@
+package bookings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/users"
+	"scheduler/webhooks"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how long after a call ends its volunteer has to log an outcome before it's marked a no-show
+const NoShowAfter = 24 * time.Hour
+
+// longest outcome notes accepted
+const MaxOutcomeNotesLength = 5000
+
+var (
+	ErrCallNotStarted = errors.New("outcomes can only be logged once the call has started")
+	ErrCallNotBooked  = errors.New("outcomes can only be logged for booked calls")
+	// wrapped by errors about the outcome or notes provided
+	ErrInvalidOutcome = errors.New("invalid outcome")
+)
+
+// how a call went, as logged by its volunteer
+type Outcome int
+
+const (
+	// the outcome hasn't been logged yet
+	UndefinedOutcome Outcome = iota
+	CompletedOutcome
+	NoShowOutcome
+	FollowUpOutcome
+	// new outcomes should go here so we don't change the int values associated with each outcome
+	endOutcome
+)
+
+// outcomes in the order they're offered in forms
+var Outcomes = []Outcome{CompletedOutcome, FollowUpOutcome, NoShowOutcome}
+
+func (o Outcome) String() string {
+	switch o {
+	case CompletedOutcome:
+		return "completed"
+	case NoShowOutcome:
+		return "no_show"
+	case FollowUpOutcome:
+		return "follow_up"
+	default:
+		return ""
+	}
+}
+
+// describes the outcome for people, e.g. "Follow-up needed"
+func (o Outcome) Label() string {
+	switch o {
+	case CompletedOutcome:
+		return "Completed"
+	case NoShowOutcome:
+		return "No-show"
+	case FollowUpOutcome:
+		return "Follow-up needed"
+	default:
+		return ""
+	}
+}
+
+func (o Outcome) IsValid() bool {
+	return o > UndefinedOutcome && o < endOutcome
+}
+
+// the recruit stage a call with the outcome leaves them in
+func (o Outcome) stage() users.Stage {
+	switch o {
+	case CompletedOutcome:
+		return users.ContactedStage
+	case NoShowOutcome:
+		return users.NoShowStage
+	case FollowUpOutcome:
+		return users.FollowUpStage
+	default:
+		return users.BookedStage
+	}
+}
+
+// calls without an outcome are null
+func (o Outcome) MarshalJSON() ([]byte, error) {
+	if o == UndefinedOutcome {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.String())
+}
+
+func (o *Outcome) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*o = UndefinedOutcome
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("outcome must be a string: %w", err)
+	}
+	outcome, err := ParseOutcome(str)
+	if err != nil {
+		return err
+	}
+	*o = outcome
+	return nil
+}
+
+// parses an outcome from its string representation, e.g. "no_show"
+func ParseOutcome(str string) (Outcome, error) {
+	for o := UndefinedOutcome + 1; o < endOutcome; o++ {
+		if o.String() == str {
+			return o, nil
+		}
+	}
+	return UndefinedOutcome, fmt.Errorf("unknown outcome %q", str)
+}
+
+// webhook payload describing a call's outcome
+type outcomeLogged struct {
+	Booking *Booking `json:"booking"`
+	// whether the call was marked a no-show because its volunteer didn't log an outcome in time
+	Automatic bool `json:"automatic"`
+}
+
+// records how the call went, moving the recruit along the pipeline. outcomes can be changed after they're logged,
+// e.g. when a call was marked a no-show before its volunteer got to it
+func (b *Booking) LogOutcome(ctx context.Context, outcome Outcome, notes string, pool *pgxpool.Pool) error {
+	if !outcome.IsValid() {
+		return fmt.Errorf("%w: unknown outcome %d provided", ErrInvalidOutcome, outcome)
+	}
+	notes = strings.TrimSpace(notes)
+	if len(notes) > MaxOutcomeNotesLength {
+		return fmt.Errorf("%w: notes are limited to %d characters", ErrInvalidOutcome, MaxOutcomeNotesLength)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var before Booking
+		if err := pgxscan.Get(ctx, tx, &before, "select * from bookings where id = $1 for update", b.ID); err != nil {
+			if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+				return fmt.Errorf("booking with ID %d not found", b.ID)
+			}
+			return fmt.Errorf("failed to get booking: %w", err)
+		}
+		if before.Status != BookedStatus {
+			return fmt.Errorf("%w, not %s ones", ErrCallNotBooked, before.Status.String())
+		}
+		if time.Now().Before(before.StartsAt) {
+			return ErrCallNotStarted
+		}
+		*b = before
+		now := time.Now()
+		b.Outcome = outcome
+		b.OutcomeNotes = notes
+		b.OutcomeAt = &now
+		if err := b.saveOutcome(ctx, tx, before, false); err != nil {
+			*b = before
+			return err
+		}
+		return nil
+	})
+}
+
+// saves the booking's outcome, audits it, and updates the recruit's stage. automatic is true for calls marked
+// no-shows because their volunteer didn't log an outcome in time
+func (b *Booking) saveOutcome(ctx context.Context, tx pgx.Tx, before Booking, automatic bool) error {
+	if _, err := tx.Exec(
+		ctx,
+		"update bookings set outcome = $1, outcome_notes = $2, outcome_at = $3 where id = $4",
+		b.Outcome,
+		b.OutcomeNotes,
+		b.OutcomeAt,
+		b.ID,
+	); err != nil {
+		return fmt.Errorf("failed to update booking outcome: %w", err)
+	}
+	action := "booking.outcome"
+	if automatic {
+		action = "booking.no_show"
+	}
+	if err := audit.Record(ctx, tx, action, auditTarget, b.ID, before, b); err != nil {
+		return err
+	}
+	if err := updateRecruitStage(ctx, tx, b.RecruitID); err != nil {
+		return err
+	}
+	return webhooks.Enqueue(ctx, tx, webhooks.BookingOutcomeEvent, outcomeLogged{
+		Booking:   b,
+		Automatic: automatic,
+	})
+}
+
+// sets the recruit's stage from their most recent booked call
+func updateRecruitStage(ctx context.Context, tx pgx.Tx, recruitID int) error {
+	var latest []Outcome
+	if err := pgxscan.Select(
+		ctx,
+		tx,
+		&latest,
+		"select outcome from bookings where recruit_id = $1 and status = $2 order by starts_at desc, id desc limit 1",
+		recruitID,
+		BookedStatus,
+	); err != nil {
+		return fmt.Errorf("failed to get recruit's latest call: %w", err)
+	}
+	stage := users.NewStage
+	if len(latest) > 0 {
+		stage = latest[0].stage()
+	}
+	return users.SetStage(ctx, tx, recruitID, stage)
+}
@@ -0,0 +1,166 @@
+package bookings
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/intake"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how long a recruit has to verify their email before their request lapses. the slot isn't held in the meantime
+const RequestExpiry = 24 * time.Hour
+
+// most unverified requests a recruit can have at once, so the public booking page can't be used to flood an inbox
+const MaxPendingRequests = 3
+
+// target type used for audit events about booking requests
+const requestAuditTarget = "booking_request"
+
+var (
+	ErrRequestExpired   = errors.New("the booking link has expired")
+	ErrRequestConfirmed = errors.New("the booking link has already been used")
+	ErrTooManyRequests  = errors.New("there are already bookings waiting for this email address to be verified")
+)
+
+// a call requested from the public booking page. it's only booked once the recruit follows the link emailed to them
+type Request struct {
+	ID int `json:"id"`
+	// hash of the secret token sent to the recruit. the token itself isn't stored
+	Hash        string           `json:"-"`
+	ShiftID     int              `json:"shift_id"`
+	RecruitID   int              `json:"recruit_id"`
+	StartsAt    time.Time        `json:"starts_at"`
+	Responses   intake.Responses `json:"responses"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	ConfirmedAt *time.Time       `json:"confirmed_at"`
+	BookingID   *int             `json:"booking_id"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// saves a request for the recruit to book a call, returning it along with the secret token for its verification link.
+// returns ErrTooManyRequests when the recruit already has MaxPendingRequests waiting to be verified
+func NewRequest(ctx context.Context, shiftID int, recruitID int, startsAt time.Time, responses intake.Responses, pool *pgxpool.Pool) (*Request, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate booking request token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if responses == nil {
+		responses = intake.Responses{}
+	}
+	req := Request{
+		Hash:      hashRequestToken(token),
+		ShiftID:   shiftID,
+		RecruitID: recruitID,
+		StartsAt:  startsAt.UTC(),
+		Responses: responses,
+		ExpiresAt: time.Now().Add(RequestExpiry),
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// lock the recruit so concurrent requests can't get past the limit
+		if _, err := tx.Exec(ctx, "select id from users where id = $1 for update", recruitID); err != nil {
+			return fmt.Errorf("failed to lock recruit: %w", err)
+		}
+		var pending int
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&pending,
+			"select count(*) from booking_requests where recruit_id = $1 and confirmed_at is null and expires_at > now()",
+			recruitID,
+		); err != nil {
+			return fmt.Errorf("failed to count pending booking requests: %w", err)
+		}
+		if pending >= MaxPendingRequests {
+			return ErrTooManyRequests
+		}
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&req,
+			`insert into booking_requests(hash, shift_id, recruit_id, starts_at, responses, expires_at)
+			values ($1, $2, $3, $4, $5, $6) returning *`,
+			req.Hash,
+			req.ShiftID,
+			req.RecruitID,
+			req.StartsAt,
+			req.Responses,
+			req.ExpiresAt,
+		); err != nil {
+			return fmt.Errorf("failed to insert booking request: %w", err)
+		}
+		return audit.Record(ctx, tx, "booking_request.create", requestAuditTarget, req.ID, nil, req)
+	}); err != nil {
+		return nil, "", err
+	}
+	return &req, token, nil
+}
+
+// returns the request the token was issued for, or nil if it doesn't match any request
+func GetRequestByToken(ctx context.Context, token string, pool *pgxpool.Pool) (*Request, error) {
+	var req Request
+	if err := pgxscan.Get(ctx, pool, &req, "select * from booking_requests where hash = $1", hashRequestToken(token)); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get booking request: %w", err)
+	}
+	return &req, nil
+}
+
+// books the requested call now that the recruit has verified their email. each request can only be confirmed once.
+// if the call can't be booked, e.g. because the slot has been taken since, the request is left unconfirmed so
+// following the link again shows the same error rather than claiming it's been used
+func (r *Request) Confirm(ctx context.Context, pool *pgxpool.Pool) (*Booking, error) {
+	if r.ConfirmedAt != nil {
+		return nil, ErrRequestConfirmed
+	}
+	now := time.Now()
+	if now.After(r.ExpiresAt) || now.After(r.StartsAt) {
+		return nil, ErrRequestExpired
+	}
+	// claim the request first so following the link twice at once can't book two calls
+	tag, err := pool.Exec(ctx, "update booking_requests set confirmed_at = $1 where id = $2 and confirmed_at is null", now, r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm booking request: %w", err)
+	}
+	if tag.RowsAffected() < 1 {
+		return nil, ErrRequestConfirmed
+	}
+	booking, err := Book(ctx, r.ShiftID, r.RecruitID, r.StartsAt, Preferences{}, r.Responses, pool)
+	if err != nil {
+		if _, releaseErr := pool.Exec(ctx, "update booking_requests set confirmed_at = null where id = $1", r.ID); releaseErr != nil {
+			return nil, fmt.Errorf("failed to release booking request after %s: %w", err, releaseErr)
+		}
+		return nil, err
+	}
+	before := *r
+	r.ConfirmedAt = &now
+	r.BookingID = &booking.ID
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "update booking_requests set booking_id = $1 where id = $2", booking.ID, r.ID); err != nil {
+			return fmt.Errorf("failed to update booking request: %w", err)
+		}
+		return audit.Record(ctx, tx, "booking_request.confirm", requestAuditTarget, r.ID, before, r)
+	}); err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+func hashRequestToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package bookings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/shifts"
+	"scheduler/webhooks"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrVolunteerHasCalls = errors.New("volunteer has calls booked during the shift. request coverage instead, so whoever covers the shift takes the calls")
+
+// keeps calls in line with their shifts. implements shifts.BookingsHook, and is passed to shifts.SetBookingsHook
+// when the server starts
+type ShiftHook struct{}
+
+// volunteers can't leave a shift with upcoming calls, since nobody would be there to take them
+func (ShiftHook) CheckLeave(ctx context.Context, tx pgx.Tx, shift *shifts.Shift, userID int) error {
+	var calls int
+	if err := pgxscan.Get(
+		ctx,
+		tx,
+		&calls,
+		"select count(*) from bookings where shift_id = $1 and volunteer_id = $2 and status = $3 and starts_at > $4",
+		shift.ID,
+		userID,
+		BookedStatus,
+		time.Now(),
+	); err != nil {
+		return fmt.Errorf("failed to check volunteer bookings: %w", err)
+	}
+	if calls > 0 {
+		return ErrVolunteerHasCalls
+	}
+	return nil
+}
+
+// cancels the shift's upcoming calls when it's cancelled, or the ones it no longer covers when it's moved.
+// their recruits are emailed by the CancellationWorker
+func (ShiftHook) ShiftChanged(ctx context.Context, tx pgx.Tx, shift *shifts.Shift) error {
+	var cancelled []*Booking
+	if err := pgxscan.Select(
+		ctx,
+		tx,
+		&cancelled,
+		`update bookings set status = $1, notify_recruit = true
+		where shift_id = $2 and status = $3 and starts_at > $4 and ($5 or starts_at < $6 or ends_at > $7)
+		returning *`,
+		CancelledStatus,
+		shift.ID,
+		BookedStatus,
+		time.Now(),
+		shift.Status != shifts.ScheduledStatus,
+		shift.StartsAt,
+		shift.EndsAt,
+	); err != nil {
+		return fmt.Errorf("failed to cancel shift bookings: %w", err)
+	}
+	for _, b := range cancelled {
+		before := *b
+		before.Status = BookedStatus
+		before.NotifyRecruit = false
+		if err := audit.Record(ctx, tx, "booking.cancel", auditTarget, b.ID, before, b); err != nil {
+			return err
+		}
+		if err := updateRecruitStage(ctx, tx, b.RecruitID); err != nil {
+			return err
+		}
+		if err := webhooks.Enqueue(ctx, tx, webhooks.BookingCancelledEvent, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package bookings
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"scheduler/shifts"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// a bookable time during a shift
+type Slot struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// number of volunteers on the shift who are free during the slot
+	Available int `json:"available"`
+}
+
+// returns every slot during the shift, including those with no available volunteers.
+// shifts that aren't scheduled have no slots
+func Slots(ctx context.Context, shift *shifts.Shift, pool *pgxpool.Pool) ([]Slot, error) {
+	slots := []Slot{}
+	if shift.Status != shifts.ScheduledStatus {
+		return slots, nil
+	}
+	volunteerIDs, err := shifts.VolunteerIDs(ctx, pool, shift.ID)
+	if err != nil {
+		return nil, err
+	}
+	// bookings held by the shift's volunteers that overlap the shift, wherever they were booked
+	var booked []struct {
+		VolunteerID int
+		StartsAt    time.Time
+		EndsAt      time.Time
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&booked,
+		`select volunteer_id, starts_at, ends_at from bookings
+		where volunteer_id = any($1) and status = $2 and starts_at < $3 and ends_at > $4`,
+		volunteerIDs,
+		BookedStatus,
+		shift.EndsAt,
+		shift.StartsAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get shift bookings: %w", err)
+	}
+	for start := shift.StartsAt; !start.Add(SlotDuration).After(shift.EndsAt); start = start.Add(SlotDuration) {
+		end := start.Add(SlotDuration)
+		busy := map[int]bool{}
+		for _, b := range booked {
+			if b.StartsAt.Before(end) && b.EndsAt.After(start) {
+				busy[b.VolunteerID] = true
+			}
+		}
+		slots = append(slots, Slot{
+			StartsAt:  start,
+			EndsAt:    end,
+			Available: len(volunteerIDs) - len(busy),
+		})
+	}
+	return slots, nil
+}
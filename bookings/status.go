@@ -0,0 +1,54 @@
+package bookings
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Status int
+
+const (
+	UndefinedStatus Status = iota
+	BookedStatus
+	CancelledStatus
+	// new statuses should go here so we don't change the int values associated with each status
+	endStatus
+)
+
+func (s Status) String() string {
+	switch s {
+	case BookedStatus:
+		return "booked"
+	case CancelledStatus:
+		return "cancelled"
+	default:
+		return ""
+	}
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("status must be a string: %w", err)
+	}
+	status, err := ParseStatus(str)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// parses a status from its string representation, e.g. "booked"
+func ParseStatus(str string) (Status, error) {
+	for s := UndefinedStatus + 1; s < endStatus; s++ {
+		if s.String() == str {
+			return s, nil
+		}
+	}
+	return UndefinedStatus, fmt.Errorf("unknown status %q", str)
+}
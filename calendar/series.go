@@ -0,0 +1,105 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"scheduler/shifts"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// keeps each shift series in sync with a recurring event on a Google calendar. implements shifts.SeriesSyncer
+type SeriesSyncer struct {
+	svc        *Service
+	calendarID string
+}
+
+func NewSeriesSyncer(svc *Service, calendarID string) *SeriesSyncer {
+	return &SeriesSyncer{
+		svc:        svc,
+		calendarID: calendarID,
+	}
+}
+
+// creates or updates the series' recurring event, then applies each overridden occurrence to the matching instance of the event.
+// a stopped series' event is deleted
+func (s *SeriesSyncer) SyncSeries(ctx context.Context, series *shifts.Series, overrides []*shifts.Shift) (string, error) {
+	if series.Status == shifts.CancelledStatus {
+		if series.GoogleEventID == nil {
+			return "", nil
+		}
+		if err := s.svc.Events.Delete(s.calendarID, *series.GoogleEventID).Context(ctx).Do(); err != nil && !isGone(err) {
+			return "", fmt.Errorf("failed to delete event: %w", err)
+		}
+		return "", nil
+	}
+
+	event := &calendar.Event{
+		Summary:    series.Title,
+		Start:      s.dateTime(series.StartsAt, series.TimeZone),
+		End:        s.dateTime(series.EndsAt, series.TimeZone),
+		Recurrence: series.Recurrence(),
+	}
+	var saved *calendar.Event
+	var err error
+	if series.GoogleEventID != nil {
+		saved, err = s.svc.Events.Update(s.calendarID, *series.GoogleEventID, event).Context(ctx).Do()
+		if isGone(err) {
+			// deleted on the calendar, so put it back
+			saved, err = s.svc.Events.Insert(s.calendarID, event).Context(ctx).Do()
+		}
+	} else {
+		saved, err = s.svc.Events.Insert(s.calendarID, event).Context(ctx).Do()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save event: %w", err)
+	}
+
+	for _, shift := range overrides {
+		if shift.OccurrenceAt == nil || series.IsExcluded(*shift.OccurrenceAt) {
+			continue
+		}
+		instances, err := s.svc.Events.Instances(s.calendarID, saved.Id).
+			OriginalStart(shift.OccurrenceAt.Format(time.RFC3339)).
+			ShowDeleted(true).
+			Context(ctx).
+			Do()
+		if err != nil {
+			return saved.Id, fmt.Errorf("failed to get instance of event for shift %d: %w", shift.ID, err)
+		}
+		if len(instances.Items) < 1 {
+			// the occurrence no longer fits the series' rule
+			continue
+		}
+		instance := instances.Items[0]
+		instance.Summary = shift.Title
+		instance.Start = s.dateTime(shift.StartsAt, series.TimeZone)
+		instance.End = s.dateTime(shift.EndsAt, series.TimeZone)
+		instance.Status = "confirmed"
+		if shift.Status == shifts.CancelledStatus {
+			instance.Status = "cancelled"
+		}
+		if _, err := s.svc.Events.Update(s.calendarID, instance.Id, instance).Context(ctx).Do(); err != nil {
+			return saved.Id, fmt.Errorf("failed to update instance of event for shift %d: %w", shift.ID, err)
+		}
+	}
+	return saved.Id, nil
+}
+
+func (s *SeriesSyncer) dateTime(t time.Time, timeZone string) *calendar.EventDateTime {
+	return &calendar.EventDateTime{
+		DateTime: t.Format(time.RFC3339),
+		TimeZone: timeZone,
+	}
+}
+
+// reports whether the error is the calendar API saying the event doesn't exist
+func isGone(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && (apiErr.Code == http.StatusNotFound || apiErr.Code == http.StatusGone)
+}
@@ -3,51 +3,300 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
 
-	"scheduler/stytch"
+	"scheduler/auth"
 	"scheduler/users"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/stytchauth/stytch-go/v5/stytch/config"
 )
 
-func Init(ctx context.Context, withDrop bool, isProd bool, adminName string, adminEmail string, dbConn *pgx.Conn) error {
+type table struct {
+	name   string
+	schema string
+}
+
+// tables are created in order, and dropped in reverse order
+var tables = []table{
+	{
+		name: "users",
+		schema: `create table users (
+			id serial primary key,
+			name text null,
+			email text not null,
+			stytch_id text not null,
+			status int not null,
+			type int not null,
+			time_zone text not null default '',
+			skills text[] not null default '{}',
+			stage int not null default 1
+		);
+		-- emails are matched case-insensitively, so addresses differing only in case would be the same user
+		create unique index users_email on users (lower(email))`,
+	},
+	{
+		name: "user_roles",
+		schema: `create table user_roles (
+			user_id int not null references users(id) on delete cascade,
+			role int not null,
+			primary key (user_id, role)
+		)`,
+	},
+	{
+		name: "audit_events",
+		schema: `create table audit_events (
+			id serial primary key,
+			actor_id int null references users(id),
+			action text not null,
+			target_type text not null,
+			target_id int not null,
+			before jsonb null,
+			after jsonb null,
+			created_at timestamptz not null default now()
+		);
+		-- the audit log is append only, so nobody can cover their tracks by editing it
+		create or replace function audit_events_append_only() returns trigger as $$
+		begin
+			raise exception 'audit events can''t be changed or deleted';
+		end;
+		$$ language plpgsql;
+		create trigger audit_events_append_only before update or delete on audit_events
+			for each row execute function audit_events_append_only()`,
+	},
+	{
+		name: "intake_forms",
+		schema: `create table intake_forms (
+			id serial primary key,
+			name text not null,
+			description text not null default '',
+			fields jsonb not null default '[]',
+			created_at timestamptz not null default now(),
+			updated_at timestamptz not null default now()
+		)`,
+	},
+	{
+		name: "shift_series",
+		schema: `create table shift_series (
+			id serial primary key,
+			title text not null,
+			starts_at timestamptz not null,
+			ends_at timestamptz not null,
+			time_zone text not null,
+			capacity int not null default 0,
+			assignment int not null default 1,
+			intake_form_id int null references intake_forms(id) on delete set null,
+			public_booking boolean not null default false,
+			rrule text not null,
+			exdates timestamptz[] not null default '{}',
+			status int not null,
+			expanded_until timestamptz null,
+			google_event_id text null,
+			created_at timestamptz not null default now(),
+			updated_at timestamptz not null default now(),
+			synced_at timestamptz null
+		)`,
+	},
+	{
+		name: "shifts",
+		schema: `create table shifts (
+			id serial primary key,
+			title text not null,
+			starts_at timestamptz not null,
+			ends_at timestamptz not null,
+			capacity int not null default 0,
+			assignment int not null default 1,
+			intake_form_id int null references intake_forms(id) on delete set null,
+			status int not null,
+			series_id int null references shift_series(id) on delete set null,
+			occurrence_at timestamptz null,
+			overridden boolean not null default false,
+			unique (series_id, occurrence_at)
+		)`,
+	},
+	{
+		name: "shift_volunteers",
+		schema: `create table shift_volunteers (
+			shift_id int not null references shifts(id) on delete cascade,
+			user_id int not null references users(id) on delete cascade,
+			created_at timestamptz not null default now(),
+			primary key (shift_id, user_id)
+		)`,
+	},
+	{
+		name: "shift_waitlist",
+		schema: `create table shift_waitlist (
+			shift_id int not null references shifts(id) on delete cascade,
+			user_id int not null references users(id) on delete cascade,
+			created_at timestamptz not null default now(),
+			offered_at timestamptz null,
+			offer_expires_at timestamptz null,
+			notified_at timestamptz null,
+			primary key (shift_id, user_id)
+		)`,
+	},
+	{
+		name: "coverage_requests",
+		schema: `create table coverage_requests (
+			id serial primary key,
+			shift_id int not null references shifts(id) on delete cascade,
+			requester_id int not null references users(id) on delete cascade,
+			accepted_by int null references users(id) on delete set null,
+			note text not null default '',
+			status int not null,
+			requires_approval boolean not null default false,
+			created_at timestamptz not null default now(),
+			resolved_at timestamptz null,
+			notified_at timestamptz null
+		);
+		create index coverage_requests_shift on coverage_requests (shift_id)`,
+	},
+	{
+		name: "bookings",
+		schema: `create table bookings (
+			id serial primary key,
+			shift_id int not null references shifts(id) on delete cascade,
+			recruit_id int not null references users(id),
+			volunteer_id int not null references users(id),
+			starts_at timestamptz not null,
+			ends_at timestamptz not null,
+			status int not null,
+			answers jsonb not null default '[]',
+			outcome int not null default 0,
+			outcome_notes text not null default '',
+			outcome_at timestamptz null,
+			created_at timestamptz not null default now(),
+			notify_recruit boolean not null default false
+		);
+		create index bookings_awaiting_outcome on bookings (ends_at) where outcome = 0;
+		create index bookings_notify_recruit on bookings (id) where notify_recruit`,
+	},
+	{
+		name: "booking_requests",
+		schema: `create table booking_requests (
+			id serial primary key,
+			hash text not null unique,
+			shift_id int not null references shifts(id) on delete cascade,
+			recruit_id int not null references users(id) on delete cascade,
+			starts_at timestamptz not null,
+			responses jsonb not null default '{}',
+			expires_at timestamptz not null,
+			confirmed_at timestamptz null,
+			booking_id int null references bookings(id) on delete set null,
+			created_at timestamptz not null default now()
+		)`,
+	},
+	{
+		name: "api_tokens",
+		schema: `create table api_tokens (
+			id serial primary key,
+			user_id int not null references users(id) on delete cascade,
+			name text not null,
+			prefix text not null,
+			hash text not null unique,
+			scopes text[] not null,
+			created_at timestamptz not null default now(),
+			last_used_at timestamptz null,
+			revoked_at timestamptz null
+		)`,
+	},
+	{
+		name: "webhook_subscriptions",
+		schema: `create table webhook_subscriptions (
+			id serial primary key,
+			url text not null,
+			secret text not null,
+			events text[] not null,
+			active bool not null default true,
+			created_at timestamptz not null default now()
+		)`,
+	},
+	{
+		name: "webhook_deliveries",
+		schema: `create table webhook_deliveries (
+			id serial primary key,
+			subscription_id int not null references webhook_subscriptions(id) on delete cascade,
+			event text not null,
+			payload text not null,
+			status int not null,
+			attempts int not null default 0,
+			next_attempt_at timestamptz not null default now(),
+			last_response_code int null,
+			last_error text not null default '',
+			created_at timestamptz not null default now(),
+			delivered_at timestamptz null
+		);
+		create index webhook_deliveries_due on webhook_deliveries (status, next_attempt_at)`,
+	},
+	{
+		name: "embed_origins",
+		schema: `create table embed_origins (
+			id serial primary key,
+			origin text not null unique,
+			created_at timestamptz not null default now()
+		)`,
+	},
+	{
+		name: "user_imports",
+		schema: `create table user_imports (
+			id serial primary key,
+			created_by int not null references users(id),
+			filename text not null,
+			status int not null,
+			rows jsonb not null,
+			created_at timestamptz not null default now(),
+			started_at timestamptz null,
+			finished_at timestamptz null
+		)`,
+	},
+	{
+		name: "calendar_feeds",
+		schema: `create table calendar_feeds (
+			user_id int primary key references users(id) on delete cascade,
+			hash text not null unique,
+			created_at timestamptz not null default now()
+		)`,
+	},
+	{
+		name: "availability_windows",
+		schema: `create table availability_windows (
+			id serial primary key,
+			user_id int not null references users(id) on delete cascade,
+			weekday int not null check (weekday between 0 and 6),
+			start_minute int not null,
+			end_minute int not null,
+			check (start_minute >= 0 and end_minute <= 1440 and end_minute > start_minute)
+		);
+		create index availability_windows_user on availability_windows (user_id)`,
+	},
+	{
+		name: "blackout_dates",
+		schema: `create table blackout_dates (
+			user_id int not null references users(id) on delete cascade,
+			date date not null,
+			primary key (user_id, date)
+		)`,
+	},
+}
+
+func Init(ctx context.Context, withDrop bool, authClient auth.AuthProvider, adminName string, adminEmail string, dbConn *pgx.Conn) error {
 	if withDrop {
 		// TODO: delete existing calendars?
-		if _, err := dbConn.Exec(ctx, "drop table users cascade"); err != nil {
-			fmt.Println(fmt.Errorf("failed to drop tables: %w", err))
-			// not aborting on error dropping table - table may not exist
+		for i := len(tables) - 1; i >= 0; i-- {
+			if _, err := dbConn.Exec(ctx, fmt.Sprintf("drop table %s cascade", tables[i].name)); err != nil {
+				fmt.Println(fmt.Errorf("failed to drop table %s: %w", tables[i].name, err))
+				// not aborting on error dropping table - table may not exist
+			}
 		}
 	}
-	if _, err := dbConn.Exec(ctx, `create table users (
-		id serial primary key,
-		name text null,
-		email text not null,
-		stytch_id text not null,
-		status int not null,
-		type int not null
-	)`); err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
+	for _, t := range tables {
+		if _, err := dbConn.Exec(ctx, t.schema); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", t.name, err)
+		}
 	}
 
-	cfg := config.EnvTest
-	if isProd {
-		cfg = config.EnvLive
-	}
-	// TODO: pass either the client or the client ID & secret to Init in order to remove the os.Getenv calls
-	client, err := stytch.NewClient(
-		cfg,
-		os.Getenv("STYTCH_CLIENT_ID"),
-		os.Getenv("STYTCH_SECRET"),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create new stytch client: %w", err)
-	}
 	// add initial admin user
-	stytchID, err := client.CreateUser(adminEmail)
+	stytchID, err := authClient.CreateUser(adminEmail)
 	if err != nil {
-		return fmt.Errorf("failed to create stytch user: %w", err)
+		return fmt.Errorf("failed to create auth user: %w", err)
 	}
 
 	if _, err := dbConn.Exec(
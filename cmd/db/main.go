@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 
+	"scheduler/auth"
+
 	"github.com/jackc/pgx/v4"
 	"github.com/joho/godotenv"
 )
@@ -35,16 +37,27 @@ func main() {
 		// initialize db
 		isProd, err := strconv.ParseBool(os.Getenv("PROD"))
 		if err != nil {
-			fmt.Printf("failed to parse PROD env variable as bool: %s\ndefaulting to false\n", err.Error())
-			isProd = false
+			log.Fatalf("failed to parse PROD env variable as bool: %s", err.Error())
 		}
+		allowDevAuth, _ := strconv.ParseBool(os.Getenv("ALLOW_DEV_AUTH"))
 		adminName := os.Getenv("ADMIN_NAME")
 		adminEmail := os.Getenv("ADMIN_EMAIL")
 		e, err := mail.ParseAddress(fmt.Sprintf("%s <%s>", adminName, adminEmail))
 		if err != nil {
 			log.Fatalf("failed to parse admin email address: %s", err.Error())
 		}
-		if err := Init(ctx, *drop, isProd, e.Name, e.Address, conn); err != nil {
+		authClient, err := auth.NewProvider(auth.Config{
+			Provider:        os.Getenv("AUTH_PROVIDER"),
+			IsProd:          isProd,
+			AllowDev:        allowDevAuth,
+			StytchProjectID: os.Getenv("STYTCH_CLIENT_ID"),
+			StytchSecret:    os.Getenv("STYTCH_SECRET"),
+			DevSecret:       os.Getenv("DEV_AUTH_SECRET"),
+		})
+		if err != nil {
+			log.Fatalf("failed to create auth provider: %s", err.Error())
+		}
+		if err := Init(ctx, *drop, authClient, e.Name, e.Address, conn); err != nil {
 			log.Fatalf("failed to initialize db: %s", err.Error())
 		}
 	} else {
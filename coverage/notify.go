@@ -0,0 +1,142 @@
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"scheduler/availability"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how often new requests are checked for volunteers to notify
+const pollInterval = time.Minute
+
+// tells volunteers who could cover a shift that coverage has been requested
+type Notifier interface {
+	NotifyCoverageNeeded(ctx context.Context, r *Request, shift *shifts.Shift, volunteers []*users.User) error
+}
+
+// returns the active volunteers who could cover the shift: those who aren't on it or an overlapping shift, haven't
+// blacked out the day, and are available according to their weekly availability. volunteers who haven't set their
+// weekly availability are included, as are users of other types who've been granted the volunteer role
+func EligibleVolunteers(ctx context.Context, shift *shifts.Shift, pool *pgxpool.Pool) ([]*users.User, error) {
+	var candidates []*users.User
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&candidates,
+		`select u.* from users u
+		where (u.type = $1 or exists (select 1 from user_roles r where r.user_id = u.id and r.role = $1))
+		and u.status = $2 and not exists (
+			select 1 from shift_volunteers sv
+			join shifts s on s.id = sv.shift_id
+			where sv.user_id = u.id and s.status = $3 and s.starts_at < $4 and s.ends_at > $5
+		)
+		order by u.id`,
+		users.VolunteerType,
+		users.ActiveStatus,
+		shifts.ScheduledStatus,
+		shift.EndsAt,
+		shift.StartsAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get volunteers from db: %w", err)
+	}
+	ids := make([]int, len(candidates))
+	for i, u := range candidates {
+		ids[i] = u.ID
+	}
+	byUser, err := availability.GetForUsers(ctx, ids, shift.StartsAt, pool)
+	if err != nil {
+		return nil, err
+	}
+	var eligible []*users.User
+	for _, u := range candidates {
+		a := byUser[u.ID]
+		if len(a.Windows) > 0 && !a.Covers(shift.StartsAt, shift.EndsAt) {
+			continue
+		}
+		if a.IsBlackedOut(shift.StartsAt) || a.IsBlackedOut(shift.EndsAt) {
+			continue
+		}
+		eligible = append(eligible, u)
+	}
+	return eligible, nil
+}
+
+// notifies eligible volunteers about new requests. any number of workers can run against the same db
+type Worker struct {
+	pool     *pgxpool.Pool
+	notifier Notifier
+}
+
+func NewWorker(pool *pgxpool.Pool, notifier Notifier) *Worker {
+	return &Worker{
+		pool:     pool,
+		notifier: notifier,
+	}
+}
+
+// runs until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.notifyDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to notify volunteers of coverage requests: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifies volunteers about each open request that hasn't been sent yet. requests are locked while they're sent
+// so no other worker sends them too. a request that fails to send is tried again next time
+func (w *Worker) notifyDue(ctx context.Context) error {
+	return w.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var due []*Request
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&due,
+			`select r.* from coverage_requests r
+			join shifts s on s.id = r.shift_id
+			where r.notified_at is null and r.status = $1 and s.status = $2 and s.starts_at > $3
+			order by r.id limit 100
+			for update of r skip locked`,
+			OpenStatus,
+			shifts.ScheduledStatus,
+			time.Now(),
+		); err != nil {
+			return fmt.Errorf("failed to get coverage requests from db: %w", err)
+		}
+		for _, r := range due {
+			shift, err := shifts.GetShiftByID(ctx, r.ShiftID, w.pool)
+			if err != nil {
+				return err
+			}
+			volunteers, err := EligibleVolunteers(ctx, shift, w.pool)
+			if err != nil {
+				return err
+			}
+			if len(volunteers) > 0 {
+				if err := w.notifier.NotifyCoverageNeeded(ctx, r, shift, volunteers); err != nil {
+					fmt.Println(fmt.Errorf("failed to notify volunteers of coverage request %d: %w", r.ID, err))
+					continue
+				}
+			}
+			if _, err := tx.Exec(ctx, "update coverage_requests set notified_at = $1 where id = $2", time.Now(), r.ID); err != nil {
+				return fmt.Errorf("failed to save coverage notification: %w", err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,301 @@
+package coverage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/bookings"
+	"scheduler/shifts"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about coverage requests
+const auditTarget = "coverage_request"
+
+var (
+	ErrNotOpen          = errors.New("coverage request is no longer open")
+	ErrNotPending       = errors.New("coverage request isn't waiting for approval")
+	ErrAlreadyRequested = errors.New("coverage has already been requested for the shift")
+	ErrOwnRequest       = errors.New("volunteers can't cover their own shifts")
+	ErrVolunteerBusy    = errors.New("volunteer is already on a shift at that time")
+)
+
+// a volunteer asking for someone to take over their spot on a shift. the volunteer who accepts gets the spot
+// along with the requester's booked calls during the shift
+type Request struct {
+	ID          int `json:"id"`
+	ShiftID     int `json:"shift_id"`
+	RequesterID int `json:"requester_id"`
+	// the volunteer who accepted the request. nil while it's open
+	AcceptedBy *int   `json:"accepted_by"`
+	Note       string `json:"note"`
+	Status     Status `json:"status"`
+	// whether an admin has to approve the transfer once a volunteer accepts
+	RequiresApproval bool      `json:"requires_approval"`
+	CreatedAt        time.Time `json:"created_at"`
+	// when the request was covered or cancelled
+	ResolvedAt *time.Time `json:"resolved_at"`
+	// when eligible volunteers were emailed about the request
+	NotifiedAt *time.Time `json:"-"`
+}
+
+// asks for another volunteer to cover the requester's spot on the shift
+func Open(ctx context.Context, shiftID int, requesterID int, note string, requiresApproval bool, pool *pgxpool.Pool) (*Request, error) {
+	r := Request{
+		ShiftID:          shiftID,
+		RequesterID:      requesterID,
+		Note:             strings.TrimSpace(note),
+		Status:           OpenStatus,
+		RequiresApproval: requiresApproval,
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		shift, err := shifts.GetShiftForUpdate(ctx, tx, shiftID)
+		if err != nil {
+			return err
+		}
+		if err := checkUpcoming(shift); err != nil {
+			return err
+		}
+		ids, err := shifts.VolunteerIDs(ctx, tx, shiftID)
+		if err != nil {
+			return err
+		}
+		if !contains(ids, requesterID) {
+			return shifts.ErrNotOnShift
+		}
+		var existing int
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&existing,
+			"select count(*) from coverage_requests where shift_id = $1 and requester_id = $2 and status in ($3, $4)",
+			shiftID,
+			requesterID,
+			OpenStatus,
+			PendingApprovalStatus,
+		); err != nil {
+			return fmt.Errorf("failed to check coverage requests: %w", err)
+		}
+		if existing > 0 {
+			return ErrAlreadyRequested
+		}
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&r,
+			`insert into coverage_requests(shift_id, requester_id, note, status, requires_approval)
+			values ($1, $2, $3, $4, $5) returning *`,
+			r.ShiftID,
+			r.RequesterID,
+			r.Note,
+			r.Status,
+			r.RequiresApproval,
+		); err != nil {
+			return fmt.Errorf("failed to insert coverage request: %w", err)
+		}
+		return audit.Record(ctx, tx, "coverage.request", auditTarget, r.ID, nil, r)
+	}); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// accepts the request on behalf of the volunteer. unless the request requires approval, the volunteer takes over
+// the requester's spot on the shift and their booked calls straight away
+func (r *Request) Accept(ctx context.Context, volunteerID int, pool *pgxpool.Pool) error {
+	return r.change(ctx, pool, "coverage.accept", func(tx pgx.Tx, shift *shifts.Shift) error {
+		if r.Status != OpenStatus {
+			return ErrNotOpen
+		}
+		if volunteerID == r.RequesterID {
+			return ErrOwnRequest
+		}
+		if err := checkUpcoming(shift); err != nil {
+			return err
+		}
+		if err := checkFree(ctx, tx, shift, volunteerID); err != nil {
+			return err
+		}
+		r.AcceptedBy = &volunteerID
+		if r.RequiresApproval {
+			r.Status = PendingApprovalStatus
+			return nil
+		}
+		return r.transfer(ctx, tx, shift)
+	})
+}
+
+// transfers the shift to the volunteer who accepted the request
+func (r *Request) Approve(ctx context.Context, pool *pgxpool.Pool) error {
+	return r.change(ctx, pool, "coverage.approve", func(tx pgx.Tx, shift *shifts.Shift) error {
+		if r.Status != PendingApprovalStatus || r.AcceptedBy == nil {
+			return ErrNotPending
+		}
+		if err := checkUpcoming(shift); err != nil {
+			return err
+		}
+		// the volunteer may have signed up for something else while waiting
+		if err := checkFree(ctx, tx, shift, *r.AcceptedBy); err != nil {
+			return err
+		}
+		return r.transfer(ctx, tx, shift)
+	})
+}
+
+// turns down the volunteer who accepted the request, opening it up for someone else
+func (r *Request) Reject(ctx context.Context, pool *pgxpool.Pool) error {
+	return r.change(ctx, pool, "coverage.reject", func(tx pgx.Tx, shift *shifts.Shift) error {
+		if r.Status != PendingApprovalStatus {
+			return ErrNotPending
+		}
+		r.Status = OpenStatus
+		r.AcceptedBy = nil
+		return nil
+	})
+}
+
+// withdraws the request. the requester keeps their spot on the shift
+func (r *Request) Cancel(ctx context.Context, pool *pgxpool.Pool) error {
+	return r.change(ctx, pool, "coverage.cancel", func(tx pgx.Tx, shift *shifts.Shift) error {
+		if r.Status != OpenStatus && r.Status != PendingApprovalStatus {
+			return ErrNotOpen
+		}
+		now := time.Now()
+		r.Status = CancelledStatus
+		r.ResolvedAt = &now
+		return nil
+	})
+}
+
+// locks the request's shift and the request itself, reloads the request, applies fn to it, then saves and audits it.
+// locking the shift first serializes the change with sign ups, bookings and other requests for the shift
+func (r *Request) change(ctx context.Context, pool *pgxpool.Pool, action string, fn func(tx pgx.Tx, shift *shifts.Shift) error) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		shift, err := shifts.GetShiftForUpdate(ctx, tx, r.ShiftID)
+		if err != nil {
+			return err
+		}
+		var before Request
+		if err := pgxscan.Get(ctx, tx, &before, "select * from coverage_requests where id = $1 for update", r.ID); err != nil {
+			if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+				return fmt.Errorf("coverage request with ID %d not found", r.ID)
+			}
+			return fmt.Errorf("failed to get coverage request: %w", err)
+		}
+		*r = before
+		if err := fn(tx, shift); err != nil {
+			*r = before
+			return err
+		}
+		if _, err := tx.Exec(
+			ctx,
+			"update coverage_requests set accepted_by = $1, status = $2, resolved_at = $3 where id = $4",
+			r.AcceptedBy,
+			r.Status,
+			r.ResolvedAt,
+			r.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update coverage request: %w", err)
+		}
+		return audit.Record(ctx, tx, action, auditTarget, r.ID, before, r)
+	})
+}
+
+// moves the requester's spot and booked calls to the accepting volunteer
+func (r *Request) transfer(ctx context.Context, tx pgx.Tx, shift *shifts.Shift) error {
+	if err := shifts.TransferVolunteer(ctx, tx, shift, r.RequesterID, *r.AcceptedBy); err != nil {
+		return err
+	}
+	if _, err := bookings.Reassign(ctx, tx, shift.ID, r.RequesterID, *r.AcceptedBy); err != nil {
+		return err
+	}
+	now := time.Now()
+	r.Status = CoveredStatus
+	r.ResolvedAt = &now
+	return nil
+}
+
+func checkUpcoming(shift *shifts.Shift) error {
+	if shift.Status != shifts.ScheduledStatus {
+		return fmt.Errorf("cannot cover a %s shift", shift.Status.String())
+	}
+	if !time.Now().Before(shift.StartsAt) {
+		return fmt.Errorf("cannot cover a shift that has started")
+	}
+	return nil
+}
+
+// returns ErrVolunteerBusy if the volunteer is on the shift or another one overlapping it
+func checkFree(ctx context.Context, tx pgx.Tx, shift *shifts.Shift, userID int) error {
+	// lock the volunteer so they can't cover two overlapping shifts at once, since each request only locks its own shift
+	if _, err := tx.Exec(ctx, "select id from users where id = $1 for update", userID); err != nil {
+		return fmt.Errorf("failed to lock volunteer: %w", err)
+	}
+	var overlapping int
+	if err := pgxscan.Get(
+		ctx,
+		tx,
+		&overlapping,
+		`select count(*) from shift_volunteers sv
+		join shifts s on s.id = sv.shift_id
+		where sv.user_id = $1 and s.status = $2 and s.starts_at < $3 and s.ends_at > $4`,
+		userID,
+		shifts.ScheduledStatus,
+		shift.EndsAt,
+		shift.StartsAt,
+	); err != nil {
+		return fmt.Errorf("failed to check volunteer shifts: %w", err)
+	}
+	if overlapping > 0 {
+		return ErrVolunteerBusy
+	}
+	return nil
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func GetRequestByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Request, error) {
+	var r Request
+	if err := pgxscan.Get(ctx, pool, &r, "select * from coverage_requests where id = $1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get coverage request: %w", err)
+	}
+	return &r, nil
+}
+
+// returns the open and pending requests for upcoming shifts, soonest shift first
+func GetActive(ctx context.Context, pool *pgxpool.Pool) ([]*Request, error) {
+	var requests []*Request
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&requests,
+		`select r.* from coverage_requests r
+		join shifts s on s.id = r.shift_id
+		where r.status in ($1, $2) and s.status = $3 and s.starts_at > $4
+		order by s.starts_at, r.id`,
+		OpenStatus,
+		PendingApprovalStatus,
+		shifts.ScheduledStatus,
+		time.Now(),
+	); err != nil {
+		return nil, fmt.Errorf("failed to get coverage requests from db: %w", err)
+	}
+	return requests, nil
+}
@@ -0,0 +1,64 @@
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Status int
+
+const (
+	UndefinedStatus Status = iota
+	// waiting for a volunteer to accept
+	OpenStatus
+	// accepted, waiting for an admin to approve the transfer
+	PendingApprovalStatus
+	// the shift was transferred to the accepting volunteer
+	CoveredStatus
+	// withdrawn by the requester or an admin
+	CancelledStatus
+	// new statuses should go here so we don't change the int values associated with each status
+	endStatus
+)
+
+func (s Status) String() string {
+	switch s {
+	case OpenStatus:
+		return "open"
+	case PendingApprovalStatus:
+		return "pending_approval"
+	case CoveredStatus:
+		return "covered"
+	case CancelledStatus:
+		return "cancelled"
+	default:
+		return ""
+	}
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("status must be a string: %w", err)
+	}
+	status, err := ParseStatus(str)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// parses a status from its string representation, e.g. "open"
+func ParseStatus(str string) (Status, error) {
+	for s := UndefinedStatus + 1; s < endStatus; s++ {
+		if s.String() == str {
+			return s, nil
+		}
+	}
+	return UndefinedStatus, fmt.Errorf("unknown status %q", str)
+}
@@ -0,0 +1,139 @@
+package embeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about embed origins
+const auditTarget = "embed_origin"
+
+var ErrOriginExists = errors.New("the site is already allowed")
+
+// a lowercase hostname with an optional port. origins are written into Content-Security-Policy headers as is,
+// so anything url.Parse lets through in a host, like ';' or '*', must be rejected
+var originHost = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?(:[0-9]{1,5})?$`)
+
+// a website allowed to embed the booking widget. only its scheme, host and port are kept, e.g. https://example.com
+type Origin struct {
+	ID        int       `json:"id"`
+	Origin    string    `json:"origin"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// creates a new instance of an origin struct from a URL, dropping any trailing slash
+func NewOrigin(raw string) (*Origin, error) {
+	origin, err := normalize(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid origin: %w", err)
+	}
+	return &Origin{Origin: origin}, nil
+}
+
+// returns the origin of an absolute http or https URL without a path, query or credentials
+func normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "https" && scheme != "http") || len(u.Host) < 1 {
+		return "", fmt.Errorf("%q must be an absolute http or https URL, e.g. https://example.com", raw)
+	}
+	if u.User != nil || (len(u.Path) > 0 && u.Path != "/") || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return "", fmt.Errorf("%q must only include the scheme, host and port, e.g. https://example.com", raw)
+	}
+	host := strings.ToLower(u.Host)
+	if !originHost.MatchString(host) {
+		return "", fmt.Errorf("%q must be a host name with an optional port, e.g. https://example.com:8443", raw)
+	}
+	return scheme + "://" + host, nil
+}
+
+// inserts the origin if it doesn't have an ID yet, otherwise updates it
+func (o *Origin) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	origin, err := normalize(o.Origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin: %w", err)
+	}
+	o.Origin = origin
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if o.ID < 1 {
+			var existing int
+			if err := pgxscan.Get(ctx, tx, &existing, "select count(*) from embed_origins where origin = $1", o.Origin); err != nil {
+				return fmt.Errorf("failed to check embed origins: %w", err)
+			}
+			if existing > 0 {
+				return ErrOriginExists
+			}
+			if err := pgxscan.Get(ctx, tx, o, "insert into embed_origins(origin) values ($1) returning *", o.Origin); err != nil {
+				return fmt.Errorf("failed to insert embed origin: %w", err)
+			}
+			return audit.Record(ctx, tx, "embed_origin.create", auditTarget, o.ID, nil, o)
+		}
+		before, err := GetOriginByID(ctx, o.ID, tx)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("embed origin with ID %d not found", o.ID)
+		}
+		if _, err := tx.Exec(ctx, "update embed_origins set origin = $1 where id = $2", o.Origin, o.ID); err != nil {
+			return fmt.Errorf("failed to update embed origin: %w", err)
+		}
+		return audit.Record(ctx, tx, "embed_origin.update", auditTarget, o.ID, before, o)
+	})
+}
+
+// removes the origin from the allow-list. pages on it can no longer embed the widget
+func (o *Origin) Delete(ctx context.Context, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "delete from embed_origins where id = $1", o.ID); err != nil {
+			return fmt.Errorf("failed to delete embed origin: %w", err)
+		}
+		return audit.Record(ctx, tx, "embed_origin.delete", auditTarget, o.ID, o, nil)
+	})
+}
+
+func GetOriginByID(ctx context.Context, id int, db pgxscan.Querier) (*Origin, error) {
+	var origin Origin
+	if err := pgxscan.Get(ctx, db, &origin, "select * from embed_origins where id = $1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get embed origin: %w", err)
+	}
+	return &origin, nil
+}
+
+func GetOrigins(ctx context.Context, pool *pgxpool.Pool) ([]*Origin, error) {
+	var origins []*Origin
+	if err := pgxscan.Select(ctx, pool, &origins, "select * from embed_origins order by origin"); err != nil {
+		return nil, fmt.Errorf("failed to get embed origins from db: %w", err)
+	}
+	return origins, nil
+}
+
+// reports whether pages from the origin, as sent in a request's Origin header, may embed the widget
+func IsAllowed(ctx context.Context, origin string, pool *pgxpool.Pool) (bool, error) {
+	normalized, err := normalize(origin)
+	if err != nil {
+		return false, nil
+	}
+	var allowed bool
+	if err := pgxscan.Get(ctx, pool, &allowed, "select exists(select 1 from embed_origins where origin = $1)", normalized); err != nil {
+		return false, fmt.Errorf("failed to check embed origin: %w", err)
+	}
+	return allowed, nil
+}
@@ -0,0 +1,79 @@
+package flash
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// session key flash messages are stored under until they're displayed
+const sessionKey = "flash"
+
+type Level string
+
+const (
+	InfoLevel    Level = "info"
+	SuccessLevel Level = "success"
+	ErrorLevel   Level = "error"
+)
+
+// a one-time message carried through the session, shown on the next rendered page
+type Message struct {
+	Level Level
+	Text  string
+}
+
+// queues a message for the next rendered page. the caller is responsible for saving the session
+func Add(sess *session.Session, level Level, text string) error {
+	messages, err := get(sess)
+	if err != nil {
+		return err
+	}
+	messages = append(messages, Message{Level: level, Text: text})
+	// messages are stored as json so the session storage doesn't need to know about the Message type
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal flash messages: %w", err)
+	}
+	sess.Set(sessionKey, string(data))
+	return nil
+}
+
+// queues a message for the next rendered page and saves the session
+func Queue(c *fiber.Ctx, store *session.Store, level Level, text string) error {
+	sess, err := store.Get(c)
+	if err != nil {
+		return fmt.Errorf("failed to get session store: %w", err)
+	}
+	if err := Add(sess, level, text); err != nil {
+		return err
+	}
+	if err := sess.Save(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// returns any queued messages and removes them from the session. the caller is responsible for saving the session
+func Pop(sess *session.Session) ([]Message, error) {
+	messages, err := get(sess)
+	if err != nil {
+		return nil, err
+	}
+	sess.Delete(sessionKey)
+	return messages, nil
+}
+
+func get(sess *session.Session) ([]Message, error) {
+	data, ok := sess.Get(sessionKey).(string)
+	if !ok || len(data) < 1 {
+		return nil, nil
+	}
+	var messages []Message
+	if err := json.Unmarshal([]byte(data), &messages); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flash messages: %w", err)
+	}
+	return messages, nil
+}
@@ -0,0 +1,213 @@
+package intake
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a recruit's raw answers keyed by field key. values are what JSON decodes to: strings, numbers, booleans, or
+// lists of strings for multi_select fields. strings are accepted for every type so form posts can be used as is
+type Responses map[string]interface{}
+
+// a validated answer to one of a form's fields. Value is a string for text, paragraph and select fields,
+// a float64 for number fields, a bool for checkbox fields and a list of strings for multi_select fields
+type Answer struct {
+	Key   string      `json:"key"`
+	Label string      `json:"label"`
+	Type  FieldType   `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// formats the answer for people, e.g. "Yes" or "Canvassing, Phone banking"
+func (a *Answer) Text() string {
+	switch v := a.Value.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		// lists are decoded from the db as generic slices
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = fmt.Sprint(item)
+		}
+		return strings.Join(values, ", ")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// validates the responses against the form's fields, returning the answers in the form's order. unanswered
+// optional fields are left out, except checkboxes which are answered no. every problem is reported at once
+func (f *Form) Answer(responses Responses) ([]*Answer, error) {
+	var errs []string
+	known := map[string]bool{}
+	answers := []*Answer{}
+	for _, field := range f.Fields {
+		known[field.Key] = true
+		value, err := field.parse(responses[field.Key])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", field.Label, err))
+			continue
+		}
+		if value == nil {
+			if field.Required {
+				errs = append(errs, fmt.Sprintf("%s is required", field.Label))
+			}
+			continue
+		}
+		if field.Required && value == false {
+			errs = append(errs, fmt.Sprintf("%s must be checked", field.Label))
+			continue
+		}
+		answers = append(answers, &Answer{
+			Key:   field.Key,
+			Label: field.Label,
+			Type:  field.Type,
+			Value: value,
+		})
+	}
+	var unknown []string
+	for key := range responses {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Sprintf("unknown question %q", key))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid answers: %s", strings.Join(errs, "; "))
+	}
+	return answers, nil
+}
+
+// converts a raw response to the field's type. returns nil when the field wasn't answered
+func (f *Field) parse(raw interface{}) (interface{}, error) {
+	if s, ok := raw.(string); ok {
+		raw = strings.TrimSpace(s)
+	}
+	switch f.Type {
+	case TextFieldType, ParagraphFieldType:
+		switch v := raw.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			if len(v) < 1 {
+				return nil, nil
+			}
+			if len(v) > MaxTextLength {
+				return nil, fmt.Errorf("answers are limited to %d characters", MaxTextLength)
+			}
+			if f.Type == TextFieldType && strings.ContainsAny(v, "\r\n") {
+				return nil, fmt.Errorf("answer must be a single line")
+			}
+			return v, nil
+		}
+		return nil, fmt.Errorf("answer must be text")
+	case NumberFieldType:
+		switch v := raw.(type) {
+		case nil:
+			return nil, nil
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("answer must be a number")
+			}
+			return v, nil
+		case string:
+			if len(v) < 1 {
+				return nil, nil
+			}
+			// ParseFloat accepts "NaN" and "Inf", which can't be stored as json
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return nil, fmt.Errorf("%q isn't a number", v)
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("answer must be a number")
+	case SelectFieldType:
+		switch v := raw.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			if len(v) < 1 {
+				return nil, nil
+			}
+			if !f.hasOption(v) {
+				return nil, fmt.Errorf("%q isn't one of the options", v)
+			}
+			return v, nil
+		}
+		return nil, fmt.Errorf("answer must be one of the options")
+	case MultiSelectFieldType:
+		var values []string
+		switch v := raw.(type) {
+		case nil:
+		case string:
+			if len(v) > 0 {
+				values = []string{v}
+			}
+		case []string:
+			values = v
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("answer must be a list of options")
+				}
+				values = append(values, s)
+			}
+		default:
+			return nil, fmt.Errorf("answer must be a list of options")
+		}
+		// kept in the order the options are listed, without duplicates
+		picked := map[string]bool{}
+		for _, value := range values {
+			if !f.hasOption(value) {
+				return nil, fmt.Errorf("%q isn't one of the options", value)
+			}
+			picked[value] = true
+		}
+		if len(picked) < 1 {
+			return nil, nil
+		}
+		var selected []string
+		for _, o := range f.Options {
+			if picked[o] {
+				selected = append(selected, o)
+			}
+		}
+		return selected, nil
+	case CheckboxFieldType:
+		switch v := raw.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		case string:
+			switch strings.ToLower(v) {
+			case "", "false", "off", "no", "0":
+				return false, nil
+			case "true", "on", "yes", "1":
+				return true, nil
+			}
+		}
+		return nil, fmt.Errorf("answer must be yes or no")
+	default:
+		return nil, fmt.Errorf("unknown field type %d", f.Type)
+	}
+}
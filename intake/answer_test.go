@@ -0,0 +1,147 @@
+package intake
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testForm() *Form {
+	return &Form{
+		Name: "Volunteer intake",
+		Fields: []*Field{
+			{Key: "district", Label: "District", Type: TextFieldType, Required: true},
+			{Key: "age", Label: "Age", Type: NumberFieldType},
+			{Key: "shift", Label: "Shift", Type: SelectFieldType, Options: []string{"Morning", "Evening"}},
+			{Key: "activities", Label: "Activities", Type: MultiSelectFieldType, Options: []string{"Canvassing", "Phone banking", "Data entry"}},
+			{Key: "newsletter", Label: "Newsletter", Type: CheckboxFieldType},
+			{Key: "agree", Label: "Code of conduct", Type: CheckboxFieldType, Required: true},
+		},
+	}
+}
+
+// answers keyed by field key, for comparing
+func answerValues(answers []*Answer) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, a := range answers {
+		values[a.Key] = a.Value
+	}
+	return values
+}
+
+func TestFormAnswer(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses Responses
+		want      map[string]interface{}
+		// each must appear in the error. the answers are expected to be valid when empty
+		wantErrs []string
+	}{
+		{
+			name:      "required fields only",
+			responses: Responses{"district": " 5th ", "agree": true},
+			want:      map[string]interface{}{"district": "5th", "newsletter": false, "agree": true},
+		},
+		{
+			name:      "missing required fields",
+			responses: Responses{"district": "  "},
+			wantErrs:  []string{"District is required", "Code of conduct must be checked"},
+		},
+		{
+			name:      "checkboxes from form posts",
+			responses: Responses{"district": "5th", "newsletter": "on", "agree": "Yes"},
+			want:      map[string]interface{}{"district": "5th", "newsletter": true, "agree": true},
+		},
+		{
+			name:      "checkbox answered no",
+			responses: Responses{"district": "5th", "newsletter": "0", "agree": "true"},
+			want:      map[string]interface{}{"district": "5th", "newsletter": false, "agree": true},
+		},
+		{
+			name:      "checkbox that isn't yes or no",
+			responses: Responses{"district": "5th", "agree": "maybe"},
+			wantErrs:  []string{"Code of conduct: answer must be yes or no"},
+		},
+		{
+			name:      "multi select kept in option order without duplicates",
+			responses: Responses{"district": "5th", "agree": true, "activities": []interface{}{"Data entry", "Canvassing", "Data entry"}},
+			want:      map[string]interface{}{"district": "5th", "newsletter": false, "agree": true, "activities": []string{"Canvassing", "Data entry"}},
+		},
+		{
+			name:      "multi select from a single form value",
+			responses: Responses{"district": "5th", "agree": true, "activities": "Phone banking"},
+			want:      map[string]interface{}{"district": "5th", "newsletter": false, "agree": true, "activities": []string{"Phone banking"}},
+		},
+		{
+			name:      "multi select with an unknown option",
+			responses: Responses{"district": "5th", "agree": true, "activities": []string{"Canvassing", "Tabling"}},
+			wantErrs:  []string{`Activities: "Tabling" isn't one of the options`},
+		},
+		{
+			name:      "select and number",
+			responses: Responses{"district": "5th", "agree": true, "shift": "Evening", "age": "42.5"},
+			want:      map[string]interface{}{"district": "5th", "newsletter": false, "agree": true, "shift": "Evening", "age": 42.5},
+		},
+		{
+			name:      "numbers that can't be stored",
+			responses: Responses{"district": "5th", "agree": true, "age": "NaN"},
+			wantErrs:  []string{`Age: "NaN" isn't a number`},
+		},
+		{
+			name:      "infinite number",
+			responses: Responses{"district": "5th", "agree": true, "age": "-Inf"},
+			wantErrs:  []string{`Age: "-Inf" isn't a number`},
+		},
+		{
+			name:      "number out of range",
+			responses: Responses{"district": "5th", "agree": true, "age": "1e999"},
+			wantErrs:  []string{`Age: "1e999" isn't a number`},
+		},
+		{
+			name:      "unknown keys",
+			responses: Responses{"district": "5th", "agree": true, "zip": "10001", "email": "a@example.com"},
+			wantErrs:  []string{`unknown question "email"; unknown question "zip"`},
+		},
+		{
+			name:      "multi line text answer",
+			responses: Responses{"district": "5th\nward", "agree": true},
+			wantErrs:  []string{"District: answer must be a single line"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answers, err := testForm().Answer(tt.responses)
+			if len(tt.wantErrs) > 0 {
+				if err == nil {
+					t.Fatalf("expected errors %q, got answers %v", tt.wantErrs, answerValues(answers))
+				}
+				for _, want := range tt.wantErrs {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("expected error to contain %q, got %q", want, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := answerValues(answers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormAnswerKeepsFormOrder(t *testing.T) {
+	answers, err := testForm().Answer(Responses{"agree": true, "shift": "Morning", "district": "5th"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var keys []string
+	for _, a := range answers {
+		keys = append(keys, a.Key)
+	}
+	if want := []string{"district", "shift", "newsletter", "agree"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected answers in the order %v, got %v", want, keys)
+	}
+}
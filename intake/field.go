@@ -0,0 +1,177 @@
+package intake
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the kind of answer a field takes
+type FieldType int
+
+const (
+	UndefinedFieldType FieldType = iota
+	// a single line of text
+	TextFieldType
+	// a few lines of text
+	ParagraphFieldType
+	NumberFieldType
+	// one of the field's options
+	SelectFieldType
+	// any number of the field's options
+	MultiSelectFieldType
+	// yes or no
+	CheckboxFieldType
+	// new field types should go here so we don't change the int values associated with each type
+	endFieldType
+)
+
+// field types in the order they're offered in forms
+var FieldTypes = []FieldType{TextFieldType, ParagraphFieldType, NumberFieldType, SelectFieldType, MultiSelectFieldType, CheckboxFieldType}
+
+// longest text answer accepted
+const MaxTextLength = 2000
+
+var fieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func (t FieldType) String() string {
+	switch t {
+	case TextFieldType:
+		return "text"
+	case ParagraphFieldType:
+		return "paragraph"
+	case NumberFieldType:
+		return "number"
+	case SelectFieldType:
+		return "select"
+	case MultiSelectFieldType:
+		return "multi_select"
+	case CheckboxFieldType:
+		return "checkbox"
+	default:
+		return ""
+	}
+}
+
+// describes the field type for people, e.g. "Short text"
+func (t FieldType) Label() string {
+	switch t {
+	case TextFieldType:
+		return "Short text"
+	case ParagraphFieldType:
+		return "Paragraph"
+	case NumberFieldType:
+		return "Number"
+	case SelectFieldType:
+		return "Pick one"
+	case MultiSelectFieldType:
+		return "Pick any"
+	case CheckboxFieldType:
+		return "Yes or no"
+	default:
+		return ""
+	}
+}
+
+func (t FieldType) IsValid() bool {
+	return t > UndefinedFieldType && t < endFieldType
+}
+
+// whether answers are picked from the field's options
+func (t FieldType) HasOptions() bool {
+	return t == SelectFieldType || t == MultiSelectFieldType
+}
+
+func (t FieldType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *FieldType) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("field type must be a string: %w", err)
+	}
+	fieldType, err := ParseFieldType(str)
+	if err != nil {
+		return err
+	}
+	*t = fieldType
+	return nil
+}
+
+// parses a field type from its string representation, e.g. "multi_select"
+func ParseFieldType(str string) (FieldType, error) {
+	for t := UndefinedFieldType + 1; t < endFieldType; t++ {
+		if t.String() == str {
+			return t, nil
+		}
+	}
+	return UndefinedFieldType, fmt.Errorf("unknown field type %q", str)
+}
+
+// a question on an intake form
+type Field struct {
+	// identifies the answer, e.g. "district". lowercase letters, digits and underscores
+	Key   string    `json:"key"`
+	Label string    `json:"label"`
+	Type  FieldType `json:"type"`
+	// shown under the label to explain what's being asked
+	Help     string `json:"help"`
+	Required bool   `json:"required"`
+	// the choices for select and multi_select fields
+	Options []string `json:"options"`
+}
+
+func (f *Field) IsValid() error {
+	var errs []string
+	if !fieldKey.MatchString(f.Key) {
+		errs = append(errs, fmt.Sprintf("key %q must start with a letter and only contain lowercase letters, digits and underscores", f.Key))
+	}
+	if len(f.Label) < 1 {
+		errs = append(errs, "label is required")
+	}
+	if !f.Type.IsValid() {
+		errs = append(errs, fmt.Sprintf("invalid type %d provided", f.Type))
+	}
+	if f.Type.HasOptions() && len(f.Options) < 1 {
+		errs = append(errs, "at least one option is required")
+	}
+	if !f.Type.HasOptions() && len(f.Options) > 0 {
+		errs = append(errs, fmt.Sprintf("%s fields don't have options", f.Type.String()))
+	}
+	seen := map[string]bool{}
+	for _, o := range f.Options {
+		if seen[o] {
+			errs = append(errs, fmt.Sprintf("option %q is listed more than once", o))
+		}
+		seen[o] = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("field %q: %s", f.Key, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// trims the field's text and drops blank options
+func (f *Field) normalize() {
+	f.Key = strings.TrimSpace(f.Key)
+	f.Label = strings.TrimSpace(f.Label)
+	f.Help = strings.TrimSpace(f.Help)
+	options := []string{}
+	for _, o := range f.Options {
+		if o = strings.TrimSpace(o); len(o) > 0 {
+			options = append(options, o)
+		}
+	}
+	f.Options = options
+}
+
+func (f *Field) hasOption(value string) bool {
+	for _, o := range f.Options {
+		if o == value {
+			return true
+		}
+	}
+	return false
+}
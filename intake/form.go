@@ -0,0 +1,154 @@
+package intake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about intake forms
+const auditTarget = "intake_form"
+
+// most fields a form can have
+const MaxFields = 30
+
+// questions recruits answer when they book a call during a program's shifts. answers are stored with the booking
+// along with the labels they were given under, so changing a form doesn't change past answers
+type Form struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// shown to recruits above the questions
+	Description string    `json:"description"`
+	Fields      []*Field  `json:"fields"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// creates a new instance of a form struct
+func NewForm(name string, description string, fields []*Field) (*Form, error) {
+	form := Form{
+		Name:        name,
+		Description: description,
+		Fields:      fields,
+	}
+	form.normalize()
+	if err := form.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid intake form: %w", err)
+	}
+	return &form, nil
+}
+
+func (f *Form) IsValid() error {
+	var errs []string
+	if len(f.Name) < 1 {
+		errs = append(errs, "name is required")
+	}
+	if len(f.Fields) > MaxFields {
+		errs = append(errs, fmt.Sprintf("forms are limited to %d fields", MaxFields))
+	}
+	seen := map[string]bool{}
+	for _, field := range f.Fields {
+		if err := field.IsValid(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if seen[field.Key] {
+			errs = append(errs, fmt.Sprintf("key %q is used by more than one field", field.Key))
+		}
+		seen[field.Key] = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (f *Form) normalize() {
+	f.Name = strings.TrimSpace(f.Name)
+	f.Description = strings.TrimSpace(f.Description)
+	if f.Fields == nil {
+		f.Fields = []*Field{}
+	}
+	for _, field := range f.Fields {
+		field.normalize()
+	}
+}
+
+// inserts the form if it doesn't have an ID yet, otherwise updates it
+func (f *Form) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	f.normalize()
+	if err := f.IsValid(); err != nil {
+		return fmt.Errorf("invalid intake form: %w", err)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if f.ID < 1 {
+			if err := pgxscan.Get(
+				ctx,
+				tx,
+				f,
+				"insert into intake_forms(name, description, fields) values ($1, $2, $3) returning *",
+				f.Name,
+				f.Description,
+				f.Fields,
+			); err != nil {
+				return fmt.Errorf("failed to insert intake form: %w", err)
+			}
+			return audit.Record(ctx, tx, "intake_form.create", auditTarget, f.ID, nil, f)
+		}
+		before, err := GetFormByID(ctx, f.ID, tx)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("intake form with ID %d not found", f.ID)
+		}
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&f.UpdatedAt,
+			"update intake_forms set name = $1, description = $2, fields = $3, updated_at = now() where id = $4 returning updated_at",
+			f.Name,
+			f.Description,
+			f.Fields,
+			f.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update intake form: %w", err)
+		}
+		return audit.Record(ctx, tx, "intake_form.update", auditTarget, f.ID, before, f)
+	})
+}
+
+// deletes the form. shifts and series using it stop asking recruits any questions, and answers already given are kept
+func (f *Form) Delete(ctx context.Context, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "delete from intake_forms where id = $1", f.ID); err != nil {
+			return fmt.Errorf("failed to delete intake form: %w", err)
+		}
+		return audit.Record(ctx, tx, "intake_form.delete", auditTarget, f.ID, f, nil)
+	})
+}
+
+func GetFormByID(ctx context.Context, id int, db pgxscan.Querier) (*Form, error) {
+	var form Form
+	if err := pgxscan.Get(ctx, db, &form, "select * from intake_forms where id = $1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get intake form: %w", err)
+	}
+	return &form, nil
+}
+
+func GetForms(ctx context.Context, pool *pgxpool.Pool) ([]*Form, error) {
+	var forms []*Form
+	if err := pgxscan.Select(ctx, pool, &forms, "select * from intake_forms order by name, id"); err != nil {
+		return nil, fmt.Errorf("failed to get intake forms from db: %w", err)
+	}
+	return forms, nil
+}
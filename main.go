@@ -7,27 +7,43 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	netmail "net/mail"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"scheduler/api"
+	"scheduler/audit"
+	"scheduler/auth"
+	"scheduler/availability"
+	"scheduler/bookings"
+	"scheduler/calendar"
+	"scheduler/coverage"
+	"scheduler/embeds"
+	"scheduler/flash"
+	"scheduler/intake"
 	"scheduler/mail"
+	"scheduler/metrics"
 	"scheduler/middleware"
+	"scheduler/schedule"
+	"scheduler/shifts"
 	"scheduler/stytch"
+	"scheduler/tokens"
 	"scheduler/users"
 	"scheduler/utils"
+	"scheduler/webhooks"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/storage/redis"
 	"github.com/gofiber/template/html"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/joho/godotenv"
-	"github.com/stytchauth/stytch-go/v5/stytch/config"
 )
 
 // TODO: embed static files into the binary (!!)
@@ -76,14 +92,23 @@ func setup() error {
 		mail.NewEmail(os.Getenv("EMAIL_FROM_NAME"), os.Getenv("EMAIL_FROM_ADDRESS")),
 	)
 
-	// stytch config
-	stytchClient, err := stytch.NewClient(
-		config.EnvTest,
-		os.Getenv("STYTCH_CLIENT_ID"),
-		os.Getenv("STYTCH_SECRET"),
-	)
+	// auth config
+	// required, since defaulting to false would let a typo turn on the dev auth provider in production
+	isProd, err := strconv.ParseBool(os.Getenv("PROD"))
+	if err != nil {
+		return fmt.Errorf("failed to parse PROD env variable as bool: %w", err)
+	}
+	allowDevAuth, _ := strconv.ParseBool(os.Getenv("ALLOW_DEV_AUTH"))
+	authClient, err := auth.NewProvider(auth.Config{
+		Provider:        os.Getenv("AUTH_PROVIDER"),
+		IsProd:          isProd,
+		AllowDev:        allowDevAuth,
+		StytchProjectID: os.Getenv("STYTCH_CLIENT_ID"),
+		StytchSecret:    os.Getenv("STYTCH_SECRET"),
+		DevSecret:       os.Getenv("DEV_AUTH_SECRET"),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create new stytch client: %w", err)
+		return fmt.Errorf("failed to create auth provider: %w", err)
 	}
 
 	// db config
@@ -92,10 +117,42 @@ func setup() error {
 		return fmt.Errorf("failed to establish pgx pool: %w", err)
 	}
 	defer pool.Close()
+	// cancels calls along with their shifts
+	shifts.SetBookingsHook(bookings.ShiftHook{})
 
-	cfg := middleware.NewAppConfig(store, stytchClient, mailClient, storage, pool)
+	// sends queued webhooks, creates upcoming shifts for recurring series, offers waitlisted spots, tells recruits
+	// about cancelled calls and asks volunteers to cover shifts until the server stops
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go webhooks.NewWorker(pool).Run(workerCtx)
+	// series are only mirrored to a Google calendar once one has been configured
+	var seriesSyncer shifts.SeriesSyncer
+	if calendarID := os.Getenv("GOOGLE_CALENDAR_ID"); len(calendarID) > 0 {
+		calendarSvc, err := calendar.NewService(
+			workerCtx,
+			os.Getenv("GOOGLE_ACCESS_TOKEN"),
+			os.Getenv("GOOGLE_REFRESH_TOKEN"),
+			[]byte(os.Getenv("GOOGLE_CREDENTIALS")),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to connect to google calendar: %w", err)
+		}
+		seriesSyncer = calendar.NewSeriesSyncer(calendarSvc, calendarID)
+	}
+	go shifts.NewSeriesWorker(pool, seriesSyncer).Run(workerCtx)
 
 	serverAddress := os.Getenv("SERVER_ADDRESS")
+	go shifts.NewWaitlistWorker(pool, schedule.NewWaitlistMailer(pool, serverAddress, mailClient, engine)).Run(workerCtx)
+	go bookings.NewNoShowWorker(pool).Run(workerCtx)
+	go bookings.NewCancellationWorker(pool, schedule.NewCancellationMailer(pool, serverAddress, mailClient, engine)).Run(workerCtx)
+	go coverage.NewWorker(pool, schedule.NewCoverageMailer(pool, serverAddress, mailClient, engine)).Run(workerCtx)
+	// when set, a volunteer covering someone else's shift only takes it over once an admin approves
+	coverageRequiresApproval, err := strconv.ParseBool(os.Getenv("COVERAGE_REQUIRES_APPROVAL"))
+	if err != nil {
+		coverageRequiresApproval = false
+	}
+	cfg := middleware.NewAppConfig(store, authClient, mailClient, storage, pool, engine, serverAddress)
+
 	redirectURL := fmt.Sprintf("%s/oauth", url.QueryEscape(serverAddress))
 	googleLoginURL := fmt.Sprintf(
 		"%s?public_token=%s&login_redirect_url=%s&signup_redirect_url=%s",
@@ -109,25 +166,174 @@ func setup() error {
 		File: "./assets/favicon.ico",
 	}))
 	app.Use(logger.New())
+
+	// JSON API. registered ahead of the HTML middleware so API requests never see flash messages
+	// or login redirects. scripts authenticate with an API token, while session-authenticated clients
+	// send the token from the X-CSRF-Token response header back on state-changing requests
+	apiRouter := app.Group("/api", utils.JSONErrors)
+	apiRouter.Get("/openapi.json", api.OpenAPIHandler)
+	api.RegisterV1(apiRouter.Group(
+		"/v1",
+		middleware.NewTokenAuthHandler(cfg),
+		middleware.NewCSRFHandler(store),
+		middleware.NewAuthHandler(cfg, false),
+	), cfg)
+
+	// calendar apps can't log in, so feeds are authenticated by the secret token in their URL
+	app.Get("/ical/:token.ics", func(c *fiber.Ctx) error {
+		userID, err := schedule.GetFeedUserID(c.Context(), c.Params("token"), pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if userID == 0 {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("calendar feed not found"))
+		}
+		user, err := users.GetUserByID(c.Context(), userID, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("calendar feed not found"))
+		}
+		switch user.Status {
+		case users.DeletedStatus, users.InactiveStatus, users.UndefinedStatus:
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("calendar feed is disabled: user is %s", user.Status.String()))
+		}
+		feed, err := schedule.GetFeed(c.Context(), user, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+		return feed.WriteICal(c)
+	})
+
+	// the booking widget campaign sites embed. the script replaces the iframe with a slot picker built from the JSON
+	// endpoint, which only answers cross-origin requests from sites admins have allowed. the iframe is the fallback
+	// for visitors without JavaScript. both link to the public booking page to finish booking, since a form in a
+	// third-party frame can't rely on the session cookie. registered ahead of the session middleware for the same reason
+	app.Get("/embed.js", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		return c.SendFile("./assets/embed.js")
+	})
+	embed := app.Group("/embed", newPublicLimiter("embed", 120, time.Minute, storage))
+	embed.Get("/:id", func(c *fiber.Ctx) error {
+		series, err := publicSeriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		origins, err := embeds.GetOrigins(c.Context(), pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		ancestors := "'none'"
+		if len(origins) > 0 {
+			allowed := make([]string, len(origins))
+			for i, origin := range origins {
+				allowed[i] = origin.Origin
+			}
+			ancestors = strings.Join(allowed, " ")
+		}
+		c.Set(fiber.HeaderContentSecurityPolicy, "frame-ancestors "+ancestors)
+		days, err := publicBookingDays(c.Context(), series, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Render("embed", fiber.Map{
+			"Series":     series,
+			"Days":       days,
+			"BookingURL": fmt.Sprintf("%s/book/%d", serverAddress, series.ID),
+		}, "layouts/embed")
+	})
+	embed.Get("/:id/slots", utils.JSONErrors, func(c *fiber.Ctx) error {
+		// browsers send the Origin header on cross-origin requests. requests without one aren't from a browser
+		// on another site, so CORS doesn't apply to them
+		origin := c.Get(fiber.HeaderOrigin)
+		// set before anything is rendered, so caches don't serve one origin's response, even an error, to another
+		c.Vary(fiber.HeaderOrigin)
+		if len(origin) > 0 {
+			allowed, err := embeds.IsAllowed(c.Context(), origin, pool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if !allowed {
+				return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("%s isn't allowed to embed booking pages", origin))
+			}
+			c.Set(fiber.HeaderAccessControlAllowOrigin, origin)
+		}
+		series, err := publicSeriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		days, err := publicBookingDays(c.Context(), series, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(fiber.Map{
+			"series": fiber.Map{
+				"id":        series.ID,
+				"title":     series.Title,
+				"time_zone": series.TimeZone,
+			},
+			"booking_url": fmt.Sprintf("%s/book/%d", serverAddress, series.ID),
+			"days":        days,
+		})
+	})
+
+	app.Use(middleware.NewFlashHandler(store))
+	app.Use(middleware.NewCSRFHandler(store))
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.Render("index", fiber.Map{
 			"LoggedIn": false,
 		})
 	})
+	devClient, isDevAuth := authClient.(*auth.DevClient)
 	app.Get("/login", func(c *fiber.Ctx) error {
+		if isDevAuth {
+			return c.Render("login", fiber.Map{
+				"DevLoginURL": "/dev/login",
+			})
+		}
 		return c.Render("login", fiber.Map{
 			"GoogleLoginURL": googleLoginURL,
 		})
 	})
+	if isDevAuth {
+		// stands in for the stytch hosted oauth flow, letting you sign in as any seeded user
+		app.Get("/dev/login", func(c *fiber.Ctx) error {
+			allUsers, err := users.GetUsers(c.Context(), pool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to get users: %w", err))
+			}
+			logins := []fiber.Map{}
+			for _, user := range allUsers {
+				if len(user.StytchID) < 1 {
+					continue
+				}
+				token, err := devClient.LoginToken(user.StytchID)
+				if err != nil {
+					return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to issue login token: %w", err))
+				}
+				logins = append(logins, fiber.Map{
+					"User": user,
+					"URL":  "/oauth?token=" + url.QueryEscape(token),
+				})
+			}
+			return c.Render("dev_login", fiber.Map{
+				"Logins": logins,
+			})
+		})
+	}
 	app.Get("/logout", func(c *fiber.Ctx) error {
 		sess, err := store.Get(c)
 		if err != nil {
 			return utils.RenderGetSessionError(c, err)
 		}
 		if sessToken, ok := sess.Get("session_token").(string); ok {
-			// revoke stytch session
-			if err := stytchClient.RevokeSession(sessToken); err != nil {
-				fmt.Println(fmt.Errorf("failed to revoke stytch session: %w", err))
+			// revoke auth provider session
+			if err := authClient.RevokeSession(sessToken); err != nil {
+				fmt.Println(fmt.Errorf("failed to revoke auth session: %w", err))
 			}
 		}
 		// destroy store session
@@ -142,11 +348,15 @@ func setup() error {
 		if err != nil {
 			return utils.RenderGetSessionError(c, err)
 		}
-		// try to get an existing session token from the store
+		// try to get an existing session from the store
 		currentSessToken, _ := sess.Get("session_token").(string)
+		currentSessJWT, _ := sess.Get("session_jwt").(string)
 		// authenticate
-		sessToken, err := stytchClient.AuthenticateOauth(c.Query("token"), currentSessToken, func(stytchID string) error {
-			ctx := c.Context()
+		authSess, err := authClient.AuthenticateOauth(c.Query("token"), stytch.Session{
+			Token: currentSessToken,
+			JWT:   currentSessJWT,
+		}, func(stytchID string) error {
+			ctx := c.UserContext()
 			user, err := users.GetUserByStytchID(ctx, stytchID, pool)
 			if err != nil {
 				return fmt.Errorf("failed to retrieve user: %w", err)
@@ -155,13 +365,27 @@ func setup() error {
 			if user == nil {
 				return fmt.Errorf("user not found")
 			}
+			// users activating themselves by logging in are their own actors
+			ctx = audit.WithActor(ctx, user.ID)
+			changed := false
 			switch user.Status {
 			case users.DeletedStatus, users.UndefinedStatus:
 				return fmt.Errorf("invalid user status")
-			case users.PendingStatus, users.InvitedStatus, users.InactiveStatus:
+			// deactivated users stay deactivated until an admin turns them back on
+			case users.InactiveStatus:
+				return fmt.Errorf("user has been deactivated")
+			case users.PendingStatus, users.InvitedStatus:
 				user.Status = users.ActiveStatus
+				changed = true
+			}
+			// default to the time zone detected by the login page until the user chooses one
+			if timeZone := c.Cookies("time_zone"); len(user.TimeZone) < 1 && users.IsValidTimeZone(timeZone) {
+				user.TimeZone = timeZone
+				changed = true
+			}
+			if changed {
 				if err := user.Update(ctx, pool); err != nil {
-					err = fmt.Errorf("failed to update status for user with stytch ID %q: %w", user.StytchID, err)
+					err = fmt.Errorf("failed to update user with stytch ID %q: %w", user.StytchID, err)
 					fmt.Println(err)
 					return err
 				}
@@ -169,10 +393,18 @@ func setup() error {
 			return nil
 		})
 		if err != nil {
-			return utils.RenderError(c, http.StatusUnauthorized, fmt.Errorf("failed to authenticate oauth token: %w", err))
+			// send the user back to login with the reason displayed
+			if err := flash.Add(sess, flash.ErrorLevel, fmt.Sprintf("failed to authenticate oauth token: %s", err.Error())); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if err := sess.Save(); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to save session: %w", err))
+			}
+			return c.Redirect("/login")
 		}
-		// store session token for later use
-		sess.Set("session_token", sessToken)
+		// store session token & JWT for later use
+		sess.Set("session_token", authSess.Token)
+		sess.Set("session_jwt", authSess.JWT)
 		// try getting a redirect path from the store
 		redirect, _ := sess.Get("auth_redirect").(string)
 		sess.Delete("auth_redirect")
@@ -181,10 +413,145 @@ func setup() error {
 			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to save session: %w", err))
 		}
 		// go to either the redirect path or authenticated dashboard
-		if redirect == "" {
-			redirect = "/dash"
+		return c.Redirect(utils.SafeRedirect(redirect, "/dash"))
+	})
+
+	// anyone with the link can book a call during a public series' shifts. the page is rate limited by IP,
+	// with a stricter limit on submissions since each one sends an email
+	book := app.Group("/book", newPublicLimiter("book", 60, time.Minute, storage))
+	submitLimiter := newPublicLimiter("book_submit", 10, time.Hour, storage)
+	book.Get("/:id", func(c *fiber.Ctx) error {
+		series, err := publicSeriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		// the embeddable widget links to the page with the slot the recruit picked
+		return renderBookingPage(c, http.StatusOK, series, fiber.Map{"Slot": c.Query("slot")}, pool)
+	})
+	book.Post("/:id", submitLimiter, func(c *fiber.Ctx) error {
+		series, err := publicSeriesFromParams(c, pool)
+		if series == nil {
+			return err
 		}
-		return c.Redirect(redirect)
+		name := strings.TrimSpace(c.FormValue("name"))
+		email := c.FormValue("email")
+		// shown again along with the error if the request can't be made
+		retry := func(status int, err error) error {
+			return renderBookingPage(c, status, series, fiber.Map{
+				"Error": err.Error(),
+				"Name":  name,
+				"Email": email,
+				"Slot":  c.FormValue("slot"),
+			}, pool)
+		}
+		if len(name) < 1 {
+			return retry(http.StatusBadRequest, fmt.Errorf("your name is required"))
+		}
+		addr, err := netmail.ParseAddress(email)
+		if err != nil {
+			return retry(http.StatusBadRequest, fmt.Errorf("%q isn't a valid email address", email))
+		}
+		shift, startsAt, err := publicSlotFromForm(c, series, pool)
+		if err != nil {
+			return retry(http.StatusBadRequest, err)
+		}
+		if shift == nil {
+			return retry(http.StatusConflict, fmt.Errorf("that time was just taken. pick another one"))
+		}
+		var responses intake.Responses
+		if shift.IntakeFormID != nil {
+			form, err := intake.GetFormByID(c.Context(), *shift.IntakeFormID, pool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if form != nil {
+				responses = intakeResponsesFromForm(c, form)
+				// checked now so mistakes are caught before the email is sent. they're checked again when the call is booked
+				if _, err := form.Answer(responses); err != nil {
+					return retry(http.StatusBadRequest, err)
+				}
+			}
+		}
+
+		// existing users are never changed from the public page, since whoever filled it in may not own the address
+		recruit, err := users.GetUserByEmail(c.Context(), addr.Address, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if recruit == nil {
+			recruit = &users.User{
+				Name:     name,
+				Email:    addr.Address,
+				Status:   users.PendingStatus,
+				Type:     users.RecruitType,
+				TimeZone: series.TimeZone,
+			}
+			if err := recruit.Update(c.UserContext(), pool); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+		}
+		// only recruits book calls. the same page is shown whether or not an email was sent, so it can't be used to
+		// find out who has an account
+		if recruit.Type == users.RecruitType && recruit.Status != users.DeletedStatus {
+			req, token, err := bookings.NewRequest(c.UserContext(), shift.ID, recruit.ID, startsAt, responses, pool)
+			if errors.Is(err, bookings.ErrTooManyRequests) {
+				return retry(http.StatusTooManyRequests, fmt.Errorf("we've already emailed %s a few links to confirm. check your inbox", addr.Address))
+			}
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if err := schedule.SendBookingVerification(recruit, shift, req, token, serverAddress, mailClient, engine); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+		}
+		return c.Render("book_sent", fiber.Map{
+			"Series": series,
+			"Email":  addr.Address,
+			"Expiry": int(bookings.RequestExpiry.Hours()),
+		})
+	})
+	book.Get("/confirm/:token", func(c *fiber.Ctx) error {
+		req, shift, recruit, err := bookingRequestFromParams(c, pool)
+		if req == nil {
+			return err
+		}
+		// following the link only shows the call. it's booked by the form, so link scanners in mail clients can't book it
+		return c.Render("book_confirm", fiber.Map{
+			"Request":  req,
+			"Shift":    shift,
+			"Recruit":  recruit,
+			"StartsAt": recruit.LocalTime(req.StartsAt),
+			"Token":    c.Params("token"),
+		})
+	})
+	book.Post("/confirm/:token", func(c *fiber.Ctx) error {
+		req, shift, recruit, err := bookingRequestFromParams(c, pool)
+		if req == nil {
+			return err
+		}
+		booking, err := req.Confirm(c.UserContext(), pool)
+		switch {
+		case errors.Is(err, bookings.ErrRequestExpired):
+			return utils.RenderError(c, http.StatusGone, err)
+		case errors.Is(err, bookings.ErrRequestConfirmed):
+			return utils.RenderError(c, http.StatusConflict, err)
+		case errors.Is(err, bookings.ErrSlotUnavailable), errors.Is(err, bookings.ErrRecruitBusy):
+			return utils.RenderError(c, http.StatusConflict, fmt.Errorf("%w. go back to the booking page to pick another time", err))
+		case err != nil:
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		// following the emailed link shows the recruit owns the address, so recruits signed up from the public page
+		// get an account they can log in with
+		if recruit.Status == users.PendingStatus {
+			// the call is booked either way, so failing to activate the recruit isn't worth an error page
+			if err := recruit.Activate(audit.WithActor(c.UserContext(), recruit.ID), pool, authClient); err != nil {
+				fmt.Println(fmt.Errorf("failed to activate recruit %d: %w", recruit.ID, err))
+			}
+		}
+		return c.Render("book_confirmed", fiber.Map{
+			"Shift":    shift,
+			"StartsAt": recruit.LocalTime(booking.StartsAt),
+		})
 	})
 
 	app.Use(middleware.NewAuthHandler(cfg, true))
@@ -202,84 +569,1906 @@ func setup() error {
 	// authenticated routes ⬇️
 	app.Get("/dash", func(c *fiber.Ctx) error {
 		return authedHandler("dash", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			current := middleware.CurrentUser(ctx)
+			if !current.HasPermission(users.SignupShiftsPermission) {
+				return fiber.Map{}, nil
+			}
+			rows, err := shiftRows(ctx.Context(), current.ID, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			var mine, offers []*shiftRow
+			for _, row := range rows {
+				switch {
+				case row.SignedUp:
+					mine = append(mine, row)
+				case row.Waitlist != nil && row.Waitlist.OfferExpiresAt != nil:
+					offers = append(offers, row)
+				}
+			}
+			calls, err := callRows(ctx.Context(), bookings.Filter{
+				VolunteerID: current.ID,
+				Status:      bookings.BookedStatus,
+				From:        time.Now(),
+				Limit:       dashCallsLimit,
+			}, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			requests, err := coverageRows(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			var needCoverage []*coverageRow
+			for _, row := range requests {
+				if row.Request.Status == coverage.OpenStatus && row.Request.RequesterID != current.ID {
+					needCoverage = append(needCoverage, row)
+				}
+			}
+			served, err := metrics.GetHoursServed(ctx.Context(), current.ID, time.Now(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
 			return fiber.Map{
-				"Message": "You made it! 🎉",
+				"Volunteer":    true,
+				"Shifts":       mine,
+				"Offers":       offers,
+				"Calls":        calls,
+				"MoreCalls":    len(calls) == dashCallsLimit,
+				"NeedCoverage": needCoverage,
+				"Served":       served,
 			}, nil
 		})(c)
 	})
 
-	// admin portal
-	admin := app.Group("/admin", middleware.NewTypeValidator(users.AdminType, pool))
-	admin.Get("/", func(c *fiber.Ctx) error {
-		return authedHandler("admin", func(ctx *fiber.Ctx) (fiber.Map, error) {
+	app.Get("/profile", func(c *fiber.Ctx) error {
+		return authedHandler("profile", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			return fiber.Map{
+				"TimeZones": commonTimeZones,
+				"Skills":    strings.Join(middleware.CurrentUser(ctx).Skills, ", "),
+			}, nil
+		})(c)
+	})
+	app.Post("/profile", func(c *fiber.Ctx) error {
+		timeZone := strings.TrimSpace(c.FormValue("time_zone"))
+		if !users.IsValidTimeZone(timeZone) {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid time zone %q", timeZone))
+		}
+		// the current user may be limited by scopes, so update a fresh copy
+		user, err := users.GetUserByID(c.Context(), middleware.CurrentUser(c).ID, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user not found"))
+		}
+		user.TimeZone = timeZone
+		if err := user.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Times will be shown in %s", timeZone)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/profile")
+	})
+	app.Post("/profile/skills", func(c *fiber.Ctx) error {
+		user, err := users.GetUserByID(c.Context(), middleware.CurrentUser(c).ID, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user not found"))
+		}
+		user.Skills = users.ParseSkills(c.FormValue("skills"))
+		if err := user.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, "Your skills have been saved"); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/profile")
+	})
+
+	app.Get("/calendar-feed", func(c *fiber.Ctx) error {
+		return authedHandler("calendar_feed", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			hasFeed, err := schedule.HasFeed(ctx.Context(), middleware.CurrentUser(ctx).ID, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
 			return fiber.Map{
-				"Message": "Well done, you're an admin! 👨‍💼",
+				"HasFeed": hasFeed,
 			}, nil
 		})(c)
 	})
+	app.Post("/calendar-feed", func(c *fiber.Ctx) error {
+		current := middleware.CurrentUser(c)
+		switch c.FormValue("action") {
+		case "reset":
+			token, err := schedule.ResetFeedToken(c.UserContext(), current.ID, pool)
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			// the token can't be retrieved later, so the URL is shown on this response only
+			return authedHandler("calendar_feed", func(ctx *fiber.Ctx) (fiber.Map, error) {
+				return fiber.Map{
+					"HasFeed": true,
+					"FeedURL": fmt.Sprintf("%s/ical/%s.ics", serverAddress, token),
+				}, nil
+			})(c)
+		case "disable":
+			if err := schedule.DisableFeed(c.UserContext(), current.ID, pool); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			if err := flash.Queue(c, store, flash.SuccessLevel, "Turned off your calendar feed"); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			return c.Redirect("/calendar-feed")
+		default:
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("unknown action %q", c.FormValue("action")))
+		}
+	})
 
-	admin.Get("/volunteers", func(c *fiber.Ctx) error {
-		return authedHandler("volunteers", func(ctx *fiber.Ctx) (fiber.Map, error) {
-			vols, err := users.GetAllVolunteers(ctx.Context(), pool)
+	app.Get("/availability", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("availability", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			a, err := availability.Get(ctx.Context(), middleware.CurrentUser(ctx).ID, pool)
 			if err != nil {
-				return fiber.Map{}, fmt.Errorf("failed to get volunteers: %w", err)
+				return fiber.Map{}, err
 			}
 			return fiber.Map{
-				"Volunteers": vols,
+				"Availability": a,
+				"Weekdays":     weekdays,
 			}, nil
 		})(c)
 	})
-	admin.Post("/volunteer", func(c *fiber.Ctx) error {
-		// create volunteer & invite
-		// don't have stytch ID at this point, so passing an empty string
-		volunteer, err := users.NewVolunteer(c.FormValue("name"), c.FormValue("email"), "", users.PendingStatus)
+	app.Post("/availability/windows", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		weekday, err := strconv.Atoi(c.FormValue("weekday"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid weekday %q: %w", c.FormValue("weekday"), err))
+		}
+		start, err := availability.ParseMinute(c.FormValue("start"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		end, err := availability.ParseMinute(c.FormValue("end"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		window := &availability.Window{
+			UserID:      middleware.CurrentUser(c).ID,
+			Weekday:     time.Weekday(weekday),
+			StartMinute: start,
+			EndMinute:   end,
+		}
+		if err := window.IsValid(); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := availability.AddWindow(c.UserContext(), window, pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Added %s to your availability", window)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/availability")
+	})
+	app.Post("/availability/windows/:id/delete", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid ID %q: %w", c.Params("id"), err))
+		}
+		if err := availability.RemoveWindow(c.UserContext(), middleware.CurrentUser(c).ID, id, pool); err != nil {
 			return utils.RenderError(c, http.StatusInternalServerError, err)
 		}
-
-		// TODO: someday this should be handled async as it causes a fairly long delay before the browser gets a response
-		if err := volunteer.Invite(c.Context(), serverAddress, mailClient, engine, pool, stytchClient); err != nil {
+		return c.Redirect("/availability")
+	})
+	app.Post("/availability/blackouts", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		current := middleware.CurrentUser(c)
+		date, err := time.ParseInLocation("2006-01-02", c.FormValue("date"), current.Location())
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid date %q: %w", c.FormValue("date"), err))
+		}
+		if c.FormValue("action") == "remove" {
+			err = availability.RemoveBlackout(c.UserContext(), current.ID, date, pool)
+		} else {
+			err = availability.AddBlackout(c.UserContext(), current.ID, date, pool)
+		}
+		if err != nil {
 			return utils.RenderError(c, http.StatusInternalServerError, err)
 		}
-
-		return c.Redirect("/admin/volunteers")
+		return c.Redirect("/availability")
 	})
 
-	return app.Listen(":3000")
-}
-
-func main() {
-	if err := setup(); err != nil {
-		log.Fatal("failed to setup app: " + err.Error())
-	}
-}
-
-func getX509CertFromFiles() (tls.Certificate, error) {
-	var (
-		cert tls.Certificate
-		err  error
-	)
-	pubKeyPath := os.Getenv("PUBLIC_KEY_PATH")
-	privateKeyPath := os.Getenv("PRIVATE_KEY_PATH")
-	if len(pubKeyPath) > 0 && len(privateKeyPath) > 0 {
-		cert, err = tls.LoadX509KeyPair(pubKeyPath, privateKeyPath)
+	app.Get("/shifts", middleware.NewPermissionValidator(users.ViewShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("shifts", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			current := middleware.CurrentUser(ctx)
+			rows, err := shiftRows(ctx.Context(), current.ID, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Shifts":    rows,
+				"CanSignup": current.HasPermission(users.SignupShiftsPermission),
+			}, nil
+		})(c)
+	})
+	app.Post("/shifts/:id/:action", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
-			return cert, fmt.Errorf("failed to load cert keypair: %w", err)
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid shift ID %q: %w", c.Params("id"), err))
 		}
-		return cert, nil
-	}
-	return cert, fmt.Errorf("missing or empty env variables PUBLIC_KEY_PATH and PRIVATE_KEY_PATH")
-}
+		shift, err := shifts.GetShiftByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if shift == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("shift with ID %d not found", id))
+		}
+		current := middleware.CurrentUser(c)
+		var message string
+		switch c.Params("action") {
+		case "signup":
+			err = shift.AddVolunteer(c.UserContext(), current.ID, pool)
+			message = fmt.Sprintf("Signed up for %s", shift.Title)
+		case "leave":
+			err = shift.RemoveVolunteer(c.UserContext(), current.ID, pool)
+			message = fmt.Sprintf("Left %s", shift.Title)
+		case "join-waitlist":
+			err = shift.JoinWaitlist(c.UserContext(), current.ID, pool)
+			message = fmt.Sprintf("Joined the waitlist for %s. We'll email you if a spot opens up", shift.Title)
+		case "leave-waitlist":
+			err = shift.LeaveWaitlist(c.UserContext(), current.ID, pool)
+			message = fmt.Sprintf("Left the waitlist for %s", shift.Title)
+		default:
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("unknown action %q", c.Params("action")))
+		}
+		if errors.Is(err, shifts.ErrShiftFull) || errors.Is(err, shifts.ErrShiftNotFull) || errors.Is(err, bookings.ErrVolunteerHasCalls) {
+			return utils.RenderError(c, http.StatusConflict, err)
+		}
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, message); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(utils.SafeRedirect(c.FormValue("redirect"), "/shifts"))
+	})
 
-func getX509Cert() (tls.Certificate, error) {
-	pubKey := os.Getenv("PUBLIC_KEY")
-	privateKey := os.Getenv("PRIVATE_KEY")
-	if len(pubKey) > 0 && len(privateKey) > 0 {
-		cert, err := tls.X509KeyPair([]byte(pubKey), []byte(privateKey))
+	app.Get("/calls", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("calls", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			current := middleware.CurrentUser(ctx)
+			now := time.Now()
+			upcoming, err := callRows(ctx.Context(), bookings.Filter{
+				VolunteerID: current.ID,
+				Status:      bookings.BookedStatus,
+				From:        now,
+				Limit:       100,
+			}, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			// calls that have started, going back far enough to correct calls marked no-shows
+			recent, err := callRows(ctx.Context(), bookings.Filter{
+				VolunteerID: current.ID,
+				Status:      bookings.BookedStatus,
+				From:        now.Add(-2 * bookings.NoShowAfter),
+				To:          now,
+				Limit:       100,
+			}, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Calls":    upcoming,
+				"Recent":   recent,
+				"Outcomes": bookings.Outcomes,
+			}, nil
+		})(c)
+	})
+	app.Post("/calls/:id/outcome", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
 		if err != nil {
-			return getX509CertFromFiles()
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid booking ID: %w", err))
 		}
-		return cert, nil
-	}
-	return getX509CertFromFiles()
+		booking, err := bookings.GetBookingByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		// other volunteers' calls are reported as missing so their IDs aren't leaked
+		if booking == nil || booking.VolunteerID != middleware.CurrentUser(c).ID {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("call with ID %d not found", id))
+		}
+		outcome, err := bookings.ParseOutcome(c.FormValue("outcome"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := booking.LogOutcome(c.UserContext(), outcome, c.FormValue("notes"), pool); err != nil {
+			if errors.Is(err, bookings.ErrCallNotStarted) || errors.Is(err, bookings.ErrCallNotBooked) || errors.Is(err, bookings.ErrInvalidOutcome) {
+				return utils.RenderError(c, http.StatusBadRequest, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Logged the %s call as %s", middleware.CurrentUser(c).LocalTime(booking.StartsAt), strings.ToLower(outcome.Label()))); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/calls")
+	})
+	app.Post("/calls/:id/cancel", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid booking ID: %w", err))
+		}
+		booking, err := bookings.GetBookingByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		current := middleware.CurrentUser(c)
+		if booking == nil || booking.VolunteerID != current.ID {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("call with ID %d not found", id))
+		}
+		if booking.Status != bookings.BookedStatus {
+			return utils.RenderError(c, http.StatusConflict, fmt.Errorf("the call has already been cancelled"))
+		}
+		if err := booking.UpdateStatus(c.UserContext(), bookings.CancelledStatus, pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Cancelled the %s call", current.LocalTime(booking.StartsAt))); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(utils.SafeRedirect(c.FormValue("redirect"), "/calls"))
+	})
+
+	app.Get("/coverage", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("coverage", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			current := middleware.CurrentUser(ctx)
+			rows, err := coverageRows(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			var open, mine, pending []*coverageRow
+			for _, row := range rows {
+				switch {
+				case row.Request.RequesterID == current.ID:
+					mine = append(mine, row)
+				case row.Request.Status == coverage.OpenStatus:
+					open = append(open, row)
+				}
+				if row.Request.Status == coverage.PendingApprovalStatus {
+					pending = append(pending, row)
+				}
+			}
+			return fiber.Map{
+				"Open":       open,
+				"Mine":       mine,
+				"Pending":    pending,
+				"CanApprove": current.HasPermission(users.ManageShiftsPermission),
+			}, nil
+		})(c)
+	})
+	app.Post("/coverage", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		shiftID, err := strconv.Atoi(c.FormValue("shift_id"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid shift ID %q: %w", c.FormValue("shift_id"), err))
+		}
+		shift, err := shifts.GetShiftByID(c.Context(), shiftID, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if shift == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("shift with ID %d not found", shiftID))
+		}
+		current := middleware.CurrentUser(c)
+		if _, err := coverage.Open(c.UserContext(), shift.ID, current.ID, c.FormValue("note"), coverageRequiresApproval, pool); err != nil {
+			if errors.Is(err, shifts.ErrNotOnShift) || errors.Is(err, coverage.ErrAlreadyRequested) {
+				return utils.RenderError(c, http.StatusConflict, err)
+			}
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		message := fmt.Sprintf("Asked for someone to cover %s. Volunteers who can make it will get an email", shift.Title)
+		if err := flash.Queue(c, store, flash.SuccessLevel, message); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(utils.SafeRedirect(c.FormValue("redirect"), "/coverage"))
+	})
+	app.Post("/coverage/:id/:action", middleware.NewPermissionValidator(users.SignupShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid coverage request ID %q: %w", c.Params("id"), err))
+		}
+		request, err := coverage.GetRequestByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if request == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("coverage request with ID %d not found", id))
+		}
+		current := middleware.CurrentUser(c)
+		canApprove := current.HasPermission(users.ManageShiftsPermission)
+		var message string
+		switch c.Params("action") {
+		case "accept":
+			err = request.Accept(c.UserContext(), current.ID, pool)
+			message = "The shift is yours"
+			if request.Status == coverage.PendingApprovalStatus {
+				message = "Thanks! The shift will be yours once an admin approves"
+			}
+		case "cancel":
+			if request.RequesterID != current.ID && !canApprove {
+				return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageShiftsPermission))
+			}
+			err = request.Cancel(c.UserContext(), pool)
+			message = "Cancelled the coverage request"
+		case "approve", "reject":
+			if !canApprove {
+				return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("user with ID %d is missing the %q permission", current.ID, users.ManageShiftsPermission))
+			}
+			if c.Params("action") == "approve" {
+				err = request.Approve(c.UserContext(), pool)
+				message = "Approved the coverage request"
+			} else {
+				err = request.Reject(c.UserContext(), pool)
+				message = "Rejected the volunteer. The request is open again"
+			}
+		default:
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("unknown action %q", c.Params("action")))
+		}
+		if isCoverageConflict(err) {
+			return utils.RenderError(c, http.StatusConflict, err)
+		}
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, message); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(utils.SafeRedirect(c.FormValue("redirect"), "/coverage"))
+	})
+
+	// admin portal
+	admin := app.Group("/admin", middleware.NewPermissionValidator(users.AdminPortalPermission))
+	admin.Get("/", func(c *fiber.Ctx) error {
+		return authedHandler("admin", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			loc := middleware.CurrentUser(ctx).Location()
+			now := time.Now()
+			// activity defaults to the last 30 days, including today
+			today := time.Date(now.In(loc).Year(), now.In(loc).Month(), now.In(loc).Day(), 0, 0, 0, 0, loc)
+			from, to := today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+			var err error
+			if f := ctx.Query("from"); len(f) > 0 {
+				if from, err = time.ParseInLocation("2006-01-02", f, loc); err != nil {
+					return fiber.Map{}, fmt.Errorf("invalid from date %q: %w", f, err)
+				}
+			}
+			if t := ctx.Query("to"); len(t) > 0 {
+				if to, err = time.ParseInLocation("2006-01-02", t, loc); err != nil {
+					return fiber.Map{}, fmt.Errorf("invalid to date %q: %w", t, err)
+				}
+				// include the whole day
+				to = to.AddDate(0, 0, 1)
+			}
+			if !to.After(from) {
+				return fiber.Map{}, fmt.Errorf("to date must be after from date")
+			}
+			if to.After(from.AddDate(1, 0, 0)) {
+				return fiber.Map{}, fmt.Errorf("date ranges are limited to a year")
+			}
+
+			fill, err := metrics.GetShiftFill(ctx.Context(), now, now.AddDate(0, 0, 14), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			invites, err := metrics.GetPendingInvites(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			perDay, err := metrics.GetBookingsPerDay(ctx.Context(), from, to, loc, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			outcomes, err := metrics.GetOutcomes(ctx.Context(), from, to, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			top, err := metrics.GetTopVolunteers(ctx.Context(), from, to, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"From":          from.Format("2006-01-02"),
+				"To":            to.AddDate(0, 0, -1).Format("2006-01-02"),
+				"ShiftFill":     fill,
+				"Invites":       invites,
+				"BookingsByDay": perDay,
+				"Outcomes":      outcomes,
+				"TopVolunteers": top,
+			}, nil
+		})(c)
+	})
+
+	admin.Get("/shifts", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("admin_shifts", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			current := middleware.CurrentUser(ctx)
+			week := time.Now().In(current.Location())
+			if w := ctx.Query("week"); len(w) > 0 {
+				var err error
+				if week, err = time.ParseInLocation("2006-01-02", w, current.Location()); err != nil {
+					return fiber.Map{}, fmt.Errorf("invalid week %q: %w", w, err)
+				}
+			}
+			heatmap, err := availability.GetHeatmap(ctx.Context(), week, current.Location(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			upcoming, _, err := shifts.FindShifts(ctx.Context(), shifts.Filter{
+				From:   time.Now(),
+				Status: shifts.ScheduledStatus,
+				Limit:  100,
+			}, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			if err := shifts.LoadVolunteers(ctx.Context(), upcoming, pool); err != nil {
+				return fiber.Map{}, err
+			}
+			series, err := shifts.GetAllSeries(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			forms, err := intake.GetForms(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Heatmap":         heatmap,
+				"Assignments":     shifts.Assignments,
+				"IntakeForms":     forms,
+				"Week":            week.Format("2006-01-02"),
+				"PrevWeek":        week.AddDate(0, 0, -7).Format("2006-01-02"),
+				"NextWeek":        week.AddDate(0, 0, 7).Format("2006-01-02"),
+				"Shifts":          upcoming,
+				"Series":          series,
+				"DefaultTimeZone": current.Location().String(),
+			}, nil
+		})(c)
+	})
+	admin.Post("/shifts", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		current := middleware.CurrentUser(c)
+		startsAt, err := current.ParseLocalInput(c.FormValue("starts_at"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid start time %q: %w", c.FormValue("starts_at"), err))
+		}
+		endsAt, err := current.ParseLocalInput(c.FormValue("ends_at"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid end time %q: %w", c.FormValue("ends_at"), err))
+		}
+		capacity := 0
+		if value := c.FormValue("capacity"); len(value) > 0 {
+			if capacity, err = strconv.Atoi(value); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid capacity %q: %w", value, err))
+			}
+		}
+		shift, err := shifts.New(c.FormValue("title"), startsAt, endsAt, capacity)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if shift.Assignment, err = assignmentFromForm(c); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if shift.IntakeFormID, err = intakeFormIDFromForm(c); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := shift.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Created shift %s", shift.Title)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/shifts?week=%s", startsAt.Format("2006-01-02")))
+	})
+
+	admin.Post("/series", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		series, err := seriesFromForm(c, &shifts.Series{Status: shifts.ScheduledStatus, ExDates: []time.Time{}})
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := series.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Created series %s", series.Title)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/series/%d", series.ID))
+	})
+	admin.Get("/series/:id", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		series, err := seriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		return authedHandler("series", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			seriesShifts, err := series.Shifts(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			forms, err := intake.GetForms(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			// 0 when the series doesn't have a form
+			intakeFormID := 0
+			if series.IntakeFormID != nil {
+				intakeFormID = *series.IntakeFormID
+			}
+			loc := series.Location()
+			return fiber.Map{
+				"Series":       series,
+				"Assignments":  shifts.Assignments,
+				"IntakeForms":  forms,
+				"IntakeFormID": intakeFormID,
+				"BookingURL":   fmt.Sprintf("%s/book/%d", serverAddress, series.ID),
+				"Shifts":       seriesShifts,
+				"StartsAt":     series.StartsAt.In(loc).Format("2006-01-02T15:04"),
+				"EndsAt":       series.EndsAt.In(loc).Format("2006-01-02T15:04"),
+			}, nil
+		})(c)
+	})
+	admin.Post("/series/:id", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		series, err := seriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		if series.Status != shifts.ScheduledStatus {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("series %d has been stopped", series.ID))
+		}
+		if series, err = seriesFromForm(c, series); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := series.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Updated series %s", series.Title)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/series/%d", series.ID))
+	})
+	admin.Post("/series/:id/skip", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		series, err := seriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		occurrence, err := time.Parse(time.RFC3339, c.FormValue("occurrence"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid occurrence %q: %w", c.FormValue("occurrence"), err))
+		}
+		if err := series.Exclude(c.UserContext(), occurrence, pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Removed the %s occurrence", middleware.CurrentUser(c).LocalTime(occurrence))); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/series/%d", series.ID))
+	})
+	admin.Post("/series/:id/stop", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		series, err := seriesFromParams(c, pool)
+		if series == nil {
+			return err
+		}
+		if err := series.Stop(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Stopped series %s and cancelled its upcoming shifts", series.Title)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/series/%d", series.ID))
+	})
+
+	admin.Get("/volunteers", middleware.NewPermissionValidator(users.ViewUsersPermission), func(c *fiber.Ctx) error {
+		return authedHandler("volunteers", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			vols, err := users.GetAllVolunteers(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, fmt.Errorf("failed to get volunteers: %w", err)
+			}
+			if err := users.LoadRoles(ctx.Context(), vols, pool); err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Volunteers": vols,
+			}, nil
+		})(c)
+	})
+	admin.Post("/volunteer", middleware.NewPermissionValidator(users.InviteUsersPermission), func(c *fiber.Ctx) error {
+		// create volunteer & invite
+		// don't have stytch ID at this point, so passing an empty string
+		volunteer, err := users.NewVolunteer(c.FormValue("name"), c.FormValue("email"), "", users.PendingStatus)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+
+		// TODO: someday this should be handled async as it causes a fairly long delay before the browser gets a response
+		if err := volunteer.Invite(c.UserContext(), serverAddress, mailClient, engine, pool, authClient); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Invitation sent to %s", volunteer.Email)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/volunteers")
+	})
+	// bulk CSV import. uploads are previewed before anything is changed
+	importPermissions := middleware.NewPermissionValidator(users.InviteUsersPermission, users.ManageUsersPermission)
+	admin.Get("/import", importPermissions, func(c *fiber.Ctx) error {
+		return authedHandler("import", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			imports, err := users.GetImports(ctx.Context(), 20, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Imports": imports,
+				"MaxRows": users.MaxImportRows,
+			}, nil
+		})(c)
+	})
+	admin.Post("/import", importPermissions, func(c *fiber.Ctx) error {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("failed to get uploaded file: %w", err))
+		}
+		file, err := header.Open()
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("failed to open uploaded file: %w", err))
+		}
+		defer file.Close()
+		rows, err := users.ParseImport(c.Context(), file, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		imp, err := users.NewImport(c.Context(), middleware.CurrentUser(c).ID, header.Filename, rows, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/import/%d", imp.ID))
+	})
+	admin.Get("/import/:id", importPermissions, func(c *fiber.Ctx) error {
+		return authedHandler("import_preview", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			id, err := ctx.ParamsInt("id")
+			if err != nil {
+				return fiber.Map{}, fmt.Errorf("invalid import ID: %w", err)
+			}
+			imp, err := users.GetImportByID(ctx.Context(), id, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			if imp == nil {
+				return fiber.Map{}, fmt.Errorf("import with ID %d not found", id)
+			}
+			return fiber.Map{
+				"Import": imp,
+				"Counts": imp.Counts(),
+			}, nil
+		})(c)
+	})
+	admin.Post("/import/:id/run", importPermissions, func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid import ID: %w", err))
+		}
+		imp, err := users.GetImportByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if imp == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("import with ID %d not found", id))
+		}
+		if err := imp.Start(c.Context(), pool); err != nil {
+			return utils.RenderError(c, http.StatusConflict, err)
+		}
+		// invitations take a while to send, so they're sent after responding.
+		// the request's context can't be used once the response is sent
+		actorID := middleware.CurrentUser(c).ID
+		go func() {
+			ctx := audit.WithActor(context.Background(), actorID)
+			if err := imp.Run(ctx, serverAddress, mailClient, engine, pool, authClient); err != nil {
+				fmt.Println(fmt.Errorf("failed to run import %d: %w", imp.ID, err))
+			}
+		}()
+		if err := flash.Queue(c, store, flash.SuccessLevel, "Import started. Refresh this page to see each row's result"); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/import/%d", imp.ID))
+	})
+	admin.Post("/user/:id/role", middleware.NewPermissionValidator(users.ManageUsersPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid user ID: %w", err))
+		}
+		role, err := users.ParseType(c.FormValue("role"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		user, err := users.GetUserByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("user with ID %d not found", id))
+		}
+		if err := user.LoadRoles(c.Context(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		switch c.FormValue("action") {
+		case "grant":
+			err = user.GrantRole(c.UserContext(), role, pool)
+		case "revoke":
+			err = user.RevokeRole(c.UserContext(), role, pool)
+		default:
+			err = fmt.Errorf("unknown role action %q", c.FormValue("action"))
+		}
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Updated roles for %s", user.Email)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/volunteers")
+	})
+
+	admin.Get("/pipeline", middleware.NewPermissionValidator(users.ViewUsersPermission), func(c *fiber.Ctx) error {
+		return authedHandler("pipeline", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			counts, err := users.CountStages(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			stages := make([]fiber.Map, len(users.Stages))
+			for i, stage := range users.Stages {
+				stages[i] = fiber.Map{
+					"Stage": stage,
+					"Count": counts[stage],
+				}
+			}
+			// every recruit is listed unless a stage is picked
+			stage := users.UndefinedStage
+			if s := ctx.Query("stage"); len(s) > 0 {
+				if stage, err = users.ParseStage(s); err != nil {
+					return fiber.Map{}, err
+				}
+			}
+			recruits, total, err := users.FindUsers(ctx.Context(), users.Filter{
+				Type:  users.RecruitType,
+				Stage: stage,
+				Limit: 200,
+			}, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Stages":   stages,
+				"Stage":    stage,
+				"Recruits": recruits,
+				"Total":    total,
+			}, nil
+		})(c)
+	})
+
+	admin.Get("/intake-forms", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("intake_forms", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			forms, err := intake.GetForms(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Forms": forms,
+			}, nil
+		})(c)
+	})
+	admin.Post("/intake-forms", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		form, err := intake.NewForm(c.FormValue("name"), c.FormValue("description"), nil)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := form.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Created intake form %s. Add its questions below", form.Name)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/intake-forms/%d", form.ID))
+	})
+	admin.Get("/intake-forms/:id", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		form, err := intakeFormFromParams(c, pool)
+		if form == nil {
+			return err
+		}
+		return authedHandler("intake_form", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			// a few blank rows for adding questions
+			rows := append([]*intake.Field{}, form.Fields...)
+			for i := 0; i < 3; i++ {
+				rows = append(rows, &intake.Field{Type: intake.TextFieldType})
+			}
+			return fiber.Map{
+				"Form":       form,
+				"Rows":       rows,
+				"FieldTypes": intake.FieldTypes,
+			}, nil
+		})(c)
+	})
+	admin.Post("/intake-forms/:id", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		form, err := intakeFormFromParams(c, pool)
+		if form == nil {
+			return err
+		}
+		fields, err := intakeFieldsFromForm(c)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		form.Name = c.FormValue("name")
+		form.Description = c.FormValue("description")
+		form.Fields = fields
+		if err := form.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Saved intake form %s", form.Name)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/intake-forms/%d", form.ID))
+	})
+	admin.Post("/intake-forms/:id/delete", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		form, err := intakeFormFromParams(c, pool)
+		if form == nil {
+			return err
+		}
+		if err := form.Delete(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Deleted intake form %s", form.Name)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/intake-forms")
+	})
+
+	admin.Get("/tokens", middleware.NewPermissionValidator(users.ManageTokensPermission), func(c *fiber.Ctx) error {
+		return authedHandler("tokens", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			return tokensPageArgs(ctx, pool)
+		})(c)
+	})
+	admin.Post("/tokens", middleware.NewPermissionValidator(users.ManageTokensPermission), func(c *fiber.Ctx) error {
+		current := middleware.CurrentUser(c)
+		// one checkbox per scope, each submitted under the same name
+		var scopes []users.Permission
+		for _, scope := range c.Context().PostArgs().PeekMulti("scopes") {
+			scopes = append(scopes, users.Permission(scope))
+		}
+		// tokens act as the admin creating them, so they can't be granted more than the admin holds
+		for _, scope := range scopes {
+			if !current.HasPermission(scope) {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("cannot grant the %q scope", scope))
+			}
+		}
+		token, secret, err := tokens.New(c.UserContext(), current.ID, c.FormValue("name"), scopes, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		// rendered directly rather than redirecting, so the secret is never stored in the session
+		return authedHandler("tokens", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			args, err := tokensPageArgs(ctx, pool)
+			if err != nil {
+				return args, err
+			}
+			args["NewToken"] = token
+			args["NewSecret"] = secret
+			return args, nil
+		})(c)
+	})
+	admin.Post("/tokens/:id/revoke", middleware.NewPermissionValidator(users.ManageTokensPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid token ID: %w", err))
+		}
+		token, err := tokens.GetTokenByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if token == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("token with ID %d not found", id))
+		}
+		if err := token.Revoke(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Revoked token %q", token.Name)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/tokens")
+	})
+
+	admin.Get("/webhooks", middleware.NewPermissionValidator(users.ManageWebhooksPermission), func(c *fiber.Ctx) error {
+		return authedHandler("webhooks", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			subs, err := webhooks.GetSubscriptions(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Subscriptions": subs,
+				"Events":        webhooks.Events,
+			}, nil
+		})(c)
+	})
+	admin.Post("/webhooks", middleware.NewPermissionValidator(users.ManageWebhooksPermission), func(c *fiber.Ctx) error {
+		// one checkbox per event, each submitted under the same name
+		var events []string
+		for _, event := range c.Context().PostArgs().PeekMulti("events") {
+			events = append(events, string(event))
+		}
+		sub, err := webhooks.NewSubscription(c.FormValue("url"), events)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := sub.Update(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Added webhook for %s", sub.URL)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/webhooks")
+	})
+	admin.Post("/webhooks/:id/:action", middleware.NewPermissionValidator(users.ManageWebhooksPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid webhook ID: %w", err))
+		}
+		sub, err := webhooks.GetSubscriptionByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if sub == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("webhook with ID %d not found", id))
+		}
+		var msg string
+		switch c.Params("action") {
+		case "toggle":
+			sub.Active = !sub.Active
+			err = sub.Update(c.UserContext(), pool)
+			msg = fmt.Sprintf("Paused webhook for %s", sub.URL)
+			if sub.Active {
+				msg = fmt.Sprintf("Resumed webhook for %s", sub.URL)
+			}
+		case "delete":
+			err = sub.Delete(c.UserContext(), pool)
+			msg = fmt.Sprintf("Deleted webhook for %s", sub.URL)
+		default:
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("unknown webhook action %q", c.Params("action")))
+		}
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, msg); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/webhooks")
+	})
+	admin.Get("/embeds", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		return authedHandler("embeds", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			origins, err := embeds.GetOrigins(ctx.Context(), pool)
+			if err != nil {
+				return nil, err
+			}
+			all, err := shifts.GetAllSeries(ctx.Context(), pool)
+			if err != nil {
+				return nil, err
+			}
+			type snippet struct {
+				Series *shifts.Series
+				HTML   string
+			}
+			var snippets []snippet
+			for _, series := range all {
+				if !series.PublicBooking || series.Status != shifts.ScheduledStatus {
+					continue
+				}
+				snippets = append(snippets, snippet{
+					Series: series,
+					HTML: fmt.Sprintf(
+						`<div class="scheduler-booking" data-series="%d"><iframe src="%s/embed/%d" title="Book a call" width="100%%" height="480" style="border:0"></iframe></div>`+
+							"\n"+`<script src="%s/embed.js" async></script>`,
+						series.ID,
+						serverAddress,
+						series.ID,
+						serverAddress,
+					),
+				})
+			}
+			return fiber.Map{
+				"Origins":  origins,
+				"Snippets": snippets,
+			}, nil
+		})(c)
+	})
+	admin.Post("/embeds", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		origin, err := embeds.NewOrigin(c.FormValue("origin"))
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		err = origin.Update(c.UserContext(), pool)
+		switch {
+		case errors.Is(err, embeds.ErrOriginExists):
+			return utils.RenderError(c, http.StatusConflict, fmt.Errorf("%s is already allowed", origin.Origin))
+		case err != nil:
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Allowed %s to embed booking pages", origin.Origin)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/embeds")
+	})
+	admin.Post("/embeds/:id/delete", middleware.NewPermissionValidator(users.ManageShiftsPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid embed origin ID: %w", err))
+		}
+		origin, err := embeds.GetOriginByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if origin == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("embed origin with ID %d not found", id))
+		}
+		if err := origin.Delete(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Removed %s", origin.Origin)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect("/admin/embeds")
+	})
+	admin.Get("/webhook-deliveries", middleware.NewPermissionValidator(users.ManageWebhooksPermission), func(c *fiber.Ctx) error {
+		return authedHandler("webhook_deliveries", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			filter := webhooks.DeliveryFilter{
+				Event: ctx.Query("event"),
+				Limit: 500,
+			}
+			var err error
+			if sub := ctx.Query("subscription"); len(sub) > 0 {
+				if filter.SubscriptionID, err = strconv.Atoi(sub); err != nil {
+					return fiber.Map{}, fmt.Errorf("invalid subscription ID %q: %w", sub, err)
+				}
+			}
+			if status := ctx.Query("status"); len(status) > 0 {
+				if filter.Status, err = webhooks.ParseStatus(status); err != nil {
+					return fiber.Map{}, err
+				}
+			}
+			deliveries, err := webhooks.ListDeliveries(ctx.Context(), filter, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Deliveries":   deliveries,
+				"Events":       webhooks.Events,
+				"Statuses":     []webhooks.Status{webhooks.PendingStatus, webhooks.SucceededStatus, webhooks.FailedStatus},
+				"Subscription": ctx.Query("subscription"),
+				"Event":        ctx.Query("event"),
+				"Status":       ctx.Query("status"),
+				"LimitReached": len(deliveries) >= filter.Limit,
+			}, nil
+		})(c)
+	})
+	admin.Post("/webhook-deliveries/:id/retry", middleware.NewPermissionValidator(users.ManageWebhooksPermission), func(c *fiber.Ctx) error {
+		id, err := c.ParamsInt("id")
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid delivery ID: %w", err))
+		}
+		delivery, err := webhooks.GetDeliveryByID(c.Context(), id, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if delivery == nil {
+			return utils.RenderError(c, http.StatusNotFound, fmt.Errorf("delivery with ID %d not found", id))
+		}
+		if err := delivery.Retry(c.UserContext(), pool); err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		if err := flash.Queue(c, store, flash.SuccessLevel, fmt.Sprintf("Queued delivery %d to be sent again", delivery.ID)); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Redirect(fmt.Sprintf("/admin/webhook-deliveries?subscription=%d", delivery.SubscriptionID))
+	})
+
+	admin.Get("/audit", middleware.NewPermissionValidator(users.ViewAuditPermission), func(c *fiber.Ctx) error {
+		return authedHandler("audit", func(ctx *fiber.Ctx) (fiber.Map, error) {
+			filter, err := auditFilterFromQuery(ctx)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			filter.Limit = 500
+			events, err := audit.List(ctx.Context(), filter, pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			actions, err := audit.Actions(ctx.Context(), pool)
+			if err != nil {
+				return fiber.Map{}, err
+			}
+			return fiber.Map{
+				"Events":       events,
+				"Actions":      actions,
+				"Query":        ctx.Request().URI().QueryArgs().String(),
+				"ActorID":      ctx.Query("actor"),
+				"Action":       ctx.Query("action"),
+				"TargetType":   ctx.Query("target_type"),
+				"TargetID":     ctx.Query("target_id"),
+				"From":         ctx.Query("from"),
+				"To":           ctx.Query("to"),
+				"LimitReached": len(events) >= filter.Limit,
+			}, nil
+		})(c)
+	})
+	admin.Get("/audit.csv", middleware.NewPermissionValidator(users.ViewAuditPermission), func(c *fiber.Ctx) error {
+		filter, err := auditFilterFromQuery(c)
+		if err != nil {
+			return utils.RenderError(c, http.StatusBadRequest, err)
+		}
+		events, err := audit.List(c.Context(), filter, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="audit-%s.csv"`, time.Now().UTC().Format("2006-01-02")))
+		return audit.WriteCSV(c, events)
+	})
+
+	admin.Get("/schedule.csv", middleware.NewPermissionValidator(users.ViewUsersPermission, users.ViewAllBookingsPermission), func(c *fiber.Ctx) error {
+		from, to := time.Now(), time.Now().AddDate(0, 0, 30)
+		// dates are days in the admin's time zone
+		loc := middleware.CurrentUser(c).Location()
+		var err error
+		if f := c.Query("from"); len(f) > 0 {
+			if from, err = time.ParseInLocation("2006-01-02", f, loc); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid from date %q: %w", f, err))
+			}
+		}
+		if t := c.Query("to"); len(t) > 0 {
+			if to, err = time.ParseInLocation("2006-01-02", t, loc); err != nil {
+				return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid to date %q: %w", t, err))
+			}
+			// include the whole day
+			to = to.AddDate(0, 0, 1)
+		}
+		if !to.After(from) {
+			return utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("to date must be after from date"))
+		}
+		entries, err := schedule.Get(c.Context(), from, to, pool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="schedule-%s.csv"`, from.In(loc).Format("2006-01-02")))
+		return schedule.WriteCSV(c, entries)
+	})
+
+	return app.Listen(":3000")
+}
+
+// suggested on the profile page. any IANA time zone is accepted
+var commonTimeZones = []string{
+	"America/New_York",
+	"America/Chicago",
+	"America/Denver",
+	"America/Phoenix",
+	"America/Los_Angeles",
+	"America/Anchorage",
+	"Pacific/Honolulu",
+	"America/Puerto_Rico",
+	"UTC",
+}
+
+// weekday options for availability forms, starting on Monday
+var weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// an upcoming shift as shown to a volunteer
+type shiftRow struct {
+	Shift *shifts.Shift
+	// whether the shift falls within the volunteer's weekly availability and not on a blackout date
+	Available bool
+	SignedUp  bool
+	// whether every spot is taken or held for someone on the waitlist
+	Full bool
+	// the volunteer's place on the shift's waitlist, if they're on it
+	Waitlist *shifts.WaitlistEntry
+	// the volunteer's open request for someone to cover the shift, if any
+	Coverage *coverage.Request
+}
+
+// returns the scheduled shifts over the next four weeks, marked with whether they suit the user
+func shiftRows(ctx context.Context, userID int, pool *pgxpool.Pool) ([]*shiftRow, error) {
+	upcoming, _, err := shifts.FindShifts(ctx, shifts.Filter{
+		From:   time.Now(),
+		To:     time.Now().AddDate(0, 0, 28),
+		Status: shifts.ScheduledStatus,
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := shifts.LoadVolunteers(ctx, upcoming, pool); err != nil {
+		return nil, err
+	}
+	a, err := availability.Get(ctx, userID, pool)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(upcoming))
+	for i, shift := range upcoming {
+		ids[i] = shift.ID
+	}
+	held, err := shifts.CountHeldSpots(ctx, ids, pool)
+	if err != nil {
+		return nil, err
+	}
+	waitlisted, err := shifts.GetWaitlistEntries(ctx, userID, ids, pool)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := coverage.GetActive(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	requested := map[int]*coverage.Request{}
+	for _, r := range requests {
+		if r.RequesterID == userID {
+			requested[r.ShiftID] = r
+		}
+	}
+	rows := make([]*shiftRow, len(upcoming))
+	for i, shift := range upcoming {
+		row := &shiftRow{
+			Shift:     shift,
+			Available: a.Covers(shift.StartsAt, shift.EndsAt),
+			Full:      shift.Capacity > 0 && len(shift.VolunteerIDs)+held[shift.ID] >= shift.Capacity,
+			Coverage:  requested[shift.ID],
+		}
+		// an expired offer is as good as gone, and is cleared the next time the waitlist moves
+		if entry := waitlisted[shift.ID]; entry != nil && (entry.OfferedAt == nil || entry.IsOffered(time.Now())) {
+			row.Waitlist = entry
+		}
+		for _, id := range shift.VolunteerIDs {
+			if id == userID {
+				row.SignedUp = true
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// most upcoming calls shown on the dashboard. the rest are on the calls page
+const dashCallsLimit = 5
+
+// a booked call as shown to its volunteer on the calls page
+type callRow struct {
+	Booking *bookings.Booking
+	Shift   *shifts.Shift
+	// nil if the recruit's user has since been deleted
+	Recruit *users.User
+}
+
+// returns the calls matching the filter, soonest first, along with their shifts and recruits
+func callRows(ctx context.Context, filter bookings.Filter, pool *pgxpool.Pool) ([]*callRow, error) {
+	booked, _, err := bookings.FindBookings(ctx, filter, pool)
+	if err != nil {
+		return nil, err
+	}
+	var shiftIDs, userIDs []int
+	for _, b := range booked {
+		shiftIDs = append(shiftIDs, b.ShiftID)
+		userIDs = append(userIDs, b.RecruitID)
+	}
+	byShift, err := shifts.GetShiftsByIDs(ctx, shiftIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+	byUser, err := users.GetUsersByIDs(ctx, userIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*callRow, len(booked))
+	for i, b := range booked {
+		rows[i] = &callRow{
+			Booking: b,
+			Shift:   byShift[b.ShiftID],
+			Recruit: byUser[b.RecruitID],
+		}
+	}
+	return rows, nil
+}
+
+// a coverage request as shown on the coverage page
+type coverageRow struct {
+	Request   *coverage.Request
+	Shift     *shifts.Shift
+	Requester *users.User
+	// the volunteer who accepted the request, if any
+	AcceptedBy *users.User
+}
+
+// returns the open and pending coverage requests for upcoming shifts, along with their shifts and volunteers
+func coverageRows(ctx context.Context, pool *pgxpool.Pool) ([]*coverageRow, error) {
+	requests, err := coverage.GetActive(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	var shiftIDs, userIDs []int
+	for _, r := range requests {
+		shiftIDs = append(shiftIDs, r.ShiftID)
+		userIDs = append(userIDs, r.RequesterID)
+		if r.AcceptedBy != nil {
+			userIDs = append(userIDs, *r.AcceptedBy)
+		}
+	}
+	byShift, err := shifts.GetShiftsByIDs(ctx, shiftIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+	byUser, err := users.GetUsersByIDs(ctx, userIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*coverageRow, len(requests))
+	for i, r := range requests {
+		rows[i] = &coverageRow{
+			Request:   r,
+			Shift:     byShift[r.ShiftID],
+			Requester: byUser[r.RequesterID],
+		}
+		if r.AcceptedBy != nil {
+			rows[i].AcceptedBy = byUser[*r.AcceptedBy]
+		}
+	}
+	return rows, nil
+}
+
+// reports whether the error is a coverage request that can't go ahead as things stand, rather than something going wrong
+func isCoverageConflict(err error) bool {
+	for _, target := range []error{
+		coverage.ErrNotOpen,
+		coverage.ErrNotPending,
+		coverage.ErrOwnRequest,
+		coverage.ErrVolunteerBusy,
+		shifts.ErrNotOnShift,
+		shifts.ErrAlreadyOnShift,
+		bookings.ErrVolunteerBusy,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// gets the series identified by the id route param. renders an error and returns a nil series if it can't be found
+func seriesFromParams(c *fiber.Ctx, pool *pgxpool.Pool) (*shifts.Series, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid series ID %q: %w", c.Params("id"), err))
+	}
+	series, err := shifts.GetSeriesByID(c.Context(), id, pool)
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	if series == nil {
+		return nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("series with ID %d not found", id))
+	}
+	return series, nil
+}
+
+// applies the fields of a series form to series
+func seriesFromForm(c *fiber.Ctx, series *shifts.Series) (*shifts.Series, error) {
+	loc, err := time.LoadLocation(c.FormValue("time_zone"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", c.FormValue("time_zone"), err)
+	}
+	startsAt, err := time.ParseInLocation("2006-01-02T15:04", c.FormValue("starts_at"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time %q: %w", c.FormValue("starts_at"), err)
+	}
+	endsAt, err := time.ParseInLocation("2006-01-02T15:04", c.FormValue("ends_at"), loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end time %q: %w", c.FormValue("ends_at"), err)
+	}
+	capacity := 0
+	if value := c.FormValue("capacity"); len(value) > 0 {
+		if capacity, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid capacity %q: %w", value, err)
+		}
+	}
+	updated, err := shifts.NewSeries(c.FormValue("title"), startsAt, endsAt, c.FormValue("time_zone"), capacity, c.FormValue("rrule"))
+	if err != nil {
+		return nil, err
+	}
+	if updated.Assignment, err = assignmentFromForm(c); err != nil {
+		return nil, err
+	}
+	if updated.IntakeFormID, err = intakeFormIDFromForm(c); err != nil {
+		return nil, err
+	}
+	updated.PublicBooking = len(c.FormValue("public_booking")) > 0
+	updated.ID = series.ID
+	updated.Status = series.Status
+	updated.ExDates = series.ExDates
+	return updated, nil
+}
+
+// parses the assignment field of a shift or series form, defaulting to round robin
+func assignmentFromForm(c *fiber.Ctx) (shifts.Assignment, error) {
+	value := c.FormValue("assignment")
+	if len(value) < 1 {
+		return shifts.RoundRobinAssignment, nil
+	}
+	return shifts.ParseAssignment(value)
+}
+
+// parses the intake form field of a shift or series form. empty means no form
+func intakeFormIDFromForm(c *fiber.Ctx) (*int, error) {
+	value := c.FormValue("intake_form_id")
+	if len(value) < 1 {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		return nil, fmt.Errorf("invalid intake form %q", value)
+	}
+	return &id, nil
+}
+
+// retrieves the intake form identified by the id route param, rendering an error if it can't be found.
+// returns nil when an error was rendered
+func intakeFormFromParams(c *fiber.Ctx, pool *pgxpool.Pool) (*intake.Form, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid intake form ID: %w", err))
+	}
+	form, err := intake.GetFormByID(c.Context(), id, pool)
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	if form == nil {
+		return nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("intake form with ID %d not found", id))
+	}
+	return form, nil
+}
+
+// reads the field rows of the intake form editor. each column is submitted once per row under the same name,
+// except required, which is only submitted for checked rows and holds the row's index. rows without a key or
+// label are dropped, which is how fields are removed
+func intakeFieldsFromForm(c *fiber.Ctx) ([]*intake.Field, error) {
+	args := c.Context().PostArgs()
+	column := func(name string) []string {
+		var values []string
+		for _, v := range args.PeekMulti(name) {
+			values = append(values, string(v))
+		}
+		return values
+	}
+	keys, labels, types, helps, options := column("key"), column("label"), column("type"), column("help"), column("options")
+	if len(labels) != len(keys) || len(types) != len(keys) || len(helps) != len(keys) || len(options) != len(keys) {
+		return nil, fmt.Errorf("every field row must have a key, label, type, help and options")
+	}
+	required := map[string]bool{}
+	for _, i := range column("required") {
+		required[i] = true
+	}
+	fields := []*intake.Field{}
+	for i := range keys {
+		if len(strings.TrimSpace(keys[i])) < 1 && len(strings.TrimSpace(labels[i])) < 1 {
+			continue
+		}
+		fieldType, err := intake.ParseFieldType(types[i])
+		if err != nil {
+			return nil, err
+		}
+		field := &intake.Field{
+			Key:      strings.ToLower(strings.TrimSpace(keys[i])),
+			Label:    labels[i],
+			Type:     fieldType,
+			Help:     helps[i],
+			Required: required[strconv.Itoa(i)],
+		}
+		// one option per line, since options may contain commas
+		if fieldType.HasOptions() {
+			field.Options = strings.Split(strings.ReplaceAll(options[i], "\r\n", "\n"), "\n")
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// lists every API token, along with the scopes the current user is able to grant
+func tokensPageArgs(c *fiber.Ctx, pool *pgxpool.Pool) (fiber.Map, error) {
+	allTokens, err := tokens.GetTokens(c.Context(), pool)
+	if err != nil {
+		return fiber.Map{}, err
+	}
+	current := middleware.CurrentUser(c)
+	scopes := []users.Permission{}
+	for _, permission := range users.AllPermissions() {
+		if current.HasPermission(permission) {
+			scopes = append(scopes, permission)
+		}
+	}
+	return fiber.Map{
+		"Tokens": allTokens,
+		"Scopes": scopes,
+	}, nil
+}
+
+// builds an audit filter from the query params used by the audit log page. dates are days in the current user's
+// time zone
+func auditFilterFromQuery(c *fiber.Ctx) (audit.Filter, error) {
+	filter := audit.Filter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+	}
+	loc := middleware.CurrentUser(c).Location()
+	var err error
+	if actor := c.Query("actor"); len(actor) > 0 {
+		if filter.ActorID, err = strconv.Atoi(actor); err != nil {
+			return filter, fmt.Errorf("invalid actor ID %q: %w", actor, err)
+		}
+	}
+	if target := c.Query("target_id"); len(target) > 0 {
+		if filter.TargetID, err = strconv.Atoi(target); err != nil {
+			return filter, fmt.Errorf("invalid target ID %q: %w", target, err)
+		}
+	}
+	if from := c.Query("from"); len(from) > 0 {
+		if filter.From, err = time.ParseInLocation("2006-01-02", from, loc); err != nil {
+			return filter, fmt.Errorf("invalid from date %q: %w", from, err)
+		}
+	}
+	if to := c.Query("to"); len(to) > 0 {
+		if filter.To, err = time.ParseInLocation("2006-01-02", to, loc); err != nil {
+			return filter, fmt.Errorf("invalid to date %q: %w", to, err)
+		}
+		// include the whole day
+		filter.To = filter.To.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
+
+func main() {
+	if err := setup(); err != nil {
+		log.Fatal("failed to setup app: " + err.Error())
+	}
+}
+
+func getX509CertFromFiles() (tls.Certificate, error) {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	pubKeyPath := os.Getenv("PUBLIC_KEY_PATH")
+	privateKeyPath := os.Getenv("PRIVATE_KEY_PATH")
+	if len(pubKeyPath) > 0 && len(privateKeyPath) > 0 {
+		cert, err = tls.LoadX509KeyPair(pubKeyPath, privateKeyPath)
+		if err != nil {
+			return cert, fmt.Errorf("failed to load cert keypair: %w", err)
+		}
+		return cert, nil
+	}
+	return cert, fmt.Errorf("missing or empty env variables PUBLIC_KEY_PATH and PRIVATE_KEY_PATH")
+}
+
+func getX509Cert() (tls.Certificate, error) {
+	pubKey := os.Getenv("PUBLIC_KEY")
+	privateKey := os.Getenv("PRIVATE_KEY")
+	if len(pubKey) > 0 && len(privateKey) > 0 {
+		cert, err := tls.X509KeyPair([]byte(pubKey), []byte(privateKey))
+		if err != nil {
+			return getX509CertFromFiles()
+		}
+		return cert, nil
+	}
+	return getX509CertFromFiles()
+}
+
+// limits how often each IP address can request public pages. name keeps each limiter's counts separate
+func newPublicLimiter(name string, max int, expiration time.Duration, storage fiber.Storage) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: expiration,
+		Storage:    storage,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "limit:" + name + ":" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return utils.RenderError(c, http.StatusTooManyRequests, fmt.Errorf("too many requests. try again later"))
+		},
+	})
+}
+
+// retrieves the series identified by the id route param for its public booking page, rendering an error if it
+// can't be booked publicly. returns nil when an error was rendered
+func publicSeriesFromParams(c *fiber.Ctx, pool *pgxpool.Pool) (*shifts.Series, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusBadRequest, fmt.Errorf("invalid booking page: %w", err))
+	}
+	series, err := shifts.GetSeriesByID(c.Context(), id, pool)
+	if err != nil {
+		return nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	// series that aren't public are reported as missing so their IDs can't be probed
+	if series == nil || !series.PublicBooking || series.Status != shifts.ScheduledStatus {
+		return nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("booking page not found"))
+	}
+	return series, nil
+}
+
+// how far ahead the public booking page offers calls
+const publicBookingWindow = 28 * 24 * time.Hour
+
+// a day of open slots on the public booking page. also returned as JSON to the embeddable widget
+type publicBookingDay struct {
+	Label string              `json:"label"`
+	Slots []publicBookingSlot `json:"slots"`
+}
+
+type publicBookingSlot struct {
+	// identifies the shift and start time when the form is submitted
+	Value    string    `json:"value"`
+	Label    string    `json:"label"`
+	StartsAt time.Time `json:"starts_at"`
+}
+
+// returns the series' upcoming shifts that can be booked from its public page. shifts that have been given a
+// different intake form than the series are left out, since the page only asks the series' questions
+func publicShifts(ctx context.Context, series *shifts.Series, pool *pgxpool.Pool) ([]*shifts.Shift, error) {
+	all, err := series.Shifts(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var bookable []*shifts.Shift
+	for _, shift := range all {
+		if shift.Status != shifts.ScheduledStatus || !shift.EndsAt.After(now) || shift.StartsAt.After(now.Add(publicBookingWindow)) {
+			continue
+		}
+		if (shift.IntakeFormID == nil) != (series.IntakeFormID == nil) ||
+			(shift.IntakeFormID != nil && *shift.IntakeFormID != *series.IntakeFormID) {
+			continue
+		}
+		bookable = append(bookable, shift)
+	}
+	return bookable, nil
+}
+
+// returns the open slots on the series' bookable shifts, grouped by day in the series' time zone
+func publicBookingDays(ctx context.Context, series *shifts.Series, pool *pgxpool.Pool) ([]*publicBookingDay, error) {
+	bookable, err := publicShifts(ctx, series, pool)
+	if err != nil {
+		return nil, err
+	}
+	loc := series.Location()
+	now := time.Now()
+	days := []*publicBookingDay{}
+	for _, shift := range bookable {
+		slots, err := bookings.Slots(ctx, shift, pool)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range slots {
+			if slot.Available < 1 || !slot.StartsAt.After(now) {
+				continue
+			}
+			label := slot.StartsAt.In(loc).Format("Monday, January 2")
+			if len(days) < 1 || days[len(days)-1].Label != label {
+				days = append(days, &publicBookingDay{Label: label})
+			}
+			day := days[len(days)-1]
+			day.Slots = append(day.Slots, publicBookingSlot{
+				Value:    fmt.Sprintf("%d/%s", shift.ID, slot.StartsAt.UTC().Format(time.RFC3339)),
+				Label:    slot.StartsAt.In(loc).Format("3:04 PM MST"),
+				StartsAt: slot.StartsAt.UTC(),
+			})
+		}
+	}
+	return days, nil
+}
+
+// renders the series' public booking page with its open slots
+func renderBookingPage(c *fiber.Ctx, status int, series *shifts.Series, args fiber.Map, pool *pgxpool.Pool) error {
+	days, err := publicBookingDays(c.Context(), series, pool)
+	if err != nil {
+		return utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	var form *intake.Form
+	if series.IntakeFormID != nil {
+		if form, err = intake.GetFormByID(c.Context(), *series.IntakeFormID, pool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+	}
+	args["Series"] = series
+	args["Days"] = days
+	args["Form"] = form
+	return c.Status(status).Render("book", args)
+}
+
+// parses the slot picked on a public booking page, checking it's an open slot on one of the series' bookable shifts.
+// returns a nil shift when the slot has no volunteers free any more
+func publicSlotFromForm(c *fiber.Ctx, series *shifts.Series, pool *pgxpool.Pool) (*shifts.Shift, time.Time, error) {
+	value := c.FormValue("slot")
+	parts := strings.SplitN(value, "/", 2)
+	if len(value) < 1 || len(parts) != 2 {
+		return nil, time.Time{}, fmt.Errorf("pick a time for your call")
+	}
+	shiftID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	startsAt, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	bookable, err := publicShifts(c.Context(), series, pool)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, shift := range bookable {
+		if shift.ID != shiftID {
+			continue
+		}
+		slots, err := bookings.Slots(c.Context(), shift, pool)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		for _, slot := range slots {
+			if slot.StartsAt.Equal(startsAt) && startsAt.After(time.Now()) {
+				if slot.Available < 1 {
+					return nil, startsAt, nil
+				}
+				return shift, startsAt, nil
+			}
+		}
+	}
+	return nil, time.Time{}, fmt.Errorf("that time can't be booked. pick another one")
+}
+
+// reads the answers to an intake form's fields from a form post. each field is submitted as answer_<key>,
+// with multi_select fields submitted once per picked option
+func intakeResponsesFromForm(c *fiber.Ctx, form *intake.Form) intake.Responses {
+	responses := intake.Responses{}
+	for _, field := range form.Fields {
+		name := "answer_" + field.Key
+		if field.Type == intake.MultiSelectFieldType {
+			var picked []string
+			for _, value := range c.Context().PostArgs().PeekMulti(name) {
+				picked = append(picked, string(value))
+			}
+			if len(picked) > 0 {
+				responses[field.Key] = picked
+			}
+			continue
+		}
+		if value := c.FormValue(name); len(value) > 0 {
+			responses[field.Key] = value
+		}
+	}
+	return responses
+}
+
+// retrieves the booking request identified by the token route param along with its shift and recruit, rendering
+// an error if any of them can't be found. returns a nil request when an error was rendered
+func bookingRequestFromParams(c *fiber.Ctx, pool *pgxpool.Pool) (*bookings.Request, *shifts.Shift, *users.User, error) {
+	req, err := bookings.GetRequestByToken(c.Context(), c.Params("token"), pool)
+	if err != nil {
+		return nil, nil, nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	if req == nil {
+		return nil, nil, nil, utils.RenderError(c, http.StatusNotFound, fmt.Errorf("booking link not found. check you copied the whole link from the email"))
+	}
+	shift, err := shifts.GetShiftByID(c.Context(), req.ShiftID, pool)
+	if err != nil {
+		return nil, nil, nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	recruit, err := users.GetUserByID(c.Context(), req.RecruitID, pool)
+	if err != nil {
+		return nil, nil, nil, utils.RenderError(c, http.StatusInternalServerError, err)
+	}
+	if shift == nil || recruit == nil || recruit.Status == users.DeletedStatus {
+		return nil, nil, nil, utils.RenderError(c, http.StatusGone, bookings.ErrRequestExpired)
+	}
+	return req, shift, recruit, nil
 }
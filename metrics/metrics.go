@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"scheduler/bookings"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// most volunteers listed by TopVolunteers
+const TopVolunteersLimit = 10
+
+// how well scheduled shifts are staffed
+type ShiftFill struct {
+	Shifts int
+	// shifts with a capacity that have no spots left
+	Full int
+	// shifts nobody has signed up for
+	Unstaffed int
+	// total spots on shifts with a capacity, and how many of them are taken. shifts without a capacity are left out
+	Spots  int
+	Filled int
+}
+
+// spots still open on shifts with a capacity
+func (f *ShiftFill) Open() int {
+	return f.Spots - f.Filled
+}
+
+// returns how well the scheduled shifts overlapping the time range are staffed
+func GetShiftFill(ctx context.Context, from time.Time, to time.Time, pool *pgxpool.Pool) (*ShiftFill, error) {
+	var fill ShiftFill
+	if err := pgxscan.Get(
+		ctx,
+		pool,
+		&fill,
+		`select
+			count(*) as shifts,
+			count(*) filter (where s.capacity > 0 and v.volunteers >= s.capacity) as full,
+			count(*) filter (where v.volunteers = 0) as unstaffed,
+			coalesce(sum(s.capacity) filter (where s.capacity > 0), 0) as spots,
+			coalesce(sum(least(v.volunteers, s.capacity)) filter (where s.capacity > 0), 0)::int as filled
+		from shifts s
+		cross join lateral (select count(*) as volunteers from shift_volunteers where shift_id = s.id) v
+		where s.status = $1 and s.ends_at > $2 and s.starts_at < $3`,
+		shifts.ScheduledStatus,
+		from,
+		to,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get shift fill: %w", err)
+	}
+	return &fill, nil
+}
+
+// the calls starting on a day
+type Day struct {
+	Date      time.Time
+	Booked    int
+	Cancelled int
+}
+
+// calls per day over a time range
+type BookingsPerDay struct {
+	Days []*Day
+	// the most calls booked on any one day, for scaling charts
+	Max int
+}
+
+// returns the number of calls starting on each day of the time range, including days without any. days run
+// midnight to midnight in loc
+func GetBookingsPerDay(ctx context.Context, from time.Time, to time.Time, loc *time.Location, pool *pgxpool.Pool) (*BookingsPerDay, error) {
+	var rows []struct {
+		Date      time.Time
+		Booked    int
+		Cancelled int
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&rows,
+		`select
+			(starts_at at time zone $1)::date as date,
+			count(*) filter (where status = $2) as booked,
+			count(*) filter (where status = $3) as cancelled
+		from bookings
+		where starts_at >= $4 and starts_at < $5
+		group by 1`,
+		loc.String(),
+		bookings.BookedStatus,
+		bookings.CancelledStatus,
+		from,
+		to,
+	); err != nil {
+		return nil, fmt.Errorf("failed to count bookings per day: %w", err)
+	}
+	byDate := map[string]*Day{}
+	for _, row := range rows {
+		byDate[row.Date.Format("2006-01-02")] = &Day{
+			Booked:    row.Booked,
+			Cancelled: row.Cancelled,
+		}
+	}
+	var perDay BookingsPerDay
+	from = from.In(loc)
+	for d := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc); d.Before(to); d = d.AddDate(0, 0, 1) {
+		day, ok := byDate[d.Format("2006-01-02")]
+		if !ok {
+			day = &Day{}
+		}
+		day.Date = d
+		if day.Booked > perDay.Max {
+			perDay.Max = day.Booked
+		}
+		perDay.Days = append(perDay.Days, day)
+	}
+	return &perDay, nil
+}
+
+// the outcomes of booked calls
+type Outcomes struct {
+	Completed int
+	FollowUp  int
+	NoShow    int
+	// calls that have started without an outcome being logged yet
+	Awaiting int
+}
+
+// calls with an outcome logged, including ones marked no-shows automatically
+func (o *Outcomes) Logged() int {
+	return o.Completed + o.FollowUp + o.NoShow
+}
+
+// percentage of calls with an outcome that were no-shows, rounded to the nearest whole number
+func (o *Outcomes) NoShowRate() int {
+	if o.Logged() < 1 {
+		return 0
+	}
+	return int(math.Round(float64(o.NoShow) * 100 / float64(o.Logged())))
+}
+
+// returns the outcomes of booked calls that started during the time range
+func GetOutcomes(ctx context.Context, from time.Time, to time.Time, pool *pgxpool.Pool) (*Outcomes, error) {
+	var outcomes Outcomes
+	if err := pgxscan.Get(
+		ctx,
+		pool,
+		&outcomes,
+		`select
+			count(*) filter (where outcome = $1) as completed,
+			count(*) filter (where outcome = $2) as follow_up,
+			count(*) filter (where outcome = $3) as no_show,
+			count(*) filter (where outcome = $4) as awaiting
+		from bookings
+		where status = $5 and starts_at >= $6 and starts_at < $7 and starts_at <= now()`,
+		bookings.CompletedOutcome,
+		bookings.FollowUpOutcome,
+		bookings.NoShowOutcome,
+		bookings.UndefinedOutcome,
+		bookings.BookedStatus,
+		from,
+		to,
+	); err != nil {
+		return nil, fmt.Errorf("failed to count call outcomes: %w", err)
+	}
+	return &outcomes, nil
+}
+
+// the number of people with a status and type who have been invited but haven't signed in yet
+type InviteCount struct {
+	Status users.Status
+	Type   users.Type
+	Count  int
+}
+
+// returns the number of pending and invited users by status and type. deleted users are left out
+func GetPendingInvites(ctx context.Context, pool *pgxpool.Pool) ([]*InviteCount, error) {
+	var pending []*InviteCount
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&pending,
+		`select status, type, count(*) as count from users
+		where status in ($1, $2)
+		group by status, type
+		order by status, type`,
+		users.PendingStatus,
+		users.InvitedStatus,
+	); err != nil {
+		return nil, fmt.Errorf("failed to count pending invites: %w", err)
+	}
+	return pending, nil
+}
+
+// a volunteer's time on shifts
+type VolunteerHours struct {
+	UserID int
+	Name   string
+	Email  string
+	Shifts int
+	Hours  float64
+}
+
+// returns the volunteers who signed up for the most hours of scheduled shifts starting during the time range
+func GetTopVolunteers(ctx context.Context, from time.Time, to time.Time, pool *pgxpool.Pool) ([]*VolunteerHours, error) {
+	var top []*VolunteerHours
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&top,
+		`select
+			u.id as user_id,
+			coalesce(u.name, '') as name,
+			u.email,
+			count(*) as shifts,
+			(sum(extract(epoch from s.ends_at - s.starts_at)) / 3600)::float8 as hours
+		from shift_volunteers sv
+		join shifts s on s.id = sv.shift_id
+		join users u on u.id = sv.user_id
+		where s.status = $1 and s.starts_at >= $2 and s.starts_at < $3
+		group by u.id
+		order by hours desc, u.id
+		limit $4`,
+		shifts.ScheduledStatus,
+		from,
+		to,
+		TopVolunteersLimit,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get top volunteers: %w", err)
+	}
+	return top, nil
+}
+
+// the time a volunteer has spent on shifts
+type HoursServed struct {
+	Shifts int
+	Hours  float64
+}
+
+// returns the scheduled shifts the volunteer was signed up for that ended before the time, and their total hours
+func GetHoursServed(ctx context.Context, userID int, before time.Time, pool *pgxpool.Pool) (*HoursServed, error) {
+	var served HoursServed
+	if err := pgxscan.Get(
+		ctx,
+		pool,
+		&served,
+		`select
+			count(*) as shifts,
+			coalesce(sum(extract(epoch from s.ends_at - s.starts_at)) / 3600, 0)::float8 as hours
+		from shift_volunteers sv
+		join shifts s on s.id = sv.shift_id
+		where sv.user_id = $1 and s.status = $2 and s.ends_at <= $3`,
+		userID,
+		shifts.ScheduledStatus,
+		before,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get hours served: %w", err)
+	}
+	return &served, nil
+}
@@ -4,25 +4,43 @@ import (
 	"fmt"
 	"net/http"
 
+	"scheduler/audit"
+	"scheduler/flash"
+	"scheduler/stytch"
 	"scheduler/users"
 	"scheduler/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-const localsStytchIDKey = "stytch_user_id"
+const (
+	localsStytchIDKey = "stytch_user_id"
+	localsUserKey     = "current_user"
+	// name of the current user value bound to every rendered template
+	templateUserKey = "CurrentUser"
+)
+
+// returns the user loaded by the auth handler for the current request, or nil if the request is unauthenticated
+func CurrentUser(c *fiber.Ctx) *users.User {
+	user, _ := c.Locals(localsUserKey).(*users.User)
+	return user
+}
 
 // if redirectOnError is true, when an error occurs the handler will:
-// - set an auth_error session value, which can optionally be provided to the user
+// - queue an error flash message, which is displayed on the login page
+// - for GET requests, store the original URL to go back to after login
 // - redirect to /login instead of rendering the error page
 func NewAuthHandler(cfg *AppConfig, redirectOnError bool) fiber.Handler {
 	errorHandler := func(ctx *fiber.Ctx, sess *session.Session, err error, statusCode int) error {
-		if redirectOnError {
-			sess.Set("auth_error", err.Error()) // TODO: I don't think this is being displayed anywhere... possibly pass back to UI at /login
-			// set path redirect value to go to after login
-			sess.Set("auth_redirect", ctx.Path())
+		if redirectOnError && sess != nil {
+			if err := flash.Add(sess, flash.ErrorLevel, err.Error()); err != nil {
+				return utils.RenderError(ctx, http.StatusInternalServerError, err)
+			}
+			// set redirect value to go to after login. only GET requests can be replayed by a redirect
+			if ctx.Method() == fiber.MethodGet {
+				sess.Set("auth_redirect", ctx.OriginalURL())
+			}
 			if err := sess.Save(); err != nil {
 				return utils.RenderError(ctx, http.StatusInternalServerError, fmt.Errorf("failed to save session data: %w", err))
 			}
@@ -31,6 +49,10 @@ func NewAuthHandler(cfg *AppConfig, redirectOnError bool) fiber.Handler {
 		return utils.RenderError(ctx, statusCode, err)
 	}
 	return func(c *fiber.Ctx) error {
+		// already authenticated, e.g. with an API token by NewTokenAuthHandler
+		if CurrentUser(c) != nil {
+			return c.Next()
+		}
 		sess, err := cfg.SessionStore.Get(c)
 		if err != nil {
 			return errorHandler(c, sess, err, http.StatusInternalServerError)
@@ -39,38 +61,97 @@ func NewAuthHandler(cfg *AppConfig, redirectOnError bool) fiber.Handler {
 		if !ok || len(sessToken) < 1 {
 			return errorHandler(c, sess, fmt.Errorf("unable to authenticate: session token not found"), http.StatusUnauthorized)
 		}
-		// validate session token
-		userID, err := cfg.AuthClient.AuthenticateSession(c.Context(), sessToken, cfg.Storage)
+		sessJWT, _ := sess.Get("session_jwt").(string)
+		// validate session
+		userID, refreshed, err := cfg.AuthClient.AuthenticateSession(c.Context(), stytch.Session{
+			Token: sessToken,
+			JWT:   sessJWT,
+		})
 		if err != nil {
 			return errorHandler(c, sess, err, http.StatusUnauthorized)
 		}
+		// load the user once for the rest of the request
+		user, err := users.GetUserByStytchID(c.Context(), userID, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to get user: %w", err))
+		}
+		if user == nil {
+			return errorHandler(c, sess, fmt.Errorf("unable to authenticate: user not found"), http.StatusUnauthorized)
+		}
+		switch user.Status {
+		case users.DeletedStatus, users.InactiveStatus, users.UndefinedStatus:
+			return errorHandler(c, sess, fmt.Errorf("unable to authenticate: user is %s", user.Status.String()), http.StatusForbidden)
+		}
+		if err := user.LoadRoles(c.Context(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		// the session is only refreshed when it had to be checked with the auth provider's API.
+		// saving releases the session, so this happens after the last possible use of errorHandler
+		if refreshed.Token != sessToken || refreshed.JWT != sessJWT {
+			sess.Set("session_token", refreshed.Token)
+			sess.Set("session_jwt", refreshed.JWT)
+			if err := sess.Save(); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to save session data: %w", err))
+			}
+		}
 		c.Locals(localsStytchIDKey, userID)
+		if err := setCurrentUser(c, user); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
 		fmt.Printf("successfully authenticated session for user %s\n", userID)
 		return c.Next()
 	}
 }
 
-// check if user has correct type to access the next route
-func NewTypeValidator(expectedType users.Type, pool *pgxpool.Pool) fiber.Handler {
+// makes the user available to the rest of the request via CurrentUser and templates
+func setCurrentUser(c *fiber.Ctx, user *users.User) error {
+	c.Locals(localsUserKey, user)
+	// changes made with the user context are attributed to the current user in the audit log
+	c.SetUserContext(audit.WithActor(c.UserContext(), user.ID))
+	if err := c.Bind(fiber.Map{templateUserKey: user}); err != nil {
+		return fmt.Errorf("failed to bind current user: %w", err)
+	}
+	return nil
+}
+
+// check if user has every one of the provided permissions to access the next route.
+// must be used after the handler returned by NewAuthHandler
+func NewPermissionValidator(permissions ...users.Permission) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		stytchUserID, ok := c.Locals(localsStytchIDKey).(string)
-		if !ok {
-			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("unable to retrieve user local value"))
+		user := CurrentUser(c)
+		if user == nil {
+			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("unable to retrieve current user"))
 		}
-		// get user
-		user, err := users.GetUserByStytchID(c.Context(), stytchUserID, pool)
-		if err != nil {
-			return fmt.Errorf("failed to get user: %w", err)
+		for _, permission := range permissions {
+			if !user.HasPermission(permission) {
+				return utils.RenderError(
+					c,
+					http.StatusForbidden,
+					fmt.Errorf("user with ID %d is missing the %q permission", user.ID, permission),
+				)
+			}
 		}
+		return c.Next()
+	}
+}
 
-		// validate type
-		if expectedType == user.Type {
-			return c.Next()
+// check if user has at least one of the provided permissions to access the next route.
+// must be used after the handler returned by NewAuthHandler
+func NewAnyPermissionValidator(permissions ...users.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := CurrentUser(c)
+		if user == nil {
+			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("unable to retrieve current user"))
+		}
+		for _, permission := range permissions {
+			if user.HasPermission(permission) {
+				return c.Next()
+			}
 		}
 		return utils.RenderError(
 			c,
 			http.StatusForbidden,
-			fmt.Errorf("user with ID %d is not allowed to access %s resources", user.ID, expectedType.String()),
+			fmt.Errorf("user with ID %d is missing all of the %q permissions", user.ID, permissions),
 		)
 	}
 }
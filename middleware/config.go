@@ -1,11 +1,12 @@
 package middleware
 
 import (
+	"scheduler/auth"
 	"scheduler/mail"
-	"scheduler/stytch"
 
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/storage/redis"
+	"github.com/gofiber/template/html"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -13,24 +14,32 @@ import (
 
 type AppConfig struct {
 	SessionStore *session.Store
-	AuthClient   *stytch.Client
+	AuthClient   auth.AuthProvider
 	MailClient   *mail.Client
 	Storage      *redis.Storage
 	PGXPool      *pgxpool.Pool
+	// used to render emails outside of request handlers
+	Engine *html.Engine
+	// public base URL of the app, used to build links in emails
+	ServerAddress string
 }
 
 func NewAppConfig(
 	store *session.Store,
-	authClient *stytch.Client,
+	authClient auth.AuthProvider,
 	mailClient *mail.Client,
 	storage *redis.Storage,
 	pgxPool *pgxpool.Pool,
+	engine *html.Engine,
+	serverAddress string,
 ) *AppConfig {
 	return &AppConfig{
-		SessionStore: store,
-		AuthClient:   authClient,
-		MailClient:   mailClient,
-		Storage:      storage,
-		PGXPool:      pgxPool,
+		SessionStore:  store,
+		AuthClient:    authClient,
+		MailClient:    mailClient,
+		Storage:       storage,
+		PGXPool:       pgxPool,
+		Engine:        engine,
+		ServerAddress: serverAddress,
 	}
 }
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+const (
+	csrfSessionKey = "csrf_token"
+	// name of the hidden form field rendered by templates/partials/csrf.html
+	csrfFormField = "_csrf"
+	// alternative to the form field for requests that don't submit a form
+	csrfHeader = "X-CSRF-Token"
+	// name of the token value bound to every rendered template
+	templateCSRFKey = "CSRFToken"
+)
+
+// ensures every session has a CSRF token, binds it to rendered templates,
+// and rejects state-changing requests that don't echo it back via the form field or header
+func NewCSRFHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// browsers never attach API tokens on their own, so token-authenticated requests can't be forged
+		if CurrentToken(c) != nil {
+			return c.Next()
+		}
+		sess, err := store.Get(c)
+		if err != nil {
+			return utils.RenderGetSessionError(c, err)
+		}
+		token, _ := sess.Get(csrfSessionKey).(string)
+		if len(token) < 1 {
+			token, err = newCSRFToken()
+			if err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, err)
+			}
+			sess.Set(csrfSessionKey, token)
+			if err := sess.Save(); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to save session data: %w", err))
+			}
+		}
+		if err := c.Bind(fiber.Map{templateCSRFKey: token}); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to bind csrf token: %w", err))
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			// lets same-origin scripts using the session cookie pick up the token
+			c.Set(csrfHeader, token)
+			return c.Next()
+		}
+		provided := c.FormValue(csrfFormField)
+		if len(provided) < 1 {
+			provided = c.Get(csrfHeader)
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("invalid or missing csrf token"))
+		}
+		return c.Next()
+	}
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
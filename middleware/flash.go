@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"scheduler/flash"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+// name of the flash messages value bound to every rendered template
+const templateFlashesKey = "Flashes"
+
+// pops any flash messages queued by a previous request and binds them to rendered templates
+func NewFlashHandler(store *session.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sess, err := store.Get(c)
+		if err != nil {
+			return utils.RenderGetSessionError(c, err)
+		}
+		messages, err := flash.Pop(sess)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if len(messages) > 0 {
+			if err := sess.Save(); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to save session data: %w", err))
+			}
+			if err := c.Bind(fiber.Map{templateFlashesKey: messages}); err != nil {
+				return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to bind flash messages: %w", err))
+			}
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"scheduler/tokens"
+	"scheduler/users"
+	"scheduler/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const localsTokenKey = "api_token"
+
+// returns the API token the current request was authenticated with, or nil if it wasn't
+func CurrentToken(c *fiber.Ctx) *tokens.Token {
+	token, _ := c.Locals(localsTokenKey).(*tokens.Token)
+	return token
+}
+
+// authenticates requests sending an API token in an "Authorization: Bearer" header, limiting the
+// token's user to the token's scopes. requests without the header are passed through untouched,
+// so this should run ahead of the CSRF and session auth handlers, which skip token-authenticated requests
+func NewTokenAuthHandler(cfg *AppConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get(fiber.HeaderAuthorization)
+		if len(header) < 1 {
+			return c.Next()
+		}
+		secret := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+		if secret == header || len(secret) < 1 {
+			return utils.RenderError(c, http.StatusUnauthorized, fmt.Errorf("unable to authenticate: expected a Bearer token"))
+		}
+		token, err := tokens.Authenticate(c.Context(), secret, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		if token == nil {
+			return utils.RenderError(c, http.StatusUnauthorized, fmt.Errorf("unable to authenticate: invalid or revoked token"))
+		}
+		user, err := users.GetUserByID(c.Context(), token.UserID, cfg.PGXPool)
+		if err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, fmt.Errorf("failed to get user: %w", err))
+		}
+		if user == nil {
+			return utils.RenderError(c, http.StatusUnauthorized, fmt.Errorf("unable to authenticate: user not found"))
+		}
+		switch user.Status {
+		case users.DeletedStatus, users.InactiveStatus, users.UndefinedStatus:
+			return utils.RenderError(c, http.StatusForbidden, fmt.Errorf("unable to authenticate: user is %s", user.Status.String()))
+		}
+		if err := user.LoadRoles(c.Context(), cfg.PGXPool); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		user.Scopes = token.Permissions()
+		c.Locals(localsTokenKey, token)
+		if err := setCurrentUser(c, user); err != nil {
+			return utils.RenderError(c, http.StatusInternalServerError, err)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"bytes"
+	"fmt"
+
+	"scheduler/bookings"
+	"scheduler/mail"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/gofiber/template/html"
+)
+
+// emails the recruit a link to confirm the call they requested from a public booking page. times are in the
+// recruit's time zone
+func SendBookingVerification(
+	recruit *users.User,
+	shift *shifts.Shift,
+	req *bookings.Request,
+	token string,
+	serverAddress string,
+	mailClient *mail.Client,
+	engine *html.Engine,
+) error {
+	url := fmt.Sprintf("%s/book/confirm/%s", serverAddress, token)
+	startsAt := recruit.LocalTime(req.StartsAt)
+	expiresAt := recruit.LocalTime(req.ExpiresAt)
+	var buf bytes.Buffer
+	if err := engine.Render(&buf, "email_booking_verify", map[string]interface{}{
+		"URL":       url,
+		"Shift":     shift,
+		"StartsAt":  startsAt,
+		"ExpiresAt": expiresAt,
+	}, "layouts/email"); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+	plaintextMsg := fmt.Sprintf(
+		"Confirm your email to book your call during %s, starting %s: %s. The link works until %s. If you didn't ask for a call, you can ignore this email.",
+		shift.Title,
+		startsAt,
+		url,
+		expiresAt,
+	)
+	if err := mail.NewEmail(recruit.Name, recruit.Email).Send(
+		"Confirm your call",
+		plaintextMsg,
+		buf.String(),
+		mailClient,
+	); err != nil {
+		return fmt.Errorf("failed to send booking verification email: %w", err)
+	}
+	return nil
+}
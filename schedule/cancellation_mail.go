@@ -0,0 +1,88 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"scheduler/bookings"
+	"scheduler/mail"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/gofiber/template/html"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// emails recruits when their call is cancelled because its shift was cancelled or moved. implements
+// bookings.CancellationNotifier
+type CancellationMailer struct {
+	pool          *pgxpool.Pool
+	serverAddress string
+	mailClient    *mail.Client
+	engine        *html.Engine
+}
+
+func NewCancellationMailer(pool *pgxpool.Pool, serverAddress string, mailClient *mail.Client, engine *html.Engine) *CancellationMailer {
+	return &CancellationMailer{
+		pool:          pool,
+		serverAddress: serverAddress,
+		mailClient:    mailClient,
+		engine:        engine,
+	}
+}
+
+// times in the email are in the recruit's time zone. recruits who booked from a public booking page are linked back
+// to it to pick another time
+func (m *CancellationMailer) NotifyCancelled(ctx context.Context, b *bookings.Booking) error {
+	recruit, err := users.GetUserByID(ctx, b.RecruitID, m.pool)
+	if err != nil {
+		return err
+	}
+	if recruit == nil {
+		return fmt.Errorf("user with ID %d not found", b.RecruitID)
+	}
+	shift, err := shifts.GetShiftByID(ctx, b.ShiftID, m.pool)
+	if err != nil {
+		return err
+	}
+	if shift == nil {
+		return fmt.Errorf("shift with ID %d not found", b.ShiftID)
+	}
+	var url string
+	if shift.SeriesID != nil {
+		series, err := shifts.GetSeriesByID(ctx, *shift.SeriesID, m.pool)
+		if err != nil {
+			return err
+		}
+		if series != nil && series.PublicBooking && series.Status == shifts.ScheduledStatus {
+			url = fmt.Sprintf("%s/book/%d", m.serverAddress, series.ID)
+		}
+	}
+	startsAt := recruit.LocalTime(b.StartsAt)
+	var buf bytes.Buffer
+	if err := m.engine.Render(&buf, "email_booking_cancelled", map[string]interface{}{
+		"URL":      url,
+		"Shift":    shift,
+		"StartsAt": startsAt,
+	}, "layouts/email"); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+	plaintextMsg := fmt.Sprintf(
+		"Sorry, your call during %s, starting %s, has been cancelled because the volunteer shift was cancelled or moved.",
+		shift.Title,
+		startsAt,
+	)
+	if len(url) > 0 {
+		plaintextMsg += fmt.Sprintf(" Pick another time here: %s", url)
+	}
+	if err := mail.NewEmail(recruit.Name, recruit.Email).Send(
+		"Your call has been cancelled",
+		plaintextMsg,
+		buf.String(),
+		m.mailClient,
+	); err != nil {
+		return fmt.Errorf("failed to send cancellation email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"scheduler/coverage"
+	"scheduler/mail"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/gofiber/template/html"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// emails volunteers who could cover a shift when coverage is requested. implements coverage.Notifier
+type CoverageMailer struct {
+	pool          *pgxpool.Pool
+	serverAddress string
+	mailClient    *mail.Client
+	engine        *html.Engine
+}
+
+func NewCoverageMailer(pool *pgxpool.Pool, serverAddress string, mailClient *mail.Client, engine *html.Engine) *CoverageMailer {
+	return &CoverageMailer{
+		pool:          pool,
+		serverAddress: serverAddress,
+		mailClient:    mailClient,
+		engine:        engine,
+	}
+}
+
+// sends each volunteer their own email, with times in their time zone. only fails if no email could be sent,
+// so a single bad address doesn't lead to everyone else being emailed again
+func (m *CoverageMailer) NotifyCoverageNeeded(ctx context.Context, r *coverage.Request, shift *shifts.Shift, volunteers []*users.User) error {
+	requester, err := users.GetUserByID(ctx, r.RequesterID, m.pool)
+	if err != nil {
+		return err
+	}
+	if requester == nil {
+		return fmt.Errorf("user with ID %d not found", r.RequesterID)
+	}
+	url := fmt.Sprintf("%s/coverage", m.serverAddress)
+	var lastErr error
+	sent := 0
+	for _, v := range volunteers {
+		startsAt := v.LocalTime(shift.StartsAt)
+		var buf bytes.Buffer
+		if err := m.engine.Render(&buf, "email_coverage", map[string]interface{}{
+			"URL":       url,
+			"Shift":     shift,
+			"StartsAt":  startsAt,
+			"EndsAt":    v.LocalClock(shift.EndsAt),
+			"Requester": requester,
+			"Request":   r,
+		}, "layouts/email"); err != nil {
+			return fmt.Errorf("failed to render email: %w", err)
+		}
+		plaintextMsg := fmt.Sprintf(
+			"%s can't make %s, starting %s, and is looking for someone to cover for them. Take the shift here: %s",
+			requester.Name,
+			shift.Title,
+			startsAt,
+			url,
+		)
+		if err := mail.NewEmail(v.Name, v.Email).Send(
+			fmt.Sprintf("Can you cover %s?", shift.Title),
+			plaintextMsg,
+			buf.String(),
+			m.mailClient,
+		); err != nil {
+			lastErr = fmt.Errorf("failed to send coverage email: %w", err)
+			fmt.Println(lastErr)
+			continue
+		}
+		sent++
+	}
+	if sent < 1 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
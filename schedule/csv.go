@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"scheduler/users"
+	"scheduler/utils"
+)
+
+// writes one row per shift, including a header row. volunteers and booked calls are listed in a single cell each.
+// text cells are escaped, since names come from anyone who books through the public page
+func WriteCSV(w io.Writer, entries []*Entry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"shift_id", "title", "starts_at", "ends_at", "capacity", "volunteers", "booked_recruits"}); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	for _, entry := range entries {
+		volunteers := make([]string, len(entry.Volunteers))
+		for i, v := range entry.Volunteers {
+			volunteers[i] = describeUser(v)
+		}
+		calls := make([]string, len(entry.Bookings))
+		for i, call := range entry.Bookings {
+			calls[i] = fmt.Sprintf(
+				"%s %s with %s",
+				call.Booking.StartsAt.UTC().Format(time.RFC3339),
+				describeUser(call.Recruit),
+				describeUser(call.Volunteer),
+			)
+		}
+		if err := writer.Write([]string{
+			strconv.Itoa(entry.Shift.ID),
+			utils.CSVCell(entry.Shift.Title),
+			entry.Shift.StartsAt.UTC().Format(time.RFC3339),
+			entry.Shift.EndsAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(entry.Shift.Capacity),
+			utils.CSVCell(strings.Join(volunteers, "; ")),
+			utils.CSVCell(strings.Join(calls, "; ")),
+		}); err != nil {
+			return fmt.Errorf("failed to write csv row for shift %d: %w", entry.Shift.ID, err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formats the user like an email address header, e.g. "Jane Doe <jane@example.com>"
+func describeUser(u *users.User) string {
+	if u == nil {
+		return "unknown user"
+	}
+	if len(u.Name) < 1 {
+		return u.Email
+	}
+	return fmt.Sprintf("%s <%s>", u.Name, u.Email)
+}
@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about calendar feeds
+const auditTarget = "calendar_feed"
+
+// creates a calendar feed for the user, or replaces their existing one so the old URL stops working.
+// returns the secret token for the feed's URL. only a hash of it is stored, so it can't be retrieved again
+func ResetFeedToken(ctx context.Context, userID int, pool *pgxpool.Pool) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate calendar feed token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(
+			ctx,
+			"insert into calendar_feeds(user_id, hash) values ($1, $2) on conflict (user_id) do update set hash = excluded.hash, created_at = now()",
+			userID,
+			hashFeedToken(token),
+		); err != nil {
+			return fmt.Errorf("failed to save calendar feed token: %w", err)
+		}
+		return audit.Record(ctx, tx, "calendar_feed.reset", auditTarget, userID, nil, nil)
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// turns off the user's calendar feed. disabling a feed that doesn't exist is a no-op
+func DisableFeed(ctx context.Context, userID int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "delete from calendar_feeds where user_id = $1", userID)
+		if err != nil {
+			return fmt.Errorf("failed to delete calendar feed: %w", err)
+		}
+		if tag.RowsAffected() < 1 {
+			return nil
+		}
+		return audit.Record(ctx, tx, "calendar_feed.disable", auditTarget, userID, nil, nil)
+	})
+}
+
+// returns whether the user has a calendar feed
+func HasFeed(ctx context.Context, userID int, pool *pgxpool.Pool) (bool, error) {
+	var exists bool
+	if err := pgxscan.Get(ctx, pool, &exists, "select exists(select 1 from calendar_feeds where user_id = $1)", userID); err != nil {
+		return false, fmt.Errorf("failed to check for calendar feed: %w", err)
+	}
+	return exists, nil
+}
+
+// returns the ID of the user whose feed the token belongs to, or 0 if it doesn't match any feed
+func GetFeedUserID(ctx context.Context, token string, pool *pgxpool.Pool) (int, error) {
+	var userID int
+	if err := pgxscan.Get(ctx, pool, &userID, "select user_id from calendar_feeds where hash = $1", hashFeedToken(token)); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+	return userID, nil
+}
+
+// the tokens are random and long, so a fast unsalted hash is enough to keep them from being usable if the db leaks
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
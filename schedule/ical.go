@@ -0,0 +1,158 @@
+package schedule
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"scheduler/bookings"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// how far back and ahead calendar feeds reach
+	feedPast   = 30 * 24 * time.Hour
+	feedFuture = 180 * 24 * time.Hour
+	// suffix of event UIDs. UIDs must be globally unique, so they're namespaced to the app
+	uidDomain = "scheduler.justicedemocrats.com"
+	icalTime  = "20060102T150405Z"
+	// longest line allowed by RFC 5545, in bytes, excluding the line break
+	maxLineLength = 75
+)
+
+// a user's own shifts and calls, as shown in their calendar feed
+type Feed struct {
+	User   *users.User
+	Shifts []*shifts.Shift
+	Calls  []*BookedCall
+}
+
+// returns the user's scheduled shifts and booked calls from a month ago to six months from now
+func GetFeed(ctx context.Context, user *users.User, pool *pgxpool.Pool) (*Feed, error) {
+	now := time.Now()
+	from, to := now.Add(-feedPast), now.Add(feedFuture)
+	userShifts, _, err := shifts.FindShifts(ctx, shifts.Filter{
+		From:        from,
+		To:          to,
+		Status:      shifts.ScheduledStatus,
+		VolunteerID: user.ID,
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+	booked, _, err := bookings.FindBookings(ctx, bookings.Filter{
+		From:          from,
+		To:            to,
+		Status:        bookings.BookedStatus,
+		ParticipantID: user.ID,
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []int
+	for _, b := range booked {
+		userIDs = append(userIDs, b.RecruitID, b.VolunteerID)
+	}
+	people, err := users.GetUsersByIDs(ctx, userIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+	feed := &Feed{
+		User:   user,
+		Shifts: userShifts,
+	}
+	for _, b := range booked {
+		feed.Calls = append(feed.Calls, &BookedCall{
+			Booking:   b,
+			Recruit:   people[b.RecruitID],
+			Volunteer: people[b.VolunteerID],
+		})
+	}
+	return feed, nil
+}
+
+// writes the feed as an iCalendar (RFC 5545) document
+func (f *Feed) WriteICal(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format(icalTime)
+	writeLine(buf, "BEGIN:VCALENDAR")
+	writeLine(buf, "VERSION:2.0")
+	writeLine(buf, "PRODID:-//Justice Democrats//Scheduler//EN")
+	writeLine(buf, "CALSCALE:GREGORIAN")
+	writeLine(buf, "METHOD:PUBLISH")
+	writeLine(buf, "X-WR-CALNAME:"+escapeText("JD Scheduler"))
+	// asks calendar apps to check for changes hourly. most treat this as a hint
+	writeLine(buf, "REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	writeLine(buf, "X-PUBLISHED-TTL:PT1H")
+	for _, shift := range f.Shifts {
+		writeEvent(buf, fmt.Sprintf("shift-%d", shift.ID), stamp, shift.StartsAt, shift.EndsAt, "Shift: "+shift.Title, "")
+	}
+	for _, call := range f.Calls {
+		// describe the call from the point of view of the feed's owner
+		other, role := call.Recruit, "recruit"
+		if call.Booking.RecruitID == f.User.ID {
+			other, role = call.Volunteer, "volunteer"
+		}
+		name := "a " + role
+		description := ""
+		if other != nil {
+			name = other.Name
+			description = fmt.Sprintf("Call with %s <%s>", other.Name, other.Email)
+		}
+		// the volunteer gets the recruit's intake answers to prepare for the call
+		if role == "recruit" {
+			for _, answer := range call.Booking.Answers {
+				description += fmt.Sprintf("\n%s: %s", answer.Label, answer.Text())
+			}
+			description = strings.TrimPrefix(description, "\n")
+		}
+		writeEvent(buf, fmt.Sprintf("booking-%d", call.Booking.ID), stamp, call.Booking.StartsAt, call.Booking.EndsAt, "Call with "+name, description)
+	}
+	writeLine(buf, "END:VCALENDAR")
+	return buf.Flush()
+}
+
+func writeEvent(buf *bufio.Writer, id string, stamp string, startsAt time.Time, endsAt time.Time, summary string, description string) {
+	writeLine(buf, "BEGIN:VEVENT")
+	writeLine(buf, fmt.Sprintf("UID:%s@%s", id, uidDomain))
+	writeLine(buf, "DTSTAMP:"+stamp)
+	writeLine(buf, "DTSTART:"+startsAt.UTC().Format(icalTime))
+	writeLine(buf, "DTEND:"+endsAt.UTC().Format(icalTime))
+	writeLine(buf, "SUMMARY:"+escapeText(summary))
+	if len(description) > 0 {
+		writeLine(buf, "DESCRIPTION:"+escapeText(description))
+	}
+	writeLine(buf, "END:VEVENT")
+}
+
+// writes a content line terminated by CRLF, folding it onto continuation lines if it's too long
+func writeLine(buf *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		// don't split multi-byte characters
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards their length
+		limit = maxLineLength - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"scheduler/bookings"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// a shift along with the people taking part in it
+type Entry struct {
+	Shift      *shifts.Shift
+	Volunteers []*users.User
+	Bookings   []*BookedCall
+}
+
+// a booking along with its participants. either participant may be nil if their user has since been deleted
+type BookedCall struct {
+	Booking   *bookings.Booking
+	Recruit   *users.User
+	Volunteer *users.User
+}
+
+// returns the scheduled shifts overlapping the time range, ordered by start time,
+// each with its volunteers and booked calls
+func Get(ctx context.Context, from time.Time, to time.Time, pool *pgxpool.Pool) ([]*Entry, error) {
+	found, _, err := shifts.FindShifts(ctx, shifts.Filter{
+		From:   from,
+		To:     to,
+		Status: shifts.ScheduledStatus,
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+	if err := shifts.LoadVolunteers(ctx, found, pool); err != nil {
+		return nil, err
+	}
+	booked, _, err := bookings.FindBookings(ctx, bookings.Filter{
+		From:   from,
+		To:     to,
+		Status: bookings.BookedStatus,
+	}, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []int
+	for _, shift := range found {
+		userIDs = append(userIDs, shift.VolunteerIDs...)
+	}
+	for _, b := range booked {
+		userIDs = append(userIDs, b.RecruitID, b.VolunteerID)
+	}
+	people, err := users.GetUsersByIDs(ctx, userIDs, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, len(found))
+	byShiftID := map[int]*Entry{}
+	for i, shift := range found {
+		entry := &Entry{Shift: shift}
+		for _, id := range shift.VolunteerIDs {
+			if volunteer, ok := people[id]; ok {
+				entry.Volunteers = append(entry.Volunteers, volunteer)
+			}
+		}
+		entries[i] = entry
+		byShiftID[shift.ID] = entry
+	}
+	for _, b := range booked {
+		if entry, ok := byShiftID[b.ShiftID]; ok {
+			entry.Bookings = append(entry.Bookings, &BookedCall{
+				Booking:   b,
+				Recruit:   people[b.RecruitID],
+				Volunteer: people[b.VolunteerID],
+			})
+		}
+	}
+	return entries, nil
+}
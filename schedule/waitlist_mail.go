@@ -0,0 +1,70 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"scheduler/mail"
+	"scheduler/shifts"
+	"scheduler/users"
+
+	"github.com/gofiber/template/html"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// emails waitlisted volunteers when a spot is held for them. implements shifts.WaitlistNotifier
+type WaitlistMailer struct {
+	pool          *pgxpool.Pool
+	serverAddress string
+	mailClient    *mail.Client
+	engine        *html.Engine
+}
+
+func NewWaitlistMailer(pool *pgxpool.Pool, serverAddress string, mailClient *mail.Client, engine *html.Engine) *WaitlistMailer {
+	return &WaitlistMailer{
+		pool:          pool,
+		serverAddress: serverAddress,
+		mailClient:    mailClient,
+		engine:        engine,
+	}
+}
+
+// times in the email are in the volunteer's time zone
+func (m *WaitlistMailer) NotifyOffer(ctx context.Context, shift *shifts.Shift, entry *shifts.WaitlistEntry) error {
+	volunteer, err := users.GetUserByID(ctx, entry.UserID, m.pool)
+	if err != nil {
+		return err
+	}
+	if volunteer == nil {
+		return fmt.Errorf("user with ID %d not found", entry.UserID)
+	}
+	url := fmt.Sprintf("%s/shifts", m.serverAddress)
+	startsAt := volunteer.LocalTime(shift.StartsAt)
+	expiresAt := volunteer.LocalTime(*entry.OfferExpiresAt)
+	var buf bytes.Buffer
+	if err := m.engine.Render(&buf, "email_waitlist", map[string]interface{}{
+		"URL":       url,
+		"Shift":     shift,
+		"StartsAt":  startsAt,
+		"ExpiresAt": expiresAt,
+	}, "layouts/email"); err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+	plaintextMsg := fmt.Sprintf(
+		"A spot opened up on %s, starting %s, and we're holding it for you until %s. Confirm or decline it here: %s",
+		shift.Title,
+		startsAt,
+		expiresAt,
+		url,
+	)
+	if err := mail.NewEmail(volunteer.Name, volunteer.Email).Send(
+		fmt.Sprintf("A spot opened up on %s", shift.Title),
+		plaintextMsg,
+		buf.String(),
+		m.mailClient,
+	); err != nil {
+		return fmt.Errorf("failed to send waitlist email: %w", err)
+	}
+	return nil
+}
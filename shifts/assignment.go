@@ -0,0 +1,88 @@
+package shifts
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// how calls booked during a shift are assigned to its volunteers
+type Assignment int
+
+const (
+	UndefinedAssignment Assignment = iota
+	// volunteers take turns, starting with whoever has gone longest without a call
+	RoundRobinAssignment
+	// the volunteer with the fewest calls during the shift takes the call
+	LeastLoadedAssignment
+	// only volunteers with every skill the recruit needs, e.g. a language, can take the call
+	SkillMatchAssignment
+	// the recruit picks the volunteer
+	RecruitChoiceAssignment
+	// new assignments should go here so we don't change the int values associated with each assignment
+	endAssignment
+)
+
+// assignments in the order they're offered in forms
+var Assignments = []Assignment{RoundRobinAssignment, LeastLoadedAssignment, SkillMatchAssignment, RecruitChoiceAssignment}
+
+func (a Assignment) String() string {
+	switch a {
+	case RoundRobinAssignment:
+		return "round_robin"
+	case LeastLoadedAssignment:
+		return "least_loaded"
+	case SkillMatchAssignment:
+		return "skill_match"
+	case RecruitChoiceAssignment:
+		return "recruit_choice"
+	default:
+		return ""
+	}
+}
+
+// describes the assignment for people, e.g. "Round robin"
+func (a Assignment) Label() string {
+	switch a {
+	case RoundRobinAssignment:
+		return "Round robin"
+	case LeastLoadedAssignment:
+		return "Fewest calls"
+	case SkillMatchAssignment:
+		return "Skill or language match"
+	case RecruitChoiceAssignment:
+		return "Recruit's choice"
+	default:
+		return ""
+	}
+}
+
+func (a Assignment) IsValid() bool {
+	return a > UndefinedAssignment && a < endAssignment
+}
+
+func (a Assignment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Assignment) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("assignment must be a string: %w", err)
+	}
+	assignment, err := ParseAssignment(str)
+	if err != nil {
+		return err
+	}
+	*a = assignment
+	return nil
+}
+
+// parses an assignment from its string representation, e.g. "round_robin"
+func ParseAssignment(str string) (Assignment, error) {
+	for a := UndefinedAssignment + 1; a < endAssignment; a++ {
+		if a.String() == str {
+			return a, nil
+		}
+	}
+	return UndefinedAssignment, fmt.Errorf("unknown assignment %q", str)
+}
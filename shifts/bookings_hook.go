@@ -0,0 +1,38 @@
+package shifts
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// keeps the calls booked during shifts in line with changes to the shifts. implemented by bookings.ShiftHook, which
+// main passes to SetBookingsHook, since the bookings package depends on this one rather than the other way round
+type BookingsHook interface {
+	// returns an error if the volunteer can't leave the shift, e.g. because they have calls booked during it
+	CheckLeave(ctx context.Context, tx pgx.Tx, shift *Shift, userID int) error
+	// called after the shift is saved, so calls that no longer fit it can be cancelled, e.g. because it was
+	// cancelled or moved
+	ShiftChanged(ctx context.Context, tx pgx.Tx, shift *Shift) error
+}
+
+var bookingsHook BookingsHook
+
+// must be called before shifts are changed, or calls won't be cancelled along with their shifts
+func SetBookingsHook(h BookingsHook) {
+	bookingsHook = h
+}
+
+func checkLeave(ctx context.Context, tx pgx.Tx, shift *Shift, userID int) error {
+	if bookingsHook == nil {
+		return nil
+	}
+	return bookingsHook.CheckLeave(ctx, tx, shift, userID)
+}
+
+func shiftChanged(ctx context.Context, tx pgx.Tx, shift *Shift) error {
+	if bookingsHook == nil {
+		return nil
+	}
+	return bookingsHook.ShiftChanged(ctx, tx, shift)
+}
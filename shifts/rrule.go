@@ -0,0 +1,347 @@
+package shifts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the largest number of periods (days, weeks or months) a rule is expanded over,
+// so rules that rarely or never match can't loop forever
+const maxPeriods = 10000
+
+type Frequency int
+
+const (
+	UndefinedFrequency Frequency = iota
+	DailyFrequency
+	WeeklyFrequency
+	MonthlyFrequency
+	endFrequency
+)
+
+func (f Frequency) String() string {
+	switch f {
+	case DailyFrequency:
+		return "DAILY"
+	case WeeklyFrequency:
+		return "WEEKLY"
+	case MonthlyFrequency:
+		return "MONTHLY"
+	default:
+		return ""
+	}
+}
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+func weekdayCode(d time.Weekday) string {
+	return strings.ToUpper(d.String()[:2])
+}
+
+// a BYDAY value, e.g. "TU" or "-1FR" for the last Friday of the month
+type WeekdayNum struct {
+	// 0 matches every such weekday in the period. only allowed for monthly rules
+	N       int
+	Weekday time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	if w.N == 0 {
+		return weekdayCode(w.Weekday)
+	}
+	return strconv.Itoa(w.N) + weekdayCode(w.Weekday)
+}
+
+// a recurrence rule as defined by RFC 5545. the DAILY, WEEKLY and MONTHLY frequencies
+// are supported, along with the INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and WKST parts
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// maximum number of occurrences. 0 means no limit
+	Count int
+	// last possible start time, inclusive. zero means no limit
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	WeekStart  time.Weekday
+}
+
+// parses a rule like "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10". a leading "RRULE:" is ignored.
+// a date-only UNTIL lasts until the end of the day in loc
+func ParseRule(s string, loc *time.Location) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	rule := Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || len(name) < 1 || len(value) < 1 {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s appears more than once", name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY":
+				rule.Freq = DailyFrequency
+			case "WEEKLY":
+				rule.Freq = WeeklyFrequency
+			case "MONTHLY":
+				rule.Freq = MonthlyFrequency
+			default:
+				return nil, fmt.Errorf("unsupported frequency %q: must be DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("invalid interval %q", value)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(value); err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("invalid count %q", value)
+			}
+		case "UNTIL":
+			if rule.Until, err = time.Parse("20060102T150405Z", value); err != nil {
+				date, dateErr := time.ParseInLocation("20060102", value, loc)
+				if dateErr != nil {
+					return nil, fmt.Errorf("invalid until %q: must be a UTC date-time like 20061231T235959Z or a date like 20061231", value)
+				}
+				rule.Until = date.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				if len(code) < 2 {
+					return nil, fmt.Errorf("invalid day %q", code)
+				}
+				day, ok := weekdayCodes[code[len(code)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("invalid day %q", code)
+				}
+				wd := WeekdayNum{Weekday: day}
+				if prefix := code[:len(code)-2]; len(prefix) > 0 {
+					if wd.N, err = strconv.Atoi(prefix); err != nil || wd.N == 0 || wd.N < -5 || wd.N > 5 {
+						return nil, fmt.Errorf("invalid day %q", code)
+					}
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(v)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("invalid month day %q", v)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		case "WKST":
+			day, ok := weekdayCodes[value]
+			if !ok {
+				return nil, fmt.Errorf("invalid week start %q", value)
+			}
+			rule.WeekStart = day
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+	}
+	if err := rule.IsValid(); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *Rule) IsValid() error {
+	var errs []string
+	if r.Freq <= UndefinedFrequency || r.Freq >= endFrequency {
+		errs = append(errs, "FREQ is required")
+	}
+	if r.Interval < 1 {
+		errs = append(errs, "INTERVAL must be at least 1")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		errs = append(errs, "COUNT and UNTIL can't both be used")
+	}
+	if r.Freq == WeeklyFrequency && len(r.ByMonthDay) > 0 {
+		errs = append(errs, "BYMONTHDAY can't be used with a weekly rule")
+	}
+	if r.Freq != MonthlyFrequency {
+		for _, wd := range r.ByDay {
+			if wd.N != 0 {
+				errs = append(errs, fmt.Sprintf("numbered days like %s are only allowed in monthly rules", wd))
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// formats the rule without the "RRULE:" prefix
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = wd.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayCode(r.WeekStart))
+	}
+	return strings.Join(parts, ";")
+}
+
+// returns the start times of the occurrences starting at or after from and before to, in order.
+// occurrences are at the same wall clock time as dtstart in its location, so they stay put across daylight saving changes.
+// dtstart is only an occurrence if it matches the rule, so callers that sync with calendar apps following RFC 5545,
+// where dtstart is always the first occurrence, should check it with Matches first
+func (r *Rule) Between(dtstart time.Time, from time.Time, to time.Time) []time.Time {
+	var found []time.Time
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.candidates(dtstart, period*r.Interval) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if (!r.Until.IsZero() && t.After(r.Until)) || !t.Before(to) {
+				return found
+			}
+			count++
+			if !t.Before(from) {
+				found = append(found, t)
+			}
+			if r.Count > 0 && count >= r.Count {
+				return found
+			}
+		}
+	}
+	return found
+}
+
+// reports whether dtstart is an occurrence of the rule starting at dtstart
+func (r *Rule) Matches(dtstart time.Time) bool {
+	return len(r.Between(dtstart, dtstart, dtstart.Add(time.Second))) > 0
+}
+
+// returns the rule's matches in the period offset periods after dtstart's, sorted
+func (r *Rule) candidates(dtstart time.Time, offset int) []time.Time {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	}
+	var days []time.Time
+	switch r.Freq {
+	case DailyFrequency:
+		day := at(dtstart.Year(), dtstart.Month(), dtstart.Day()+offset)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			days = append(days, day)
+		}
+	case WeeklyFrequency:
+		// the week containing dtstart begins on the most recent WeekStart
+		back := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-back+offset*7)
+		for i := 0; i < 7; i++ {
+			day := at(weekStart.Year(), weekStart.Month(), weekStart.Day()+i)
+			if len(r.ByDay) > 0 {
+				if r.matchesWeekday(day) {
+					days = append(days, day)
+				}
+			} else if day.Weekday() == dtstart.Weekday() {
+				days = append(days, day)
+			}
+		}
+	case MonthlyFrequency:
+		first := at(dtstart.Year(), dtstart.Month()+time.Month(offset), 1)
+		length := at(first.Year(), first.Month()+1, 0).Day()
+		for d := 1; d <= length; d++ {
+			day := at(first.Year(), first.Month(), d)
+			switch {
+			case len(r.ByDay) > 0 || len(r.ByMonthDay) > 0:
+				// when both are used, BYDAY limits the days matched by BYMONTHDAY
+				if (len(r.ByDay) == 0 || r.matchesMonthlyWeekday(day, length)) && (len(r.ByMonthDay) == 0 || r.matchesMonthDay(day)) {
+					days = append(days, day)
+				}
+			case d == dtstart.Day():
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+func (r *Rule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if wd.Weekday == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// like matchesWeekday, but also matches numbered days like the 2nd Tuesday or last Friday of the month
+func (r *Rule) matchesMonthlyWeekday(day time.Time, monthLength int) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday != day.Weekday() {
+			continue
+		}
+		switch {
+		case wd.N == 0:
+			return true
+		case wd.N > 0 && (day.Day()-1)/7+1 == wd.N:
+			return true
+		case wd.N < 0 && (monthLength-day.Day())/7+1 == -wd.N:
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	length := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, d := range r.ByMonthDay {
+		if d == day.Day() || (d < 0 && length+d+1 == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
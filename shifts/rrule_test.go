@@ -0,0 +1,221 @@
+package shifts
+
+import (
+	"testing"
+	"time"
+)
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %s", err)
+	}
+	return loc
+}
+
+// formats times as they'd appear on a wall clock in their location, so failures are easy to read
+func wallClock(times []time.Time) []string {
+	formatted := make([]string, len(times))
+	for i, t := range times {
+		formatted[i] = t.Format("2006-01-02 15:04 MST")
+	}
+	return formatted
+}
+
+func checkTimes(t *testing.T, got []time.Time, want []string) {
+	t.Helper()
+	formatted := wallClock(got)
+	if len(formatted) != len(want) {
+		t.Fatalf("expected %v, got %v", want, formatted)
+	}
+	for i := range want {
+		if formatted[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, formatted)
+		}
+	}
+}
+
+func TestRuleBetween(t *testing.T) {
+	loc := newYork(t)
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		// defaults to dtstart
+		from time.Time
+		// defaults to a year after dtstart
+		to   time.Time
+		want []string
+	}{
+		{
+			name:    "last friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=4",
+			dtstart: time.Date(2024, time.January, 26, 18, 0, 0, 0, loc),
+			want:    []string{"2024-01-26 18:00 EST", "2024-02-23 18:00 EST", "2024-03-29 18:00 EDT", "2024-04-26 18:00 EDT"},
+		},
+		{
+			name:    "second tuesday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=2TU;COUNT=3",
+			dtstart: time.Date(2024, time.January, 9, 18, 0, 0, 0, loc),
+			want:    []string{"2024-01-09 18:00 EST", "2024-02-13 18:00 EST", "2024-03-12 18:00 EDT"},
+		},
+		{
+			name:    "31st skips shorter months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=4",
+			dtstart: time.Date(2024, time.January, 31, 18, 0, 0, 0, loc),
+			want:    []string{"2024-01-31 18:00 EST", "2024-03-31 18:00 EDT", "2024-05-31 18:00 EDT", "2024-07-31 18:00 EDT"},
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3",
+			dtstart: time.Date(2024, time.January, 31, 18, 0, 0, 0, loc),
+			want:    []string{"2024-01-31 18:00 EST", "2024-02-29 18:00 EST", "2024-03-31 18:00 EDT"},
+		},
+		{
+			name:    "count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2024, time.March, 1, 9, 0, 0, 0, loc),
+			want:    []string{"2024-03-01 09:00 EST", "2024-03-02 09:00 EST", "2024-03-03 09:00 EST"},
+		},
+		{
+			name:    "count includes occurrences before from",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2024, time.March, 1, 9, 0, 0, 0, loc),
+			from:    time.Date(2024, time.March, 2, 0, 0, 0, 0, loc),
+			want:    []string{"2024-03-02 09:00 EST", "2024-03-03 09:00 EST"},
+		},
+		{
+			name:    "until is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20240303T140000Z",
+			dtstart: time.Date(2024, time.March, 1, 9, 0, 0, 0, loc),
+			want:    []string{"2024-03-01 09:00 EST", "2024-03-02 09:00 EST", "2024-03-03 09:00 EST"},
+		},
+		{
+			name:    "until before an occurrence",
+			rule:    "FREQ=DAILY;UNTIL=20240303T135959Z",
+			dtstart: time.Date(2024, time.March, 1, 9, 0, 0, 0, loc),
+			want:    []string{"2024-03-01 09:00 EST", "2024-03-02 09:00 EST"},
+		},
+		{
+			name:    "date-only until lasts the whole day",
+			rule:    "FREQ=DAILY;UNTIL=20240303",
+			dtstart: time.Date(2024, time.March, 1, 21, 0, 0, 0, loc),
+			want:    []string{"2024-03-01 21:00 EST", "2024-03-02 21:00 EST", "2024-03-03 21:00 EST"},
+		},
+		{
+			// from RFC 5545, section 3.8.5.3
+			name:    "interval with week starting monday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			dtstart: time.Date(1997, time.August, 5, 9, 0, 0, 0, loc),
+			want:    []string{"1997-08-05 09:00 EDT", "1997-08-10 09:00 EDT", "1997-08-19 09:00 EDT", "1997-08-24 09:00 EDT"},
+		},
+		{
+			name:    "interval with week starting sunday",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			dtstart: time.Date(1997, time.August, 5, 9, 0, 0, 0, loc),
+			want:    []string{"1997-08-05 09:00 EDT", "1997-08-17 09:00 EDT", "1997-08-19 09:00 EDT", "1997-08-31 09:00 EDT"},
+		},
+		{
+			name:    "wall clock time kept across daylight saving",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: time.Date(2024, time.March, 9, 9, 0, 0, 0, loc),
+			want:    []string{"2024-03-09 09:00 EST", "2024-03-10 09:00 EDT", "2024-03-11 09:00 EDT"},
+		},
+		{
+			name:    "weekly on the start's weekday",
+			rule:    "FREQ=WEEKLY",
+			dtstart: time.Date(2024, time.October, 29, 18, 0, 0, 0, loc),
+			to:      time.Date(2024, time.November, 13, 0, 0, 0, 0, loc),
+			want:    []string{"2024-10-29 18:00 EDT", "2024-11-05 18:00 EST", "2024-11-12 18:00 EST"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule, loc)
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %s", tt.rule, err)
+			}
+			from, to := tt.from, tt.to
+			if from.IsZero() {
+				from = tt.dtstart
+			}
+			if to.IsZero() {
+				to = tt.dtstart.AddDate(1, 0, 0)
+			}
+			checkTimes(t, rule.Between(tt.dtstart, from, to), tt.want)
+		})
+	}
+}
+
+func TestRuleBetweenAcrossDaylightSaving(t *testing.T) {
+	loc := newYork(t)
+	rule, err := ParseRule("FREQ=DAILY;COUNT=2", loc)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := rule.Between(time.Date(2024, time.March, 9, 9, 0, 0, 0, loc), time.Time{}, time.Date(2025, 1, 1, 0, 0, 0, 0, loc))
+	if len(got) != 2 || got[1].Sub(got[0]) != 23*time.Hour {
+		t.Fatalf("expected occurrences 23 hours apart across the change to daylight saving, got %v", wallClock(got))
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"BYDAY=TU",
+		"FREQ=YEARLY",
+		"FREQ=WEEKLY;COUNT=3;UNTIL=20240101",
+		"FREQ=WEEKLY;BYDAY=2TU",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYDAY=6TU",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;BYHOUR=9",
+	} {
+		if _, err := ParseRule(rule, time.UTC); err == nil {
+			t.Errorf("expected %q to be rejected", rule)
+		}
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	rule, err := ParseRule("RRULE:freq=monthly;byday=-1fr;interval=2;wkst=su", time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := rule.String(), "FREQ=MONTHLY;INTERVAL=2;BYDAY=-1FR;WKST=SU"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSeriesOccurrencesLeaveOutExDates(t *testing.T) {
+	loc := newYork(t)
+	start := time.Date(2024, time.January, 2, 18, 0, 0, 0, loc)
+	series, err := NewSeries("Phones", start, start.Add(2*time.Hour), "America/New_York", 0, "FREQ=WEEKLY;BYDAY=TU")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	series.ExDates = []time.Time{start.AddDate(0, 0, 7).UTC()}
+	got, err := series.Occurrences(start, start.AddDate(0, 0, 22))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkTimes(t, got, []string{"2024-01-02 18:00 EST", "2024-01-16 18:00 EST", "2024-01-23 18:00 EST"})
+}
+
+func TestSeriesStartMustMatchRule(t *testing.T) {
+	loc := newYork(t)
+	// a Monday, which Google Calendar would show as an extra occurrence
+	monday := time.Date(2024, time.January, 1, 18, 0, 0, 0, loc)
+	if _, err := NewSeries("Phones", monday, monday.Add(time.Hour), "America/New_York", 0, "FREQ=WEEKLY;BYDAY=TU"); err == nil {
+		t.Errorf("expected a series starting on a Monday to be rejected for BYDAY=TU")
+	}
+	if _, err := NewSeries("Phones", monday, monday.Add(time.Hour), "America/New_York", 0, "FREQ=WEEKLY;BYDAY=MO,TU"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := NewSeries("Phones", monday, monday.Add(time.Hour), "America/New_York", 0, "FREQ=MONTHLY;BYMONTHDAY=31"); err == nil {
+		t.Errorf("expected a series starting on the 1st to be rejected for BYMONTHDAY=31")
+	}
+}
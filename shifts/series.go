@@ -0,0 +1,462 @@
+package shifts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about shift series
+const seriesAuditTarget = "shift_series"
+
+// how far ahead a series' occurrences are created as shifts. the horizon rolls forward as time passes
+const SeriesHorizon = 8 * 7 * 24 * time.Hour
+
+// a recurring shift. its occurrences are created as shifts up to SeriesHorizon ahead,
+// and each can be changed on its own without affecting the rest of the series
+type Series struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	// start and end of the first occurrence. later occurrences start at the same wall clock time in TimeZone
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// IANA time zone name, e.g. America/New_York
+	TimeZone string `json:"time_zone"`
+	Capacity int    `json:"capacity"`
+	// copied to each occurrence's shift
+	Assignment Assignment `json:"assignment"`
+	// the form recruits fill in when they book a call, copied to each occurrence's shift
+	IntakeFormID *int `json:"intake_form_id"`
+	// whether anyone with the link can book calls during the series' shifts from its public booking page
+	PublicBooking bool `json:"public_booking"`
+	// RFC 5545 recurrence rule without the "RRULE:" prefix, e.g. FREQ=WEEKLY;BYDAY=TU,TH
+	RRule string `json:"rrule"`
+	// start times of occurrences that have been removed from the series
+	ExDates []time.Time `json:"exdates"`
+	Status  Status      `json:"status"`
+	// occurrences starting before this time have been created as shifts
+	ExpandedUntil *time.Time `json:"expanded_until"`
+	GoogleEventID *string    `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// the series needs to be synced to the calendar when it has been updated since it was last synced
+	UpdatedAt time.Time  `json:"-"`
+	SyncedAt  *time.Time `json:"-"`
+}
+
+// creates a new instance of a series struct. the rule is normalized
+func NewSeries(title string, startsAt time.Time, endsAt time.Time, timeZone string, capacity int, rrule string) (*Series, error) {
+	series := Series{
+		Title:      strings.TrimSpace(title),
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+		TimeZone:   timeZone,
+		Capacity:   capacity,
+		Assignment: RoundRobinAssignment,
+		RRule:      rrule,
+		ExDates:    []time.Time{},
+		Status:     ScheduledStatus,
+	}
+	if err := series.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid series: %w", err)
+	}
+	rule, _ := series.Rule()
+	series.RRule = rule.String()
+	return &series, nil
+}
+
+func (s *Series) IsValid() error {
+	var errs []string
+	if len(s.Title) < 1 {
+		errs = append(errs, "title is required")
+	}
+	if s.StartsAt.IsZero() || s.EndsAt.IsZero() {
+		errs = append(errs, "start and end times are required")
+	} else if !s.EndsAt.After(s.StartsAt) {
+		errs = append(errs, "shifts must end after they start")
+	}
+	if s.Capacity < 0 {
+		errs = append(errs, fmt.Sprintf("invalid capacity %d provided", s.Capacity))
+	}
+	if s.Status <= UndefinedStatus || s.Status >= endStatus {
+		errs = append(errs, fmt.Sprintf("invalid status %d provided", s.Status))
+	}
+	if !s.Assignment.IsValid() {
+		errs = append(errs, fmt.Sprintf("invalid assignment %d provided", s.Assignment))
+	}
+	// "Local" depends on the server, so it isn't allowed
+	if _, err := time.LoadLocation(s.TimeZone); err != nil || len(s.TimeZone) < 1 || s.TimeZone == "Local" {
+		errs = append(errs, fmt.Sprintf("invalid time zone %q", s.TimeZone))
+	} else if rule, err := s.Rule(); err != nil {
+		errs = append(errs, fmt.Sprintf("invalid rule: %s", err.Error()))
+	} else if !s.StartsAt.IsZero() && !rule.Matches(s.StartsAt.In(s.Location())) {
+		// calendar apps always count the first start as an occurrence, so it has to match the rule for them to agree
+		errs = append(errs, "the first shift must start on a day the rule repeats on, e.g. a Tuesday for BYDAY=TU")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (s *Series) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s *Series) Rule() (*Rule, error) {
+	return ParseRule(s.RRule, s.Location())
+}
+
+func (s *Series) Duration() time.Duration {
+	return s.EndsAt.Sub(s.StartsAt)
+}
+
+// returns the start times of the occurrences starting at or after from and before to, leaving out ExDates
+func (s *Series) Occurrences(from time.Time, to time.Time) ([]time.Time, error) {
+	rule, err := s.Rule()
+	if err != nil {
+		return nil, err
+	}
+	var occurrences []time.Time
+	for _, t := range rule.Between(s.StartsAt.In(s.Location()), from, to) {
+		if !s.IsExcluded(t) {
+			occurrences = append(occurrences, t)
+		}
+	}
+	return occurrences, nil
+}
+
+func (s *Series) IsExcluded(occurrence time.Time) bool {
+	for _, exdate := range s.ExDates {
+		if exdate.Equal(occurrence) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the series' RRULE and EXDATE properties, as used by calendar apps
+func (s *Series) Recurrence() []string {
+	recurrence := []string{"RRULE:" + s.RRule}
+	if len(s.ExDates) > 0 {
+		loc := s.Location()
+		dates := make([]string, len(s.ExDates))
+		for i, exdate := range s.ExDates {
+			dates[i] = exdate.In(loc).Format("20060102T150405")
+		}
+		recurrence = append(recurrence, fmt.Sprintf("EXDATE;TZID=%s:%s", s.TimeZone, strings.Join(dates, ",")))
+	}
+	return recurrence
+}
+
+// inserts the series if it doesn't have an ID yet, otherwise updates it. either way, its upcoming shifts are brought in line with it:
+// occurrences that no longer fit the series are cancelled, the rest are updated, and missing ones are created up to SeriesHorizon ahead.
+// shifts that have been overridden are left alone
+func (s *Series) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	if err := s.IsValid(); err != nil {
+		return fmt.Errorf("invalid series: %w", err)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if s.ID < 1 {
+			if err := pgxscan.Get(
+				ctx,
+				tx,
+				s,
+				`insert into shift_series(title, starts_at, ends_at, time_zone, capacity, assignment, intake_form_id, public_booking, rrule, exdates, status)
+				values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) returning *`,
+				s.Title,
+				s.StartsAt,
+				s.EndsAt,
+				s.TimeZone,
+				s.Capacity,
+				s.Assignment,
+				s.IntakeFormID,
+				s.PublicBooking,
+				s.RRule,
+				s.ExDates,
+				s.Status,
+			); err != nil {
+				return fmt.Errorf("failed to insert series: %w", err)
+			}
+			if err := audit.Record(ctx, tx, "shift_series.create", seriesAuditTarget, s.ID, nil, s); err != nil {
+				return err
+			}
+		} else {
+			before, err := getSeriesForUpdate(ctx, tx, s.ID)
+			if err != nil {
+				return err
+			}
+			if err := pgxscan.Get(
+				ctx,
+				tx,
+				s,
+				`update shift_series set title = $1, starts_at = $2, ends_at = $3, time_zone = $4, capacity = $5, assignment = $6, intake_form_id = $7, public_booking = $8, rrule = $9, exdates = $10, status = $11, updated_at = now()
+				where id = $12 returning *`,
+				s.Title,
+				s.StartsAt,
+				s.EndsAt,
+				s.TimeZone,
+				s.Capacity,
+				s.Assignment,
+				s.IntakeFormID,
+				s.PublicBooking,
+				s.RRule,
+				s.ExDates,
+				s.Status,
+				s.ID,
+			); err != nil {
+				return fmt.Errorf("failed to update series: %w", err)
+			}
+			if err := audit.Record(ctx, tx, "shift_series.update", seriesAuditTarget, s.ID, before, s); err != nil {
+				return err
+			}
+		}
+		return s.apply(ctx, tx, time.Now(), time.Now().Add(SeriesHorizon))
+	})
+}
+
+// removes a single occurrence from the series and cancels its shift, even if it has been overridden
+func (s *Series) Exclude(ctx context.Context, occurrence time.Time, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		before, err := getSeriesForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		*s = *before
+		if s.IsExcluded(occurrence) {
+			return nil
+		}
+		occurrences, err := s.Occurrences(occurrence, occurrence.Add(time.Second))
+		if err != nil {
+			return err
+		}
+		if len(occurrences) < 1 {
+			return fmt.Errorf("%s is not an occurrence of series %d", occurrence.Format(time.RFC3339), s.ID)
+		}
+		s.ExDates = append(s.ExDates, occurrence)
+		sort.Slice(s.ExDates, func(i, j int) bool { return s.ExDates[i].Before(s.ExDates[j]) })
+		if _, err := tx.Exec(ctx, "update shift_series set exdates = $1, updated_at = now() where id = $2", s.ExDates, s.ID); err != nil {
+			return fmt.Errorf("failed to update series: %w", err)
+		}
+		var cancelled []*Shift
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&cancelled,
+			"update shifts set status = $1 where series_id = $2 and occurrence_at = $3 returning *",
+			CancelledStatus,
+			s.ID,
+			occurrence,
+		); err != nil {
+			return fmt.Errorf("failed to cancel occurrence: %w", err)
+		}
+		for _, shift := range cancelled {
+			if err := shiftChanged(ctx, tx, shift); err != nil {
+				return err
+			}
+		}
+		return audit.Record(ctx, tx, "shift_series.exclude", seriesAuditTarget, s.ID, nil, occurrence)
+	})
+}
+
+// ends the series, cancelling all of its upcoming shifts including overridden ones
+func (s *Series) Stop(ctx context.Context, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		before, err := getSeriesForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		*s = *before
+		if s.Status == CancelledStatus {
+			return nil
+		}
+		s.Status = CancelledStatus
+		if _, err := tx.Exec(ctx, "update shift_series set status = $1, updated_at = now() where id = $2", s.Status, s.ID); err != nil {
+			return fmt.Errorf("failed to update series: %w", err)
+		}
+		var cancelled []*Shift
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&cancelled,
+			"update shifts set status = $1 where series_id = $2 and starts_at > now() returning *",
+			CancelledStatus,
+			s.ID,
+		); err != nil {
+			return fmt.Errorf("failed to cancel upcoming occurrences: %w", err)
+		}
+		for _, shift := range cancelled {
+			if err := shiftChanged(ctx, tx, shift); err != nil {
+				return err
+			}
+		}
+		return audit.Record(ctx, tx, "shift_series.stop", seriesAuditTarget, s.ID, before, s)
+	})
+}
+
+// creates shifts for the occurrences starting before until that haven't been created yet
+func (s *Series) Expand(ctx context.Context, until time.Time, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		current, err := getSeriesForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		*s = *current
+		if s.Status != ScheduledStatus || (s.ExpandedUntil != nil && !s.ExpandedUntil.Before(until)) {
+			return nil
+		}
+		from := time.Now()
+		if s.ExpandedUntil != nil && s.ExpandedUntil.After(from) {
+			from = *s.ExpandedUntil
+		}
+		return s.apply(ctx, tx, from, until)
+	})
+}
+
+// brings the series' shifts for occurrences starting from from until until in line with the series
+func (s *Series) apply(ctx context.Context, tx pgx.Tx, from time.Time, until time.Time) error {
+	// shifts already created further ahead need to be brought in line too
+	if s.ExpandedUntil != nil && s.ExpandedUntil.After(until) {
+		until = *s.ExpandedUntil
+	}
+	var occurrences []time.Time
+	if s.Status == ScheduledStatus {
+		var err error
+		if occurrences, err = s.Occurrences(from, until); err != nil {
+			return err
+		}
+	}
+	wanted := map[int64]bool{}
+	for _, t := range occurrences {
+		wanted[t.Unix()] = true
+	}
+	var existing []*Shift
+	if err := pgxscan.Select(
+		ctx,
+		tx,
+		&existing,
+		"select * from shifts where series_id = $1 and occurrence_at >= $2 for update",
+		s.ID,
+		from,
+	); err != nil {
+		return fmt.Errorf("failed to get series shifts: %w", err)
+	}
+	created := map[int64]bool{}
+	for _, shift := range existing {
+		created[shift.OccurrenceAt.Unix()] = true
+		if shift.Overridden {
+			continue
+		}
+		status := CancelledStatus
+		if wanted[shift.OccurrenceAt.Unix()] {
+			status = ScheduledStatus
+		}
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			shift,
+			"update shifts set title = $1, starts_at = $2, ends_at = $3, capacity = $4, assignment = $5, intake_form_id = $6, status = $7 where id = $8 returning *",
+			s.Title,
+			*shift.OccurrenceAt,
+			shift.OccurrenceAt.Add(s.Duration()),
+			s.Capacity,
+			s.Assignment,
+			s.IntakeFormID,
+			status,
+			shift.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update series shift: %w", err)
+		}
+		if err := shiftChanged(ctx, tx, shift); err != nil {
+			return err
+		}
+	}
+	for _, t := range occurrences {
+		if created[t.Unix()] {
+			continue
+		}
+		if _, err := tx.Exec(
+			ctx,
+			"insert into shifts(title, starts_at, ends_at, capacity, assignment, intake_form_id, status, series_id, occurrence_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			s.Title,
+			t,
+			t.Add(s.Duration()),
+			s.Capacity,
+			s.Assignment,
+			s.IntakeFormID,
+			ScheduledStatus,
+			s.ID,
+			t,
+		); err != nil {
+			return fmt.Errorf("failed to insert series shift: %w", err)
+		}
+	}
+	if s.ExpandedUntil == nil || until.After(*s.ExpandedUntil) {
+		s.ExpandedUntil = &until
+	}
+	if _, err := tx.Exec(ctx, "update shift_series set expanded_until = $1 where id = $2", s.ExpandedUntil, s.ID); err != nil {
+		return fmt.Errorf("failed to update series horizon: %w", err)
+	}
+	return nil
+}
+
+func GetSeriesByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Series, error) {
+	var series Series
+	if err := pgxscan.Get(ctx, pool, &series, "select * from shift_series where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get series: %w", err)
+	}
+	return &series, nil
+}
+
+// locks the series row until tx ends. returns an error if the series doesn't exist
+func getSeriesForUpdate(ctx context.Context, tx pgx.Tx, id int) (*Series, error) {
+	var series Series
+	if err := pgxscan.Get(ctx, tx, &series, "select * from shift_series where id=$1 for update", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, fmt.Errorf("series with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get series: %w", err)
+	}
+	return &series, nil
+}
+
+// returns every series, newest first
+func GetAllSeries(ctx context.Context, pool *pgxpool.Pool) ([]*Series, error) {
+	var series []*Series
+	if err := pgxscan.Select(ctx, pool, &series, "select * from shift_series order by created_at desc, id desc"); err != nil {
+		return nil, fmt.Errorf("failed to get series from db: %w", err)
+	}
+	return series, nil
+}
+
+// returns the series' shifts, ordered by occurrence
+func (s *Series) Shifts(ctx context.Context, pool *pgxpool.Pool) ([]*Shift, error) {
+	var shifts []*Shift
+	if err := pgxscan.Select(ctx, pool, &shifts, "select * from shifts where series_id = $1 order by occurrence_at", s.ID); err != nil {
+		return nil, fmt.Errorf("failed to get series shifts: %w", err)
+	}
+	return shifts, nil
+}
+
+// marks the series as changed so it's synced to the calendar again
+func touchSeries(ctx context.Context, tx pgx.Tx, id int) error {
+	if _, err := tx.Exec(ctx, "update shift_series set updated_at = now() where id = $1", id); err != nil {
+		return fmt.Errorf("failed to update series: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package shifts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how often series are checked for occurrences to create and changes to sync
+const seriesPollInterval = time.Minute
+
+// keeps a copy of each series on an external calendar, as a recurring event with exceptions for its overridden occurrences
+type SeriesSyncer interface {
+	// creates or updates the series' event, or deletes it if the series has been stopped. returns the event's ID
+	SyncSeries(ctx context.Context, s *Series, overrides []*Shift) (string, error)
+}
+
+// rolls each series' horizon forward, and syncs changed series to the calendar if syncer isn't nil.
+// any number of workers can run against the same db
+type SeriesWorker struct {
+	pool   *pgxpool.Pool
+	syncer SeriesSyncer
+}
+
+func NewSeriesWorker(pool *pgxpool.Pool, syncer SeriesSyncer) *SeriesWorker {
+	return &SeriesWorker{
+		pool:   pool,
+		syncer: syncer,
+	}
+}
+
+// runs until ctx is cancelled
+func (w *SeriesWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(seriesPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.expandDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to expand shift series: %w", err))
+		}
+		if w.syncer != nil {
+			if err := w.syncDue(ctx); err != nil {
+				fmt.Println(fmt.Errorf("failed to sync shift series: %w", err))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *SeriesWorker) expandDue(ctx context.Context) error {
+	until := time.Now().Add(SeriesHorizon)
+	var due []*Series
+	// only roll the horizon forward once a day's worth of occurrences is missing, rather than every poll
+	if err := pgxscan.Select(
+		ctx,
+		w.pool,
+		&due,
+		"select * from shift_series where status = $1 and (expanded_until is null or expanded_until < $2)",
+		ScheduledStatus,
+		until.Add(-24*time.Hour),
+	); err != nil {
+		return fmt.Errorf("failed to get series from db: %w", err)
+	}
+	for _, s := range due {
+		if err := s.Expand(ctx, until, w.pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SeriesWorker) syncDue(ctx context.Context) error {
+	var due []*Series
+	if err := pgxscan.Select(
+		ctx,
+		w.pool,
+		&due,
+		"select * from shift_series where synced_at is null or synced_at < updated_at",
+	); err != nil {
+		return fmt.Errorf("failed to get series from db: %w", err)
+	}
+	for _, s := range due {
+		shifts, err := s.Shifts(ctx, w.pool)
+		if err != nil {
+			return err
+		}
+		var overrides []*Shift
+		for _, shift := range shifts {
+			if shift.Overridden {
+				overrides = append(overrides, shift)
+			}
+		}
+		eventID, err := w.syncer.SyncSeries(ctx, s, overrides)
+		if err != nil {
+			// try the rest of the series, and this one again next time
+			fmt.Println(fmt.Errorf("failed to sync series %d: %w", s.ID, err))
+			continue
+		}
+		// if the series changed while it was being synced, it stays due
+		if _, err := w.pool.Exec(
+			ctx,
+			"update shift_series set google_event_id = nullif($1, ''), synced_at = $2 where id = $3",
+			eventID,
+			s.UpdatedAt,
+			s.ID,
+		); err != nil {
+			return fmt.Errorf("failed to save series sync: %w", err)
+		}
+	}
+	return nil
+}
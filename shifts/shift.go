@@ -0,0 +1,238 @@
+package shifts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/utils"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// target type used for audit events about shifts
+const auditTarget = "shift"
+
+// a block of time volunteers sign up for. recruits book calls with the volunteers during the shift
+type Shift struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	// maximum number of volunteers. 0 means unlimited
+	Capacity int    `json:"capacity"`
+	Status   Status `json:"status"`
+	// how calls booked during the shift are assigned to its volunteers
+	Assignment Assignment `json:"assignment"`
+	// the form recruits fill in when they book a call during the shift, if any
+	IntakeFormID *int `json:"intake_form_id"`
+	// the series the shift is an occurrence of, if any
+	SeriesID *int `json:"series_id"`
+	// the occurrence's start time according to its series. stays the same if the shift is moved
+	OccurrenceAt *time.Time `json:"occurrence_at"`
+	// whether the shift has been changed on its own, so changes to its series no longer apply to it
+	Overridden bool `json:"overridden"`
+	// IDs of the volunteers signed up for the shift. only populated by LoadVolunteers
+	VolunteerIDs []int `db:"-" json:"volunteer_ids"`
+}
+
+// creates a new instance of a shift struct
+func New(title string, startsAt time.Time, endsAt time.Time, capacity int) (*Shift, error) {
+	shift := Shift{
+		Title:      strings.TrimSpace(title),
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+		Capacity:   capacity,
+		Status:     ScheduledStatus,
+		Assignment: RoundRobinAssignment,
+	}
+	if err := shift.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid shift: %w", err)
+	}
+	return &shift, nil
+}
+
+func (s *Shift) IsValid() error {
+	var errs []string
+	if len(s.Title) < 1 {
+		errs = append(errs, "title is required")
+	}
+	if s.StartsAt.IsZero() || s.EndsAt.IsZero() {
+		errs = append(errs, "start and end times are required")
+	} else if !s.EndsAt.After(s.StartsAt) {
+		errs = append(errs, "shift must end after it starts")
+	}
+	if s.Capacity < 0 {
+		errs = append(errs, fmt.Sprintf("invalid capacity %d provided", s.Capacity))
+	}
+	if s.Status <= UndefinedStatus || s.Status >= endStatus {
+		errs = append(errs, fmt.Sprintf("invalid status %d provided", s.Status))
+	}
+	if !s.Assignment.IsValid() {
+		errs = append(errs, fmt.Sprintf("invalid assignment %d provided", s.Assignment))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// inserts the shift if it doesn't have an ID yet, otherwise updates it.
+// updating an occurrence of a series overrides it, detaching it from later changes to the series
+func (s *Shift) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	if err := s.IsValid(); err != nil {
+		return fmt.Errorf("invalid shift: %w", err)
+	}
+	// times are kept in UTC and only shown in the viewer's time zone
+	s.StartsAt, s.EndsAt = s.StartsAt.UTC(), s.EndsAt.UTC()
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if s.ID < 1 {
+			if err := pgxscan.Get(
+				ctx,
+				tx,
+				&s.ID,
+				"insert into shifts(title, starts_at, ends_at, capacity, status, assignment, intake_form_id) values ($1, $2, $3, $4, $5, $6, $7) returning id",
+				s.Title,
+				s.StartsAt,
+				s.EndsAt,
+				s.Capacity,
+				s.Status,
+				s.Assignment,
+				s.IntakeFormID,
+			); err != nil {
+				return fmt.Errorf("failed to insert shift: %w", err)
+			}
+			return audit.Record(ctx, tx, "shift.create", auditTarget, s.ID, nil, s)
+		}
+		before, err := GetShiftForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		if before.SeriesID != nil {
+			s.Overridden = true
+			// the series' copy on the calendar needs the override too
+			if err := touchSeries(ctx, tx, *before.SeriesID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(
+			ctx,
+			"update shifts set title = $1, starts_at = $2, ends_at = $3, capacity = $4, status = $5, assignment = $6, intake_form_id = $7, overridden = $8 where id = $9",
+			s.Title,
+			s.StartsAt,
+			s.EndsAt,
+			s.Capacity,
+			s.Status,
+			s.Assignment,
+			s.IntakeFormID,
+			s.Overridden,
+			s.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update shift: %w", err)
+		}
+		if err := audit.Record(ctx, tx, "shift.update", auditTarget, s.ID, before, s); err != nil {
+			return err
+		}
+		// cancelling or moving the shift cancels the calls that no longer fit it
+		if err := shiftChanged(ctx, tx, s); err != nil {
+			return err
+		}
+		// a larger capacity opens spots for the waitlist
+		ids, err := VolunteerIDs(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		_, err = offerOpenSpots(ctx, tx, s, ids)
+		return err
+	})
+}
+
+func GetShiftByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Shift, error) {
+	var shift Shift
+	if err := pgxscan.Get(ctx, pool, &shift, "select * from shifts where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get shift: %w", err)
+	}
+	return &shift, nil
+}
+
+// returns the shifts with the given IDs, keyed by ID. IDs without a shift are left out
+func GetShiftsByIDs(ctx context.Context, ids []int, pool *pgxpool.Pool) (map[int]*Shift, error) {
+	byID := map[int]*Shift{}
+	if len(ids) < 1 {
+		return byID, nil
+	}
+	var shifts []*Shift
+	if err := pgxscan.Select(ctx, pool, &shifts, "select * from shifts where id = any($1)", ids); err != nil {
+		return nil, fmt.Errorf("failed to get shifts from db: %w", err)
+	}
+	for _, s := range shifts {
+		byID[s.ID] = s
+	}
+	return byID, nil
+}
+
+// locks the shift row until tx ends, serializing changes to the shift's volunteers and bookings.
+// returns an error if the shift doesn't exist
+func GetShiftForUpdate(ctx context.Context, tx pgx.Tx, id int) (*Shift, error) {
+	var shift Shift
+	if err := pgxscan.Get(ctx, tx, &shift, "select * from shifts where id=$1 for update", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, fmt.Errorf("shift with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get shift: %w", err)
+	}
+	return &shift, nil
+}
+
+// narrows the shifts returned by FindShifts. zero values are ignored
+type Filter struct {
+	// only shifts ending after From
+	From time.Time
+	// only shifts starting before To
+	To     time.Time
+	Status Status
+	// only shifts the volunteer is signed up for
+	VolunteerID int
+	Limit       int
+	Offset      int
+}
+
+func (f Filter) where() *utils.Where {
+	var where utils.Where
+	if !f.From.IsZero() {
+		where.Add("ends_at > $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where.Add("starts_at < $%d", f.To)
+	}
+	if f.Status != UndefinedStatus {
+		where.Add("status = $%d", f.Status)
+	}
+	if f.VolunteerID > 0 {
+		where.Add("id in (select shift_id from shift_volunteers where user_id = $%d)", f.VolunteerID)
+	}
+	return &where
+}
+
+// returns a page of shifts matching the filter, ordered by start time, along with the total number of matching shifts
+func FindShifts(ctx context.Context, filter Filter, pool *pgxpool.Pool) ([]*Shift, int, error) {
+	where := filter.where()
+	var total int
+	if err := pgxscan.Get(ctx, pool, &total, "select count(*) from shifts"+where.String(), where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count shifts: %w", err)
+	}
+	query := where.Paginate("select * from shifts"+where.String()+" order by starts_at, id", filter.Limit, filter.Offset)
+	var shifts []*Shift
+	if err := pgxscan.Select(ctx, pool, &shifts, query, where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get shifts from db: %w", err)
+	}
+	return shifts, total, nil
+}
@@ -0,0 +1,220 @@
+package shifts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/webhooks"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	ErrShiftFull      = errors.New("shift is full")
+	ErrNotOnShift     = errors.New("volunteer is not signed up for the shift")
+	ErrAlreadyOnShift = errors.New("volunteer is already signed up for the shift")
+)
+
+// webhook payload describing a volunteer joining or leaving a shift
+type volunteerChange struct {
+	Shift  *Shift `json:"shift"`
+	UserID int    `json:"user_id"`
+}
+
+// populates VolunteerIDs from the db
+func (s *Shift) LoadVolunteers(ctx context.Context, pool *pgxpool.Pool) error {
+	return LoadVolunteers(ctx, []*Shift{s}, pool)
+}
+
+// populates VolunteerIDs for each of the provided shifts with a single query
+func LoadVolunteers(ctx context.Context, shifts []*Shift, pool *pgxpool.Pool) error {
+	if len(shifts) < 1 {
+		return nil
+	}
+	ids := make([]int, len(shifts))
+	byID := map[int]*Shift{}
+	for i, s := range shifts {
+		ids[i] = s.ID
+		s.VolunteerIDs = []int{}
+		byID[s.ID] = s
+	}
+	var rows []struct {
+		ShiftID int
+		UserID  int
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&rows,
+		"select shift_id, user_id from shift_volunteers where shift_id = any($1) order by created_at, user_id",
+		ids,
+	); err != nil {
+		return fmt.Errorf("failed to get shift volunteers: %w", err)
+	}
+	for _, row := range rows {
+		if s, ok := byID[row.ShiftID]; ok {
+			s.VolunteerIDs = append(s.VolunteerIDs, row.UserID)
+		}
+	}
+	return nil
+}
+
+// returns the IDs of the volunteers signed up for the shift, in sign up order
+func VolunteerIDs(ctx context.Context, db pgxscan.Querier, shiftID int) ([]int, error) {
+	var ids []int
+	if err := pgxscan.Select(
+		ctx,
+		db,
+		&ids,
+		"select user_id from shift_volunteers where shift_id = $1 order by created_at, user_id",
+		shiftID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get shift volunteers: %w", err)
+	}
+	return ids, nil
+}
+
+// signs the volunteer up for the shift, taking them off its waitlist. returns ErrShiftFull if the shift is at capacity,
+// counting spots held for waitlisted volunteers other than this one. signing up a volunteer who is already on the shift is a no-op
+func (s *Shift) AddVolunteer(ctx context.Context, userID int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// lock the shift so concurrent sign ups can't exceed capacity
+		shift, err := GetShiftForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		if shift.Status != ScheduledStatus {
+			return fmt.Errorf("cannot sign up for a %s shift", shift.Status.String())
+		}
+		ids, err := VolunteerIDs(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id == userID {
+				s.VolunteerIDs = ids
+				return nil
+			}
+		}
+		// spots that opened up go to the waitlist first
+		waitlist, err := offerOpenSpots(ctx, tx, shift, ids)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		open := shift.openSpots(ids, waitlist, now)
+		var entry *WaitlistEntry
+		for _, e := range waitlist {
+			if e.UserID == userID {
+				entry = e
+			}
+		}
+		if entry != nil && entry.IsOffered(now) {
+			// the spot held for the volunteer is theirs to take
+			open++
+		}
+		if open < 1 {
+			return ErrShiftFull
+		}
+		if _, err := tx.Exec(ctx, "insert into shift_volunteers(shift_id, user_id) values ($1, $2)", s.ID, userID); err != nil {
+			return fmt.Errorf("failed to add volunteer to shift: %w", err)
+		}
+		if entry != nil {
+			if _, err := tx.Exec(ctx, "delete from shift_waitlist where shift_id = $1 and user_id = $2", s.ID, userID); err != nil {
+				return fmt.Errorf("failed to remove volunteer from waitlist: %w", err)
+			}
+			if err := audit.Record(ctx, tx, "shift.waitlist_leave", auditTarget, s.ID, entry, nil); err != nil {
+				return err
+			}
+		}
+		s.VolunteerIDs = append(ids, userID)
+		if err := audit.Record(ctx, tx, "shift.volunteer_add", auditTarget, s.ID, ids, s.VolunteerIDs); err != nil {
+			return err
+		}
+		shift.VolunteerIDs = s.VolunteerIDs
+		return webhooks.Enqueue(ctx, tx, webhooks.ShiftVolunteerAddedEvent, volunteerChange{Shift: shift, UserID: userID})
+	})
+}
+
+// removes the volunteer from the shift, holding their spot for the next waitlisted volunteer. removing a volunteer who isn't on the shift is a no-op.
+// volunteers with calls booked during the shift can't leave it, and need someone to cover it instead
+func (s *Shift) RemoveVolunteer(ctx context.Context, userID int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		shift, err := GetShiftForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		ids, err := VolunteerIDs(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		remaining := []int{}
+		for _, id := range ids {
+			if id != userID {
+				remaining = append(remaining, id)
+			}
+		}
+		s.VolunteerIDs = remaining
+		if len(remaining) == len(ids) {
+			return nil
+		}
+		if err := checkLeave(ctx, tx, shift, userID); err != nil {
+			s.VolunteerIDs = ids
+			return err
+		}
+		if _, err := tx.Exec(ctx, "delete from shift_volunteers where shift_id = $1 and user_id = $2", s.ID, userID); err != nil {
+			return fmt.Errorf("failed to remove volunteer from shift: %w", err)
+		}
+		if err := audit.Record(ctx, tx, "shift.volunteer_remove", auditTarget, s.ID, ids, remaining); err != nil {
+			return err
+		}
+		if _, err := offerOpenSpots(ctx, tx, shift, remaining); err != nil {
+			return err
+		}
+		shift.VolunteerIDs = s.VolunteerIDs
+		return webhooks.Enqueue(ctx, tx, webhooks.ShiftVolunteerRemovedEvent, volunteerChange{Shift: shift, UserID: userID})
+	})
+}
+
+// gives the volunteer's spot on the shift to another volunteer, keeping its place in sign up order and taking
+// the other volunteer off the shift's waitlist. the shift must be locked by tx
+func TransferVolunteer(ctx context.Context, tx pgx.Tx, shift *Shift, fromID int, toID int) error {
+	ids, err := VolunteerIDs(ctx, tx, shift.ID)
+	if err != nil {
+		return err
+	}
+	after := make([]int, len(ids))
+	found := false
+	for i, id := range ids {
+		if id == toID {
+			return ErrAlreadyOnShift
+		}
+		after[i] = id
+		if id == fromID {
+			after[i] = toID
+			found = true
+		}
+	}
+	if !found {
+		return ErrNotOnShift
+	}
+	if _, err := tx.Exec(ctx, "update shift_volunteers set user_id = $1 where shift_id = $2 and user_id = $3", toID, shift.ID, fromID); err != nil {
+		return fmt.Errorf("failed to transfer shift: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "delete from shift_waitlist where shift_id = $1 and user_id = $2", shift.ID, toID); err != nil {
+		return fmt.Errorf("failed to remove volunteer from waitlist: %w", err)
+	}
+	if err := audit.Record(ctx, tx, "shift.volunteer_transfer", auditTarget, shift.ID, ids, after); err != nil {
+		return err
+	}
+	shift.VolunteerIDs = after
+	if err := webhooks.Enqueue(ctx, tx, webhooks.ShiftVolunteerRemovedEvent, volunteerChange{Shift: shift, UserID: fromID}); err != nil {
+		return err
+	}
+	return webhooks.Enqueue(ctx, tx, webhooks.ShiftVolunteerAddedEvent, volunteerChange{Shift: shift, UserID: toID})
+}
@@ -0,0 +1,258 @@
+package shifts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how long a waitlisted volunteer has to confirm a spot held for them before it's offered to the next volunteer.
+// offers never last past the start of the shift
+const WaitlistConfirmWindow = 12 * time.Hour
+
+var ErrShiftNotFull = errors.New("shift has open spots")
+
+// a volunteer waiting for a spot on a full shift. when a spot opens up, it's held for the first volunteer waiting
+// until they confirm it by signing up, decline it by leaving the waitlist, or the offer expires
+type WaitlistEntry struct {
+	ShiftID   int       `json:"shift_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// when a spot was held for the volunteer. nil while they're still waiting
+	OfferedAt      *time.Time `json:"offered_at"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at"`
+	// when the volunteer was emailed about the offer
+	NotifiedAt *time.Time `json:"-"`
+}
+
+// reports whether a spot is being held for the volunteer at t
+func (e *WaitlistEntry) IsOffered(t time.Time) bool {
+	return e.OfferExpiresAt != nil && t.Before(*e.OfferExpiresAt)
+}
+
+// returns the shift's waitlist in order, including volunteers with a spot held for them
+func (s *Shift) Waitlist(ctx context.Context, pool *pgxpool.Pool) ([]*WaitlistEntry, error) {
+	return getWaitlist(ctx, pool, s.ID)
+}
+
+func getWaitlist(ctx context.Context, db pgxscan.Querier, shiftID int) ([]*WaitlistEntry, error) {
+	var entries []*WaitlistEntry
+	if err := pgxscan.Select(
+		ctx,
+		db,
+		&entries,
+		"select * from shift_waitlist where shift_id = $1 order by created_at, user_id",
+		shiftID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get shift waitlist: %w", err)
+	}
+	return entries, nil
+}
+
+// returns the user's place on the waitlist of each of the shifts they're waiting for, keyed by shift ID
+func GetWaitlistEntries(ctx context.Context, userID int, shiftIDs []int, pool *pgxpool.Pool) (map[int]*WaitlistEntry, error) {
+	byShift := map[int]*WaitlistEntry{}
+	if len(shiftIDs) < 1 {
+		return byShift, nil
+	}
+	var entries []*WaitlistEntry
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&entries,
+		"select * from shift_waitlist where user_id = $1 and shift_id = any($2)",
+		userID,
+		shiftIDs,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get waitlist entries: %w", err)
+	}
+	for _, e := range entries {
+		byShift[e.ShiftID] = e
+	}
+	return byShift, nil
+}
+
+// returns the number of spots held for waitlisted volunteers on each of the shifts, keyed by shift ID. shifts without any are left out
+func CountHeldSpots(ctx context.Context, shiftIDs []int, pool *pgxpool.Pool) (map[int]int, error) {
+	held := map[int]int{}
+	if len(shiftIDs) < 1 {
+		return held, nil
+	}
+	var rows []struct {
+		ShiftID int
+		Count   int
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&rows,
+		"select shift_id, count(*) as count from shift_waitlist where shift_id = any($1) and offer_expires_at > $2 group by shift_id",
+		shiftIDs,
+		time.Now(),
+	); err != nil {
+		return nil, fmt.Errorf("failed to count held spots: %w", err)
+	}
+	for _, row := range rows {
+		held[row.ShiftID] = row.Count
+	}
+	return held, nil
+}
+
+// adds the volunteer to the end of the shift's waitlist. returns ErrShiftNotFull if they can sign up instead.
+// joining a waitlist the volunteer is already on, or for a shift they're already on, is a no-op
+func (s *Shift) JoinWaitlist(ctx context.Context, userID int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		shift, err := GetShiftForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		if shift.Status != ScheduledStatus {
+			return fmt.Errorf("cannot join the waitlist for a %s shift", shift.Status.String())
+		}
+		if !time.Now().Before(shift.StartsAt) {
+			return fmt.Errorf("cannot join the waitlist for a shift that has started")
+		}
+		ids, err := VolunteerIDs(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if id == userID {
+				return nil
+			}
+		}
+		entries, err := offerOpenSpots(ctx, tx, shift, ids)
+		if err != nil {
+			return err
+		}
+		if shift.openSpots(ids, entries, time.Now()) > 0 {
+			return ErrShiftNotFull
+		}
+		tag, err := tx.Exec(ctx, "insert into shift_waitlist(shift_id, user_id) values ($1, $2) on conflict do nothing", s.ID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add volunteer to waitlist: %w", err)
+		}
+		if tag.RowsAffected() < 1 {
+			return nil
+		}
+		return audit.Record(ctx, tx, "shift.waitlist_join", auditTarget, s.ID, nil, userID)
+	})
+}
+
+// removes the volunteer from the shift's waitlist. if a spot was being held for them, it's offered to the next volunteer.
+// leaving a waitlist the volunteer isn't on is a no-op
+func (s *Shift) LeaveWaitlist(ctx context.Context, userID int, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		shift, err := GetShiftForUpdate(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		var removed []*WaitlistEntry
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&removed,
+			"delete from shift_waitlist where shift_id = $1 and user_id = $2 returning *",
+			s.ID,
+			userID,
+		); err != nil {
+			return fmt.Errorf("failed to remove volunteer from waitlist: %w", err)
+		}
+		if len(removed) < 1 {
+			return nil
+		}
+		if err := audit.Record(ctx, tx, "shift.waitlist_leave", auditTarget, s.ID, removed[0], nil); err != nil {
+			return err
+		}
+		ids, err := VolunteerIDs(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		_, err = offerOpenSpots(ctx, tx, shift, ids)
+		return err
+	})
+}
+
+// holds each open spot on the shift for the next volunteer waiting, after letting expired offers go.
+// the shift must be locked by tx. returns the shift's waitlist as it stands afterwards
+func offerOpenSpots(ctx context.Context, tx pgx.Tx, shift *Shift, volunteerIDs []int) ([]*WaitlistEntry, error) {
+	now := time.Now()
+	var expired []*WaitlistEntry
+	if err := pgxscan.Select(
+		ctx,
+		tx,
+		&expired,
+		"delete from shift_waitlist where shift_id = $1 and offer_expires_at <= $2 returning *",
+		shift.ID,
+		now,
+	); err != nil {
+		return nil, fmt.Errorf("failed to remove expired waitlist offers: %w", err)
+	}
+	for _, e := range expired {
+		if err := audit.Record(ctx, tx, "shift.waitlist_expire", auditTarget, shift.ID, e, nil); err != nil {
+			return nil, err
+		}
+	}
+	entries, err := getWaitlist(ctx, tx, shift.ID)
+	if err != nil {
+		return nil, err
+	}
+	if shift.Status != ScheduledStatus || !now.Before(shift.StartsAt) {
+		return entries, nil
+	}
+	open := shift.openSpots(volunteerIDs, entries, now)
+	if shift.Capacity < 1 {
+		// there's room for everyone
+		open = len(entries)
+	}
+	expiresAt := now.Add(WaitlistConfirmWindow)
+	if expiresAt.After(shift.StartsAt) {
+		expiresAt = shift.StartsAt
+	}
+	for _, e := range entries {
+		if open < 1 {
+			break
+		}
+		if e.OfferedAt != nil {
+			continue
+		}
+		if _, err := tx.Exec(
+			ctx,
+			"update shift_waitlist set offered_at = $1, offer_expires_at = $2, notified_at = null where shift_id = $3 and user_id = $4",
+			now,
+			expiresAt,
+			e.ShiftID,
+			e.UserID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to offer spot to waitlisted volunteer: %w", err)
+		}
+		e.OfferedAt, e.OfferExpiresAt, e.NotifiedAt = &now, &expiresAt, nil
+		if err := audit.Record(ctx, tx, "shift.waitlist_offer", auditTarget, shift.ID, nil, e); err != nil {
+			return nil, err
+		}
+		open--
+	}
+	return entries, nil
+}
+
+// returns the number of spots on the shift that are neither taken nor held for a waitlisted volunteer.
+// a shift without a capacity always has a spot open
+func (s *Shift) openSpots(volunteerIDs []int, waitlist []*WaitlistEntry, now time.Time) int {
+	if s.Capacity < 1 {
+		return 1
+	}
+	open := s.Capacity - len(volunteerIDs)
+	for _, e := range waitlist {
+		if e.IsOffered(now) {
+			open--
+		}
+	}
+	return open
+}
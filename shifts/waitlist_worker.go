@@ -0,0 +1,129 @@
+package shifts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how often waitlists are checked for expired offers and offers to send
+const waitlistPollInterval = time.Minute
+
+// tells waitlisted volunteers a spot is being held for them
+type WaitlistNotifier interface {
+	NotifyOffer(ctx context.Context, shift *Shift, entry *WaitlistEntry) error
+}
+
+// moves expired offers on to the next waitlisted volunteer, and emails volunteers about the offers made to them.
+// any number of workers can run against the same db
+type WaitlistWorker struct {
+	pool     *pgxpool.Pool
+	notifier WaitlistNotifier
+}
+
+func NewWaitlistWorker(pool *pgxpool.Pool, notifier WaitlistNotifier) *WaitlistWorker {
+	return &WaitlistWorker{
+		pool:     pool,
+		notifier: notifier,
+	}
+}
+
+// runs until ctx is cancelled
+func (w *WaitlistWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(waitlistPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.offerDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to offer waitlisted spots: %w", err))
+		}
+		if err := w.notifyDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to notify waitlisted volunteers: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// offers spots on upcoming shifts with expired offers or volunteers still waiting.
+// spots normally open up as volunteers leave, but offers expire and capacities can change without anyone leaving
+func (w *WaitlistWorker) offerDue(ctx context.Context) error {
+	var shiftIDs []int
+	if err := pgxscan.Select(
+		ctx,
+		w.pool,
+		&shiftIDs,
+		`select distinct w.shift_id from shift_waitlist w
+		join shifts s on s.id = w.shift_id
+		where s.status = $1 and s.starts_at > $2 and (w.offered_at is null or w.offer_expires_at <= $2)`,
+		ScheduledStatus,
+		time.Now(),
+	); err != nil {
+		return fmt.Errorf("failed to get waitlisted shifts from db: %w", err)
+	}
+	for _, id := range shiftIDs {
+		if err := w.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+			shift, err := GetShiftForUpdate(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			ids, err := VolunteerIDs(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			_, err = offerOpenSpots(ctx, tx, shift, ids)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sends each offer that hasn't been sent yet. offers are locked while they're sent so no other worker sends them too.
+// an offer that fails to send is tried again next time
+func (w *WaitlistWorker) notifyDue(ctx context.Context) error {
+	return w.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var entries []*WaitlistEntry
+		if err := pgxscan.Select(
+			ctx,
+			tx,
+			&entries,
+			`select w.* from shift_waitlist w
+			join shifts s on s.id = w.shift_id
+			where w.notified_at is null and w.offer_expires_at > $1 and s.status = $2
+			order by w.offered_at limit 100
+			for update of w skip locked`,
+			time.Now(),
+			ScheduledStatus,
+		); err != nil {
+			return fmt.Errorf("failed to get waitlist offers from db: %w", err)
+		}
+		for _, entry := range entries {
+			var shift Shift
+			if err := pgxscan.Get(ctx, tx, &shift, "select * from shifts where id = $1", entry.ShiftID); err != nil {
+				return fmt.Errorf("failed to get shift: %w", err)
+			}
+			if err := w.notifier.NotifyOffer(ctx, &shift, entry); err != nil {
+				fmt.Println(fmt.Errorf("failed to notify user %d of waitlist offer for shift %d: %w", entry.UserID, entry.ShiftID, err))
+				continue
+			}
+			if _, err := tx.Exec(
+				ctx,
+				"update shift_waitlist set notified_at = $1 where shift_id = $2 and user_id = $3",
+				time.Now(),
+				entry.ShiftID,
+				entry.UserID,
+			); err != nil {
+				return fmt.Errorf("failed to save waitlist notification: %w", err)
+			}
+		}
+		return nil
+	})
+}
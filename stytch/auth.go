@@ -4,13 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/gofiber/storage/redis"
 	"github.com/stytchauth/stytch-go/v5/stytch"
 	"github.com/stytchauth/stytch-go/v5/stytch/config"
 	"github.com/stytchauth/stytch-go/v5/stytch/stytchapi"
 )
 
+// stytch JWTs are valid for 5 minutes. once a JWT is older than this it is considered near expiry,
+// and the session is authenticated against the stytch API instead, which also issues a fresh JWT
+const jwtMaxAge = 4 * time.Minute
+
+// the credentials stytch issues for an authenticated session.
+// the JWT can be validated locally, while the token always requires a round trip to the stytch API
+type Session struct {
+	Token string
+	JWT   string
+}
+
 type Client struct {
 	api *stytchapi.API
 	Env config.Env
@@ -27,36 +38,64 @@ func NewClient(env config.Env, projectID string, secret string) (*Client, error)
 	}, nil
 }
 
-// on success, returns a session token valid for 60 minutes
-func (c *Client) AuthenticateOauth(token string, sessionToken string, validator func(stytchID string) error) (string, error) {
+// on success, returns a session valid for 60 minutes
+func (c *Client) AuthenticateOauth(token string, current Session, validator func(stytchID string) error) (Session, error) {
 	if len(token) < 1 {
-		return "", errors.New("empty token")
+		return Session{}, errors.New("empty token")
 	}
 	resp, err := c.api.OAuth.Authenticate(&stytch.OAuthAuthenticateParams{
 		Token:                  token,
 		SessionDurationMinutes: 60,
-		SessionToken:           sessionToken,
+		SessionToken:           current.Token,
 	})
 	if err != nil {
-		return "", fmt.Errorf("unable to authenticate oauth token: %w", err)
+		return Session{}, fmt.Errorf("unable to authenticate oauth token: %w", err)
 	}
 
 	if err := validator(resp.UserID); err != nil {
-		return "", fmt.Errorf("failed to validate user: %w", err)
+		return Session{}, fmt.Errorf("failed to validate user: %w", err)
 	}
 
-	return resp.SessionToken, nil
+	return Session{
+		Token: resp.SessionToken,
+		JWT:   resp.SessionJWT,
+	}, nil
 }
 
-func (c *Client) AuthenticateSession(ctx context.Context, sessionToken string, storage *redis.Storage) (string, error) {
+// validates the session JWT locally against the cached JWKS when possible. when the JWT is missing,
+// invalid or near expiry, falls back to the stytch API, which extends the session by 60 minutes.
+// on success, returns the stytch user ID and the session, which has a new JWT if the API was called
+func (c *Client) AuthenticateSession(ctx context.Context, current Session) (string, Session, error) {
+	if len(current.JWT) > 0 {
+		sess, err := c.api.Sessions.AuthenticateJWTLocal(current.JWT, jwtMaxAge)
+		if err == nil && !sessionExpired(sess.ExpiresAt) {
+			return sess.UserID, current, nil
+		}
+	}
 	resp, err := c.api.Sessions.Authenticate(&stytch.SessionsAuthenticateParams{
-		SessionToken:           sessionToken,
+		SessionToken:           current.Token,
 		SessionDurationMinutes: 60,
 	})
 	if err != nil {
-		return "", fmt.Errorf("unable to authenticate session token: %w", err)
+		return "", Session{}, fmt.Errorf("unable to authenticate session token: %w", err)
+	}
+	refreshed := Session{
+		Token: current.Token,
+		JWT:   resp.SessionJWT,
+	}
+	if len(resp.SessionToken) > 0 {
+		refreshed.Token = resp.SessionToken
+	}
+	return resp.User.UserID, refreshed, nil
+}
+
+// reports whether a stytch session expires_at timestamp is in the past. unparsable values are treated as expired
+func sessionExpired(expiresAt string) bool {
+	exp, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return true
 	}
-	return resp.User.UserID, nil
+	return exp.Before(time.Now())
 }
 
 func (c *Client) RevokeSession(sessionToken string) error {
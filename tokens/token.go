@@ -0,0 +1,172 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/users"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// prepended to every token so leaked tokens are easy to recognize
+	secretPrefix = "sched_"
+	// number of leading characters of the secret stored in the clear, so tokens can be told apart
+	displayLength = len(secretPrefix) + 6
+)
+
+// target type used for audit events about API tokens
+const auditTarget = "api_token"
+
+// a credential scripts use to call the API as a user, limited to a set of scopes.
+// only a hash of the secret is stored, so it can't be recovered after the token is created
+type Token struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	// the first few characters of the secret
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	// permissions the token is limited to. the user must also hold them
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// only populated by GetTokens
+	UserEmail string `json:"-"`
+}
+
+// returns the token's scopes as permissions, ready to be assigned to users.User.Scopes
+func (t *Token) Permissions() []users.Permission {
+	perms := make([]users.Permission, len(t.Scopes))
+	for i, scope := range t.Scopes {
+		perms[i] = users.Permission(scope)
+	}
+	return perms
+}
+
+func (t *Token) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// creates a token for the user, returning it along with the secret. the secret is not stored and can't be retrieved again
+func New(ctx context.Context, userID int, name string, scopes []users.Permission, pool *pgxpool.Pool) (*Token, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) < 1 {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if len(scopes) < 1 {
+		return nil, "", fmt.Errorf("at least one scope is required")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := secretPrefix + base64.RawURLEncoding.EncodeToString(b)
+	token := Token{
+		UserID: userID,
+		Name:   name,
+		Prefix: secret[:displayLength],
+		Hash:   hash(secret),
+		Scopes: make([]string, len(scopes)),
+	}
+	for i, scope := range scopes {
+		token.Scopes[i] = string(scope)
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			&token,
+			"insert into api_tokens(user_id, name, prefix, hash, scopes) values ($1, $2, $3, $4, $5) returning *",
+			token.UserID,
+			token.Name,
+			token.Prefix,
+			token.Hash,
+			token.Scopes,
+		); err != nil {
+			return fmt.Errorf("failed to insert api token: %w", err)
+		}
+		return audit.Record(ctx, tx, "token.create", auditTarget, token.ID, nil, token)
+	}); err != nil {
+		return nil, "", err
+	}
+	return &token, secret, nil
+}
+
+// looks up the unrevoked token matching the secret and records that it was used.
+// returns nil if the secret doesn't match any usable token
+func Authenticate(ctx context.Context, secret string, pool *pgxpool.Pool) (*Token, error) {
+	if !strings.HasPrefix(secret, secretPrefix) {
+		return nil, nil
+	}
+	var token Token
+	if err := pgxscan.Get(
+		ctx,
+		pool,
+		&token,
+		"update api_tokens set last_used_at = now() where hash = $1 and revoked_at is null returning *",
+		hash(secret),
+	); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to authenticate api token: %w", err)
+	}
+	return &token, nil
+}
+
+func GetTokenByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Token, error) {
+	var token Token
+	if err := pgxscan.Get(ctx, pool, &token, "select * from api_tokens where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+	return &token, nil
+}
+
+// returns every token, newest first, including revoked ones
+func GetTokens(ctx context.Context, pool *pgxpool.Pool) ([]*Token, error) {
+	var tokens []*Token
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&tokens,
+		"select t.*, u.email as user_email from api_tokens t join users u on u.id = t.user_id order by t.created_at desc, t.id desc",
+	); err != nil {
+		return nil, fmt.Errorf("failed to get api tokens from db: %w", err)
+	}
+	return tokens, nil
+}
+
+// permanently disables the token. revoking an already revoked token is a no-op
+func (t *Token) Revoke(ctx context.Context, pool *pgxpool.Pool) error {
+	if t.IsRevoked() {
+		return nil
+	}
+	before := *t
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := pgxscan.Get(ctx, tx, &t.RevokedAt, "update api_tokens set revoked_at = now() where id = $1 returning revoked_at", t.ID); err != nil {
+			return fmt.Errorf("failed to revoke api token: %w", err)
+		}
+		return audit.Record(ctx, tx, "token.revoke", auditTarget, t.ID, before, t)
+	})
+}
+
+// the secrets are random and long, so a fast unsalted hash is enough to keep them from being usable if the db leaks
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,327 @@
+package users
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/auth"
+	"scheduler/mail"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/gofiber/template/html"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// largest number of rows accepted in a single import
+const MaxImportRows = 2000
+
+// what an import row does to the users list
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+)
+
+type ImportStatus int
+
+const (
+	UndefinedImportStatus ImportStatus = iota
+	// parsed and waiting to be confirmed
+	PreviewImportStatus
+	RunningImportStatus
+	FinishedImportStatus
+	// new statuses should go here so we don't change the int values associated with each status
+	endImportStatus
+)
+
+func (s ImportStatus) String() string {
+	switch s {
+	case PreviewImportStatus:
+		return "preview"
+	case RunningImportStatus:
+		return "running"
+	case FinishedImportStatus:
+		return "finished"
+	default:
+		return ""
+	}
+}
+
+// one line of an uploaded CSV file
+type ImportRow struct {
+	// line number in the file, counting the header
+	Line  int    `json:"line"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Type  Type   `json:"type"`
+	// ImportCreate or ImportUpdate. empty when the row is invalid
+	Action string `json:"action"`
+	// why the row is invalid, or why running it failed
+	Error string `json:"error"`
+	// outcome of running the row, e.g. "invited"
+	Result string `json:"result"`
+}
+
+func (r *ImportRow) IsValid() bool {
+	return len(r.Action) > 0
+}
+
+// a CSV upload of volunteers and recruits. rows are validated and previewed first,
+// then run in the background once an admin confirms them
+type Import struct {
+	ID         int
+	CreatedBy  int
+	Filename   string
+	Status     ImportStatus
+	Rows       []*ImportRow
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// returns the number of rows with each action, and the number of invalid rows
+func (imp *Import) Counts() map[string]int {
+	counts := map[string]int{ImportCreate: 0, ImportUpdate: 0, "invalid": 0, "failed": 0}
+	for _, row := range imp.Rows {
+		if row.IsValid() {
+			counts[row.Action]++
+			if len(row.Error) > 0 {
+				counts["failed"]++
+			}
+		} else {
+			counts["invalid"]++
+		}
+	}
+	return counts
+}
+
+// reads and validates a CSV file with name, email and type columns in any order, identified by its header row.
+// each valid row is marked as a create or update depending on whether a user with the email already exists
+func ParseImport(ctx context.Context, r io.Reader, pool *pgxpool.Pool) ([]*ImportRow, error) {
+	reader := csv.NewReader(r)
+	// rows with missing or extra fields are reported per row rather than failing the whole file
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("file is empty")
+		}
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, col := range header {
+		// spreadsheet apps like to start UTF-8 files with a byte order mark
+		col = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\uFEFF")))
+		columns[col] = i
+	}
+	for _, col := range []string{"name", "email", "type"} {
+		if _, ok := columns[col]; !ok {
+			return nil, fmt.Errorf("missing %q column. the first row must name the name, email and type columns", col)
+		}
+	}
+
+	rows := []*ImportRow{}
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if len(rows) >= MaxImportRows {
+			return nil, fmt.Errorf("files are limited to %d rows", MaxImportRows)
+		}
+		row := &ImportRow{}
+		rows = append(rows, row)
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				row.Line = parseErr.StartLine
+			}
+			row.Error = fmt.Sprintf("failed to read row: %s", err.Error())
+			continue
+		}
+		row.Line, _ = reader.FieldPos(0)
+		field := func(col string) string {
+			if i := columns[col]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.Name = field("name")
+		row.Email = field("email")
+		addr, err := netmail.ParseAddress(row.Email)
+		if err != nil {
+			row.Error = fmt.Sprintf("invalid email %q", row.Email)
+			continue
+		}
+		row.Email = addr.Address
+		if len(row.Name) < 1 {
+			row.Name = addr.Name
+		}
+		row.Type, err = ParseType(strings.ToLower(field("type")))
+		if err != nil || (row.Type != VolunteerType && row.Type != RecruitType) {
+			row.Error = fmt.Sprintf("invalid type %q: must be volunteer or recruit", field("type"))
+			continue
+		}
+		if first, ok := seen[strings.ToLower(row.Email)]; ok {
+			row.Error = fmt.Sprintf("duplicate of line %d", first)
+			continue
+		}
+		seen[strings.ToLower(row.Email)] = row.Line
+		existing, err := GetUserByEmail(ctx, row.Email, pool)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case existing == nil:
+			row.Action = ImportCreate
+		case existing.Type == AdminType:
+			row.Error = "admins can't be changed by an import"
+		default:
+			row.Action = ImportUpdate
+		}
+	}
+	if len(rows) < 1 {
+		return nil, fmt.Errorf("file has no rows after the header")
+	}
+	return rows, nil
+}
+
+// stores the parsed rows for preview
+func NewImport(ctx context.Context, createdBy int, filename string, rows []*ImportRow, pool *pgxpool.Pool) (*Import, error) {
+	imp := Import{
+		CreatedBy: createdBy,
+		Filename:  filename,
+		Status:    PreviewImportStatus,
+		Rows:      rows,
+	}
+	if err := pgxscan.Get(
+		ctx,
+		pool,
+		&imp,
+		"insert into user_imports(created_by, filename, status, rows) values ($1, $2, $3, $4) returning *",
+		imp.CreatedBy,
+		imp.Filename,
+		imp.Status,
+		imp.Rows,
+	); err != nil {
+		return nil, fmt.Errorf("failed to insert import: %w", err)
+	}
+	return &imp, nil
+}
+
+func GetImportByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Import, error) {
+	var imp Import
+	if err := pgxscan.Get(ctx, pool, &imp, "select * from user_imports where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get import: %w", err)
+	}
+	return &imp, nil
+}
+
+// returns the most recent imports, newest first
+func GetImports(ctx context.Context, limit int, pool *pgxpool.Pool) ([]*Import, error) {
+	var imports []*Import
+	if err := pgxscan.Select(ctx, pool, &imports, "select * from user_imports order by created_at desc, id desc limit $1", limit); err != nil {
+		return nil, fmt.Errorf("failed to get imports from db: %w", err)
+	}
+	return imports, nil
+}
+
+// marks the import as running. returns an error if it has already been started, so it can only run once
+func (imp *Import) Start(ctx context.Context, pool *pgxpool.Pool) error {
+	tag, err := pool.Exec(
+		ctx,
+		"update user_imports set status = $1, started_at = now() where id = $2 and status = $3",
+		RunningImportStatus,
+		imp.ID,
+		PreviewImportStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start import: %w", err)
+	}
+	if tag.RowsAffected() < 1 {
+		return fmt.Errorf("import %d has already been started", imp.ID)
+	}
+	imp.Status = RunningImportStatus
+	return nil
+}
+
+// creates and invites, or updates, the user for each valid row, saving each row's result as it goes.
+// should be called after Start, and is meant to be run in the background since invitations are slow
+func (imp *Import) Run(
+	ctx context.Context,
+	serverAddress string,
+	mailClient *mail.Client,
+	engine *html.Engine,
+	pool *pgxpool.Pool,
+	authClient auth.AuthProvider,
+) error {
+	for _, row := range imp.Rows {
+		if !row.IsValid() {
+			continue
+		}
+		row.Result, row.Error = "", ""
+		if err := row.run(ctx, serverAddress, mailClient, engine, pool, authClient); err != nil {
+			row.Error = err.Error()
+		}
+		if _, err := pool.Exec(ctx, "update user_imports set rows = $1 where id = $2", imp.Rows, imp.ID); err != nil {
+			return fmt.Errorf("failed to save import progress: %w", err)
+		}
+	}
+	imp.Status = FinishedImportStatus
+	if _, err := pool.Exec(ctx, "update user_imports set status = $1, finished_at = now() where id = $2", imp.Status, imp.ID); err != nil {
+		return fmt.Errorf("failed to finish import: %w", err)
+	}
+	return audit.Record(ctx, pool, "user.import", "user_import", imp.ID, nil, imp.Counts())
+}
+
+func (row *ImportRow) run(
+	ctx context.Context,
+	serverAddress string,
+	mailClient *mail.Client,
+	engine *html.Engine,
+	pool *pgxpool.Pool,
+	authClient auth.AuthProvider,
+) error {
+	// the users list may have changed since the file was previewed
+	existing, err := GetUserByEmail(ctx, row.Email, pool)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		user := &User{
+			Name:   row.Name,
+			Email:  row.Email,
+			Status: PendingStatus,
+			Type:   row.Type,
+		}
+		if err := user.Invite(ctx, serverAddress, mailClient, engine, pool, authClient); err != nil {
+			return err
+		}
+		row.Result = "invited"
+		return nil
+	}
+	if existing.Type == AdminType {
+		return fmt.Errorf("admins can't be changed by an import")
+	}
+	if len(row.Name) > 0 {
+		existing.Name = row.Name
+	}
+	existing.Type = row.Type
+	if err := existing.Update(ctx, pool); err != nil {
+		return err
+	}
+	row.Result = "updated"
+	return nil
+}
@@ -0,0 +1,229 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// a named capability checked by route middleware, e.g. "shifts.manage"
+type Permission string
+
+const (
+	AdminPortalPermission     Permission = "admin.access"
+	ViewUsersPermission       Permission = "users.view"
+	InviteUsersPermission     Permission = "users.invite"
+	ManageUsersPermission     Permission = "users.manage"
+	ViewShiftsPermission      Permission = "shifts.view"
+	SignupShiftsPermission    Permission = "shifts.signup"
+	ManageShiftsPermission    Permission = "shifts.manage"
+	CreateBookingsPermission  Permission = "bookings.create"
+	ViewAllBookingsPermission Permission = "bookings.view_all"
+	ManageBookingsPermission  Permission = "bookings.manage"
+	ViewAuditPermission       Permission = "audit.view"
+	ManageTokensPermission    Permission = "tokens.manage"
+	ManageWebhooksPermission  Permission = "webhooks.manage"
+)
+
+// roles are expressed using the same values as user types.
+// every user holds the role matching their type, and may be granted additional roles
+var rolePermissions = map[Type][]Permission{
+	RecruitType: {
+		CreateBookingsPermission,
+	},
+	VolunteerType: {
+		ViewShiftsPermission,
+		SignupShiftsPermission,
+	},
+	AdminType: {
+		AdminPortalPermission,
+		ViewUsersPermission,
+		InviteUsersPermission,
+		ManageUsersPermission,
+		ViewShiftsPermission,
+		SignupShiftsPermission,
+		ManageShiftsPermission,
+		ViewAllBookingsPermission,
+		ManageBookingsPermission,
+		ViewAuditPermission,
+		ManageTokensPermission,
+		ManageWebhooksPermission,
+	},
+}
+
+// returns the permissions granted to the role
+func (t Type) Permissions() []Permission {
+	return rolePermissions[t]
+}
+
+// returns every permission. admins are granted all of them
+func AllPermissions() []Permission {
+	return rolePermissions[AdminType]
+}
+
+// returns every role held by the user: their type, followed by any additional roles they've been granted
+func (u *User) Roles() []Type {
+	roles := []Type{u.Type}
+	for _, role := range u.ExtraRoles {
+		if role != u.Type {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func (u *User) HasRole(role Type) bool {
+	for _, r := range u.Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) IsAdmin() bool {
+	return u.HasRole(AdminType)
+}
+
+// reports whether any of the user's roles grants the permission, and it is within the user's scopes if they have any
+func (u *User) HasPermission(permission Permission) bool {
+	if u.Scopes != nil {
+		inScope := false
+		for _, scope := range u.Scopes {
+			if scope == permission {
+				inScope = true
+				break
+			}
+		}
+		if !inScope {
+			return false
+		}
+	}
+	for _, role := range u.Roles() {
+		for _, p := range role.Permissions() {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// populates ExtraRoles from the db
+func (u *User) LoadRoles(ctx context.Context, pool *pgxpool.Pool) error {
+	var roles []Type
+	if err := pgxscan.Select(ctx, pool, &roles, "select role from user_roles where user_id=$1 order by role", u.ID); err != nil {
+		return fmt.Errorf("failed to get roles for user %d: %w", u.ID, err)
+	}
+	u.ExtraRoles = roles
+	return nil
+}
+
+var ErrLastAdmin = errors.New("cannot remove the last admin. make someone else an admin first")
+
+// returns ErrLastAdmin unless an active or invited user other than userID holds the admin role. the admins are
+// locked first, so two admins removed at once can't each count the other
+func checkOtherAdmins(ctx context.Context, tx pgx.Tx, userID int) error {
+	admins := `select u.id from users u
+	where u.status in ($1, $2) and (u.type = $3 or exists (select 1 from user_roles r where r.user_id = u.id and r.role = $3))`
+	if _, err := tx.Exec(ctx, admins+" for update", ActiveStatus, InvitedStatus, AdminType); err != nil {
+		return fmt.Errorf("failed to lock admins: %w", err)
+	}
+	var others int
+	if err := pgxscan.Get(ctx, tx, &others, "select count(*) from ("+admins+") a where a.id != $4", ActiveStatus, InvitedStatus, AdminType, userID); err != nil {
+		return fmt.Errorf("failed to count admins: %w", err)
+	}
+	if others < 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// grants the user an additional role. granting a role the user already holds is a no-op
+func (u *User) GrantRole(ctx context.Context, role Type, pool *pgxpool.Pool) error {
+	if role <= UndefinedType || role >= endType {
+		return fmt.Errorf("invalid role %d provided", role)
+	}
+	if u.HasRole(role) {
+		return nil
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(
+			ctx,
+			"insert into user_roles(user_id, role) values ($1, $2) on conflict do nothing",
+			u.ID,
+			role,
+		); err != nil {
+			return fmt.Errorf("failed to grant role: %w", err)
+		}
+		return audit.Record(ctx, tx, "user.role_grant", auditTarget, u.ID, u.Roles(), append(u.Roles(), role))
+	}); err != nil {
+		return err
+	}
+	u.ExtraRoles = append(u.ExtraRoles, role)
+	return nil
+}
+
+// revokes an additional role. the role matching the user's type cannot be revoked this way, and the last admin
+// can't have their admin role revoked
+func (u *User) RevokeRole(ctx context.Context, role Type, pool *pgxpool.Pool) error {
+	if role == u.Type {
+		return fmt.Errorf("cannot revoke the %s role from a user of the same type", role.String())
+	}
+	before := u.Roles()
+	roles := []Type{}
+	for _, r := range u.ExtraRoles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	if err := pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if role == AdminType {
+			if err := checkOtherAdmins(ctx, tx, u.ID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(ctx, "delete from user_roles where user_id=$1 and role=$2", u.ID, role); err != nil {
+			return fmt.Errorf("failed to revoke role: %w", err)
+		}
+		after := &User{Type: u.Type, ExtraRoles: roles}
+		return audit.Record(ctx, tx, "user.role_revoke", auditTarget, u.ID, before, after.Roles())
+	}); err != nil {
+		return err
+	}
+	u.ExtraRoles = roles
+	return nil
+}
+
+// populates ExtraRoles for each of the provided users with a single query
+func LoadRoles(ctx context.Context, users []*User, pool *pgxpool.Pool) error {
+	if len(users) < 1 {
+		return nil
+	}
+	ids := make([]int, len(users))
+	byID := map[int]*User{}
+	for i, u := range users {
+		ids[i] = u.ID
+		u.ExtraRoles = nil
+		byID[u.ID] = u
+	}
+	var rows []struct {
+		UserID int
+		Role   Type
+	}
+	if err := pgxscan.Select(ctx, pool, &rows, "select user_id, role from user_roles where user_id = any($1) order by role", ids); err != nil {
+		return fmt.Errorf("failed to get user roles: %w", err)
+	}
+	for _, row := range rows {
+		if u, ok := byID[row.UserID]; ok {
+			u.ExtraRoles = append(u.ExtraRoles, row.Role)
+		}
+	}
+	return nil
+}
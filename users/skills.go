@@ -0,0 +1,45 @@
+package users
+
+import (
+	"sort"
+	"strings"
+)
+
+// lowercases and trims the skills, dropping blanks and duplicates, and sorts them. never returns nil
+func NormalizeSkills(skills []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, s := range skills {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) < 1 || seen[s] {
+			continue
+		}
+		seen[s] = true
+		normalized = append(normalized, s)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// splits a comma separated list of skills like "Spanish, ASL" and normalizes it
+func ParseSkills(s string) []string {
+	return NormalizeSkills(strings.Split(s, ","))
+}
+
+// reports whether have includes every one of the skills in want
+func HasSkills(have []string, want []string) bool {
+	have = NormalizeSkills(have)
+	for _, w := range NormalizeSkills(want) {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
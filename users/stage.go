@@ -0,0 +1,145 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// how far a recruit has got through the pipeline, going by their most recent call
+type Stage int
+
+const (
+	UndefinedStage Stage = iota
+	// hasn't booked a call
+	NewStage
+	// has a call coming up, or one that hasn't had its outcome logged yet
+	BookedStage
+	// their latest call was completed
+	ContactedStage
+	// their latest call needs following up
+	FollowUpStage
+	// missed their latest call
+	NoShowStage
+	// new stages should go here so we don't change the int values associated with each stage
+	endStage
+)
+
+// stages in pipeline order
+var Stages = []Stage{NewStage, BookedStage, ContactedStage, FollowUpStage, NoShowStage}
+
+func (s Stage) String() string {
+	switch s {
+	case NewStage:
+		return "new"
+	case BookedStage:
+		return "booked"
+	case ContactedStage:
+		return "contacted"
+	case FollowUpStage:
+		return "follow_up"
+	case NoShowStage:
+		return "no_show"
+	default:
+		return ""
+	}
+}
+
+// describes the stage for people, e.g. "Needs follow-up"
+func (s Stage) Label() string {
+	switch s {
+	case NewStage:
+		return "New"
+	case BookedStage:
+		return "Call booked"
+	case ContactedStage:
+		return "Contacted"
+	case FollowUpStage:
+		return "Needs follow-up"
+	case NoShowStage:
+		return "No-show"
+	default:
+		return ""
+	}
+}
+
+func (s Stage) IsValid() bool {
+	return s > UndefinedStage && s < endStage
+}
+
+func (s Stage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Stage) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("stage must be a string: %w", err)
+	}
+	stage, err := ParseStage(str)
+	if err != nil {
+		return err
+	}
+	*s = stage
+	return nil
+}
+
+// parses a stage from its string representation, e.g. "follow_up"
+func ParseStage(str string) (Stage, error) {
+	for s := UndefinedStage + 1; s < endStage; s++ {
+		if s.String() == str {
+			return s, nil
+		}
+	}
+	return UndefinedStage, fmt.Errorf("unknown stage %q", str)
+}
+
+// audit snapshot of a user's stage
+type stageSnapshot struct {
+	Stage Stage
+}
+
+// moves the user to the stage, recording an audit event when it changes. stages are only set from the
+// user's calls, so this is called in the same transaction as the change to their bookings
+func SetStage(ctx context.Context, tx pgx.Tx, userID int, stage Stage) error {
+	var before Stage
+	if err := pgxscan.Get(ctx, tx, &before, "select stage from users where id = $1 for update", userID); err != nil {
+		return fmt.Errorf("failed to get user stage: %w", err)
+	}
+	if before == stage {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, "update users set stage = $1 where id = $2", stage, userID); err != nil {
+		return fmt.Errorf("failed to update user stage: %w", err)
+	}
+	return audit.Record(ctx, tx, "user.stage_change", auditTarget, userID, stageSnapshot{before}, stageSnapshot{stage})
+}
+
+// returns the number of recruits in each stage, leaving out deleted recruits
+func CountStages(ctx context.Context, pool *pgxpool.Pool) (map[Stage]int, error) {
+	var rows []struct {
+		Stage Stage
+		Count int
+	}
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&rows,
+		"select stage, count(*) as count from users where type = $1 and status != $2 group by stage",
+		RecruitType,
+		DeletedStatus,
+	); err != nil {
+		return nil, fmt.Errorf("failed to count recruit stages: %w", err)
+	}
+	counts := map[Stage]int{}
+	for _, row := range rows {
+		counts[row.Stage] = row.Count
+	}
+	return counts, nil
+}
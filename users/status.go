@@ -2,6 +2,7 @@ package users
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 type Status int
@@ -37,3 +38,26 @@ func (s Status) String() string {
 func (s Status) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.String())
 }
+
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("status must be a string: %w", err)
+	}
+	status, err := ParseStatus(str)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// parses a status from its string representation, e.g. "active"
+func ParseStatus(str string) (Status, error) {
+	for s := UndefinedStatus + 1; s < endStatus; s++ {
+		if s.String() == str {
+			return s, nil
+		}
+	}
+	return UndefinedStatus, fmt.Errorf("unknown status %q", str)
+}
@@ -0,0 +1,71 @@
+package users
+
+import (
+	"sync"
+	"time"
+)
+
+// time zone used for users who haven't chosen one yet
+var DefaultLocation = time.UTC
+
+// loaded locations by name, since loading one reads the time zone database
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// reports whether name is an IANA time zone, e.g. America/Chicago. "Local" depends on the server, so it isn't allowed
+func IsValidTimeZone(name string) bool {
+	if len(name) < 1 || name == "Local" {
+		return false
+	}
+	_, err := loadLocation(name)
+	return err == nil
+}
+
+// returns the user's time zone, or DefaultLocation if they haven't chosen one
+func (u *User) Location() *time.Location {
+	if u == nil || len(u.TimeZone) < 1 {
+		return DefaultLocation
+	}
+	loc, err := loadLocation(u.TimeZone)
+	if err != nil {
+		return DefaultLocation
+	}
+	return loc
+}
+
+// formats t in the user's time zone with the zone's abbreviation, e.g. "Tue, Oct 20 2026, 6:00 PM EDT"
+func (u *User) LocalTime(t time.Time) string {
+	return t.In(u.Location()).Format("Mon, Jan 2 2006, 3:04 PM MST")
+}
+
+// formats the time of day of t in the user's time zone with the zone's abbreviation, e.g. "6:00 PM EDT"
+func (u *User) LocalClock(t time.Time) string {
+	return t.In(u.Location()).Format("3:04 PM MST")
+}
+
+// formats t for a datetime-local input in the user's time zone
+func (u *User) LocalInput(t time.Time) string {
+	return t.In(u.Location()).Format("2006-01-02T15:04")
+}
+
+// parses the value of a datetime-local input in the user's time zone
+func (u *User) ParseLocalInput(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02T15:04", value, u.Location())
+}
+
+// returns the abbreviation of the user's time zone at t, e.g. "EDT"
+func (u *User) ZoneAbbreviation(t time.Time) string {
+	name, _ := t.In(u.Location()).Zone()
+	return name
+}
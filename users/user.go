@@ -6,18 +6,32 @@ import (
 	"fmt"
 	"strings"
 
+	"scheduler/audit"
+	"scheduler/utils"
+	"scheduler/webhooks"
+
 	"github.com/georgysavva/scany/pgxscan"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type User struct {
-	ID       int
-	Name     string
-	Email    string
-	StytchID string
-	Status   Status
-	Type     Type
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	StytchID string `json:"-"`
+	Status   Status `json:"status"`
+	Type     Type   `json:"type"`
+	// IANA time zone name, e.g. America/Chicago. empty until the user logs in or chooses one
+	TimeZone string `json:"time_zone"`
+	// skills and languages a volunteer offers, or a recruit needs in a volunteer, e.g. "spanish". normalized by NormalizeSkills
+	Skills []string `json:"skills"`
+	// how far a recruit has got through the pipeline. set from their calls by the bookings package
+	Stage Stage `json:"stage"`
+	// roles held in addition to the one matching Type. only populated by LoadRoles
+	ExtraRoles []Type `db:"-" json:"extra_roles,omitempty"`
+	// when not nil, the user's permissions are limited to these, e.g. while acting through a scoped API token
+	Scopes []Permission `db:"-" json:"scopes,omitempty"`
 }
 
 // get users by type
@@ -34,6 +48,14 @@ func (u *User) IsValid() error {
 	if u.Status >= endStatus || u.Status < UndefinedStatus {
 		err = fmt.Errorf("invalid status %d provided", u.Status)
 	}
+	if len(u.TimeZone) > 0 && !IsValidTimeZone(u.TimeZone) {
+		msg := fmt.Sprintf("invalid time zone %q provided", u.TimeZone)
+		if err != nil {
+			err = fmt.Errorf("%w; %s", err, msg)
+		} else {
+			err = fmt.Errorf(msg)
+		}
+	}
 	if u.Type >= endType || u.Type < UndefinedType {
 		msg := fmt.Sprintf("invalid type %d provided", u.Type)
 		if err != nil {
@@ -45,6 +67,44 @@ func (u *User) IsValid() error {
 	return err
 }
 
+// narrows the users returned by FindUsers. zero values are ignored
+type Filter struct {
+	Type   Type
+	Status Status
+	Stage  Stage
+	Limit  int
+	Offset int
+}
+
+func (f Filter) where() *utils.Where {
+	var where utils.Where
+	if f.Type != UndefinedType {
+		where.Add("type = $%d", f.Type)
+	}
+	if f.Status != UndefinedStatus {
+		where.Add("status = $%d", f.Status)
+	}
+	if f.Stage != UndefinedStage {
+		where.Add("stage = $%d", f.Stage)
+	}
+	return &where
+}
+
+// returns a page of users matching the filter, ordered by ID, along with the total number of matching users
+func FindUsers(ctx context.Context, filter Filter, pool *pgxpool.Pool) ([]*User, int, error) {
+	where := filter.where()
+	var total int
+	if err := pgxscan.Get(ctx, pool, &total, "select count(*) from users"+where.String(), where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	query := where.Paginate("select * from users"+where.String()+" order by id", filter.Limit, filter.Offset)
+	var users []*User
+	if err := pgxscan.Select(ctx, pool, &users, query, where.Args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get users from db: %w", err)
+	}
+	return users, total, nil
+}
+
 // get all users
 func GetUsers(ctx context.Context, pool *pgxpool.Pool) ([]*User, error) {
 	var users []*User
@@ -54,10 +114,37 @@ func GetUsers(ctx context.Context, pool *pgxpool.Pool) ([]*User, error) {
 	return users, nil
 }
 
+func GetUserByID(ctx context.Context, id int, pool *pgxpool.Pool) (*User, error) {
+	var user User
+	if err := pgxscan.Get(ctx, pool, &user, "select * from users where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
+
+// returns the users with the provided IDs, keyed by ID. IDs without a user are left out
+func GetUsersByIDs(ctx context.Context, ids []int, pool *pgxpool.Pool) (map[int]*User, error) {
+	byID := map[int]*User{}
+	if len(ids) < 1 {
+		return byID, nil
+	}
+	var users []*User
+	if err := pgxscan.Select(ctx, pool, &users, "select * from users where id = any($1)", ids); err != nil {
+		return nil, fmt.Errorf("failed to get users from db: %w", err)
+	}
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	return byID, nil
+}
+
 func GetUserByEmail(ctx context.Context, email string, pool *pgxpool.Pool) (*User, error) {
 	var user User
-	if err := pgxscan.Get(ctx, pool, &user, "select * from users where email=$1", email); err != nil {
-		if err == pgx.ErrNoRows {
+	if err := pgxscan.Get(ctx, pool, &user, "select * from users where lower(email) = lower($1)", email); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
@@ -79,11 +166,18 @@ func GetUserByStytchID(ctx context.Context, stytchID string, pool *pgxpool.Pool)
 // updates the user if the user could be found in the list by stytch ID when possible, falling back to email as needed.
 // if the user cannot be found, the user is added instead
 func (u *User) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	return u.save(ctx, pool, nil)
+}
+
+// saves the user like Update. also, if set, runs in the same transaction, e.g. to record why the user changed
+func (u *User) save(ctx context.Context, pool *pgxpool.Pool, also func(tx pgx.Tx) error) error {
 	// if provided user is invalid, return error
 	if err := u.IsValid(); err != nil {
 		return fmt.Errorf("invalid user: %w", err)
 	}
+	u.Skills = NormalizeSkills(u.Skills)
 
+	var before *User
 	if u.ID < 1 {
 		// try to select existing user
 		var (
@@ -101,39 +195,141 @@ func (u *User) Update(ctx context.Context, pool *pgxpool.Pool) error {
 
 		// if existing user is not found, insert
 		if user == nil {
-			var id int
-			if err := pgxscan.Get(
-				ctx,
-				pool,
-				&id,
-				"insert into users(name, email, stytch_id, status, type) values ($1, $2, $3, $4, $5) returning id",
-				u.Name,
-				u.Email,
-				u.StytchID,
-				u.Status,
-				u.Type,
-			); err != nil {
-				return fmt.Errorf("failed to insert user: %w", err)
+			if u.Stage == UndefinedStage {
+				u.Stage = NewStage
 			}
-			u.ID = id
-			return nil
+			return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+				var id int
+				if err := pgxscan.Get(
+					ctx,
+					tx,
+					&id,
+					"insert into users(name, email, stytch_id, status, type, time_zone, skills, stage) values ($1, $2, $3, $4, $5, $6, $7, $8) returning id",
+					u.Name,
+					u.Email,
+					u.StytchID,
+					u.Status,
+					u.Type,
+					u.TimeZone,
+					u.Skills,
+					u.Stage,
+				); err != nil {
+					return fmt.Errorf("failed to insert user: %w", err)
+				}
+				u.ID = id
+				if err := audit.Record(ctx, tx, "user.create", auditTarget, u.ID, nil, u.snapshot()); err != nil {
+					return err
+				}
+				if also != nil {
+					return also(tx)
+				}
+				return nil
+			})
 		}
 		u.ID = user.ID
+		before = user
+	} else {
+		var err error
+		if before, err = GetUserByID(ctx, u.ID, pool); err != nil {
+			return fmt.Errorf("failed to select existing user: %w", err)
+		}
 	}
 
-	// stytch ID should never need to be updated, so that field is omitted here
-	if _, err := pool.Exec(
-		ctx,
-		"update users set name = $1, email = $2, status = $3, type = $4 where id = $5",
-		u.Name,
-		u.Email,
-		u.Status,
-		u.Type,
-		u.ID,
-	); err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// admins who stop being admins, or can no longer log in, need someone else left to manage users
+		if before != nil && before.Type == AdminType &&
+			(u.Type != AdminType || (u.Status != ActiveStatus && u.Status != InvitedStatus)) {
+			if err := checkOtherAdmins(ctx, tx, u.ID); err != nil {
+				return err
+			}
+		}
+		// stytch ID should never need to be updated, so that field is omitted here
+		if _, err := tx.Exec(
+			ctx,
+			"update users set name = $1, email = $2, status = $3, type = $4, time_zone = $5, skills = $6 where id = $7",
+			u.Name,
+			u.Email,
+			u.Status,
+			u.Type,
+			u.TimeZone,
+			u.Skills,
+			u.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if also != nil {
+			if err := also(tx); err != nil {
+				return err
+			}
+		}
+		// saving a user without changing anything isn't worth an audit event
+		if before != nil && before.snapshot() == u.snapshot() {
+			return nil
+		}
+		var beforeSnapshot interface{}
+		if before != nil {
+			beforeSnapshot = before.snapshot()
+		}
+		if err := audit.Record(ctx, tx, "user.update", auditTarget, u.ID, beforeSnapshot, u.snapshot()); err != nil {
+			return err
+		}
+		if before == nil || before.Status == u.Status {
+			return nil
+		}
+		return webhooks.Enqueue(ctx, tx, webhooks.UserStatusChangedEvent, statusChange{
+			User: webhookUser{
+				ID:     u.ID,
+				Name:   u.Name,
+				Email:  u.Email,
+				Status: u.Status,
+				Type:   u.Type,
+			},
+			PreviousStatus: before.Status,
+		})
+	})
+}
+
+// the fields of a user sent to webhook subscribers
+type webhookUser struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Status Status `json:"status"`
+	Type   Type   `json:"type"`
+}
+
+// webhook payload describing a change to a user's status
+type statusChange struct {
+	User           webhookUser `json:"user"`
+	PreviousStatus Status      `json:"previous_status"`
+}
+
+// target type used for audit events about users
+const auditTarget = "user"
+
+// the fields of a user recorded in audit events
+type userSnapshot struct {
+	ID       int
+	Name     string
+	Email    string
+	StytchID string
+	Status   Status
+	Type     Type
+	TimeZone string
+	Skills   string
+}
+
+func (u *User) snapshot() userSnapshot {
+	return userSnapshot{
+		ID:       u.ID,
+		Name:     u.Name,
+		Email:    u.Email,
+		StytchID: u.StytchID,
+		Status:   u.Status,
+		Type:     u.Type,
+		TimeZone: u.TimeZone,
+		Skills:   strings.Join(u.Skills, ", "),
 	}
-	return nil
 }
 
 func (u *User) MarshalBinary() ([]byte, error) {
@@ -171,3 +367,31 @@ func (t Type) String() string {
 func (t Type) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.String())
 }
+
+func (t *Type) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("type must be a string: %w", err)
+	}
+	// mirrors MarshalJSON, which encodes UndefinedType as an empty string
+	if len(str) < 1 {
+		*t = UndefinedType
+		return nil
+	}
+	parsed, err := ParseType(str)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// parses a type from its string representation, e.g. "admin"
+func ParseType(s string) (Type, error) {
+	for t := UndefinedType + 1; t < endType; t++ {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return UndefinedType, fmt.Errorf("unknown type %q", s)
+}
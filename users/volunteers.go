@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 
+	"scheduler/audit"
+	"scheduler/auth"
 	"scheduler/mail"
-	"scheduler/stytch"
 
 	"github.com/gofiber/template/html"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -40,12 +42,12 @@ func (v *User) Invite(
 	mailClient *mail.Client,
 	engine *html.Engine,
 	pool *pgxpool.Pool,
-	stytchClient *stytch.Client,
+	authClient auth.AuthProvider,
 ) error {
 	// add to stytch
-	id, err := stytchClient.CreateUser(v.Email)
+	id, err := authClient.CreateUser(v.Email)
 	if err != nil {
-		return fmt.Errorf("failed to create stytch user: %w", err)
+		return fmt.Errorf("failed to create auth user: %w", err)
 	}
 	v.StytchID = id
 	// add to database
@@ -71,7 +73,29 @@ func (v *User) Invite(
 		return fmt.Errorf("failed to send invitation email: %w", err)
 	}
 
-	// update status
+	// update status, recording the invite along with it
 	v.Status = InvitedStatus
-	return v.Update(ctx, pool)
+	return v.save(ctx, pool, func(tx pgx.Tx) error {
+		return audit.Record(ctx, tx, "user.invite", auditTarget, v.ID, nil, v.snapshot())
+	})
+}
+
+// gives a user who signed up without being invited, e.g. a recruit booking from the public page, an account with the
+// auth provider so they can log in, then activates them
+func (u *User) Activate(ctx context.Context, pool *pgxpool.Pool, authClient auth.AuthProvider) error {
+	if len(u.StytchID) < 1 {
+		id, err := authClient.CreateUser(u.Email)
+		if err != nil {
+			return fmt.Errorf("failed to create auth user: %w", err)
+		}
+		u.StytchID = id
+	}
+	u.Status = ActiveStatus
+	return u.save(ctx, pool, func(tx pgx.Tx) error {
+		// Update leaves the stytch ID alone, since it's normally set when the user is invited
+		if _, err := tx.Exec(ctx, "update users set stytch_id = $1 where id = $2", u.StytchID, u.ID); err != nil {
+			return fmt.Errorf("failed to save auth user: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,12 @@
+package utils
+
+import "strings"
+
+// returns the value ready for a CSV cell that may be opened in a spreadsheet. values that spreadsheets would run as
+// formulas, e.g. "=HYPERLINK(...)", are prefixed with a quote so they're shown as text instead
+func CSVCell(value string) string {
+	if len(value) > 0 && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,26 @@
+package utils
+
+import "testing"
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"Jane Doe", "Jane Doe"},
+		{"jane@example.com", "jane@example.com"},
+		{"Jane = Doe", "Jane = Doe"},
+		{`=HYPERLINK("https://evil.com","click")`, `'=HYPERLINK("https://evil.com","click")`},
+		{"+1 555 0100", "'+1 555 0100"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+	}
+	for _, tt := range tests {
+		if got := CSVCell(tt.value); got != tt.want {
+			t.Errorf("CSVCell(%q): expected %q, got %q", tt.value, tt.want, got)
+		}
+	}
+}
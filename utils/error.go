@@ -7,7 +7,34 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+const localsJSONErrorsKey = "json_errors"
+
+// the body of every JSON error response
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// middleware that makes RenderError respond with an ErrorBody instead of the HTML error page
+// for the rest of the request. should be registered ahead of any other middleware on JSON routes
+func JSONErrors(c *fiber.Ctx) error {
+	c.Locals(localsJSONErrorsKey, true)
+	return c.Next()
+}
+
 func RenderError(ctx *fiber.Ctx, statusCode int, err error) error {
+	if wantsJSON, _ := ctx.Locals(localsJSONErrorsKey).(bool); wantsJSON {
+		return ctx.Status(statusCode).JSON(ErrorBody{
+			Error: ErrorDetail{
+				Status:  statusCode,
+				Message: err.Error(),
+			},
+		})
+	}
 	return ctx.Status(statusCode).Render("error", fiber.Map{
 		"Error": err,
 	})
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// builds a parameterized where clause for queries with optional filters
+type Where struct {
+	clauses []string
+	Args    []interface{}
+}
+
+// adds a clause and its argument. the clause must contain a single %d verb, which is replaced with the
+// argument's placeholder number, e.g. w.Add("status = $%d", status)
+func (w *Where) Add(clause string, arg interface{}) {
+	w.Args = append(w.Args, arg)
+	w.clauses = append(w.clauses, fmt.Sprintf(clause, len(w.Args)))
+}
+
+// returns the where clause with a leading space, or an empty string when no clauses were added
+func (w *Where) String() string {
+	if len(w.clauses) < 1 {
+		return ""
+	}
+	return " where " + strings.Join(w.clauses, " and ")
+}
+
+// appends limit and offset placeholders to the query, adding their arguments to w.Args.
+// a limit < 1 means no limit
+func (w *Where) Paginate(query string, limit int, offset int) string {
+	if limit > 0 {
+		w.Args = append(w.Args, limit)
+		query += fmt.Sprintf(" limit $%d", len(w.Args))
+	}
+	if offset > 0 {
+		w.Args = append(w.Args, offset)
+		query += fmt.Sprintf(" offset $%d", len(w.Args))
+	}
+	return query
+}
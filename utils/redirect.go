@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// returns target if it is a same-origin path (optionally with a query string), otherwise returns fallback.
+// used to validate redirect targets that made a round trip through user-controllable storage
+func SafeRedirect(target string, fallback string) string {
+	// reject protocol-relative and backslash tricks that browsers treat as another host
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return fallback
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.IsAbs() || len(u.Host) > 0 {
+		return fallback
+	}
+	return target
+}
@@ -0,0 +1,33 @@
+package utils
+
+import "testing"
+
+func TestSafeRedirect(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/shifts", "/shifts"},
+		{"/shifts/12?week=2024-01-01", "/shifts/12?week=2024-01-01"},
+		{"/", "/"},
+		{"", "/dash"},
+		{"shifts", "/dash"},
+		{"//evil.com", "/dash"},
+		{"//evil.com/shifts", "/dash"},
+		{"/\\evil.com", "/dash"},
+		{"\\\\evil.com", "/dash"},
+		{"https://evil.com", "/dash"},
+		{"https://evil.com/shifts", "/dash"},
+		{"javascript:alert(1)", "/dash"},
+		{"/\t/evil.com", "/dash"},
+		{"/\n/evil.com", "/dash"},
+		{"/\r\n/evil.com", "/dash"},
+		{"/shifts\x00", "/dash"},
+		{"/shifts\x7f", "/dash"},
+	}
+	for _, tt := range tests {
+		if got := SafeRedirect(tt.target, "/dash"); got != tt.want {
+			t.Errorf("SafeRedirect(%q): expected %q, got %q", tt.target, tt.want, got)
+		}
+	}
+}
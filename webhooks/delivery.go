@@ -0,0 +1,227 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+	"scheduler/utils"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// number of attempts made before a delivery is marked as failed
+	MaxAttempts = 10
+	// delay before the first retry. doubles with every failed attempt
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 12 * time.Hour
+)
+
+// one event queued for one subscription. deliveries are retried with exponential backoff until
+// they succeed or run out of attempts, and double as the delivery log
+type Delivery struct {
+	ID             int
+	SubscriptionID int
+	Event          string
+	// the JSON body sent to the subscriber
+	Payload       string
+	Status        Status
+	Attempts      int
+	NextAttemptAt time.Time
+	// nil until an attempt gets a response
+	LastResponseCode *int
+	LastError        string
+	CreatedAt        time.Time
+	DeliveredAt      *time.Time
+	// only populated by ListDeliveries
+	SubscriptionURL string
+}
+
+// the JSON body of every webhook request
+type envelope struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// queues the event for every active subscription to it. pass the transaction making the change the event
+// describes, so the event is only sent if the change is committed
+func Enqueue(ctx context.Context, db audit.Execer, event string, data interface{}) error {
+	payload, err := json.Marshal(envelope{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s webhook payload: %w", event, err)
+	}
+	if _, err := db.Exec(
+		ctx,
+		`insert into webhook_deliveries(subscription_id, event, payload, status)
+		select id, $1, $2, $3 from webhook_subscriptions where active and $1 = any(events)`,
+		event,
+		string(payload),
+		PendingStatus,
+	); err != nil {
+		return fmt.Errorf("failed to queue %s webhooks: %w", event, err)
+	}
+	return nil
+}
+
+// leases up to limit due deliveries to the caller. other workers skip them until the lease expires,
+// so a delivery interrupted by a crash is retried rather than lost
+func claimDue(ctx context.Context, limit int, lease time.Duration, pool *pgxpool.Pool) ([]*Delivery, error) {
+	var deliveries []*Delivery
+	if err := pgxscan.Select(
+		ctx,
+		pool,
+		&deliveries,
+		`update webhook_deliveries set next_attempt_at = $1 where id in (
+			select id from webhook_deliveries where status = $2 and next_attempt_at <= now()
+			order by next_attempt_at limit $3 for update skip locked
+		) returning *`,
+		time.Now().Add(lease),
+		PendingStatus,
+		limit,
+	); err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// records the outcome of an attempt, scheduling a retry if it failed and attempts remain.
+// responseCode is nil when no response was received
+func (d *Delivery) recordAttempt(ctx context.Context, responseCode *int, attemptErr error, pool *pgxpool.Pool) error {
+	d.Attempts++
+	d.LastResponseCode = responseCode
+	d.LastError = ""
+	switch {
+	case attemptErr == nil:
+		d.Status = SucceededStatus
+		now := time.Now()
+		d.DeliveredAt = &now
+	case d.Attempts >= MaxAttempts:
+		d.Status = FailedStatus
+		d.LastError = attemptErr.Error()
+	default:
+		d.Status = PendingStatus
+		d.LastError = attemptErr.Error()
+		d.NextAttemptAt = time.Now().Add(backoff(d.Attempts))
+	}
+	return d.save(ctx, pool)
+}
+
+// marks the delivery as failed without attempting it
+func (d *Delivery) abandon(ctx context.Context, reason string, pool *pgxpool.Pool) error {
+	d.Status = FailedStatus
+	d.LastError = reason
+	return d.save(ctx, pool)
+}
+
+func (d *Delivery) save(ctx context.Context, pool *pgxpool.Pool) error {
+	if _, err := pool.Exec(
+		ctx,
+		`update webhook_deliveries set status = $1, attempts = $2, next_attempt_at = $3, last_response_code = $4,
+		last_error = $5, delivered_at = $6 where id = $7`,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		d.LastResponseCode,
+		d.LastError,
+		d.DeliveredAt,
+		d.ID,
+	); err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// returns the delay before the next attempt, after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// queues a failed or pending delivery to be sent again right away, with a fresh set of attempts
+func (d *Delivery) Retry(ctx context.Context, pool *pgxpool.Pool) error {
+	if d.Status == SucceededStatus {
+		return fmt.Errorf("delivery %d already succeeded", d.ID)
+	}
+	before := *d
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := pgxscan.Get(
+			ctx,
+			tx,
+			d,
+			"update webhook_deliveries set status = $1, attempts = 0, next_attempt_at = now() where id = $2 returning *",
+			PendingStatus,
+			d.ID,
+		); err != nil {
+			return fmt.Errorf("failed to retry webhook delivery: %w", err)
+		}
+		return audit.Record(ctx, tx, "webhook.delivery_retry", auditTarget, d.SubscriptionID, before.snapshot(), d.snapshot())
+	})
+}
+
+// the fields of a delivery recorded in audit events. the payload is left out to keep the audit log small
+func (d *Delivery) snapshot() map[string]interface{} {
+	return map[string]interface{}{
+		"ID":       d.ID,
+		"Event":    d.Event,
+		"Status":   d.Status.String(),
+		"Attempts": d.Attempts,
+	}
+}
+
+func GetDeliveryByID(ctx context.Context, id int, pool *pgxpool.Pool) (*Delivery, error) {
+	var delivery Delivery
+	if err := pgxscan.Get(ctx, pool, &delivery, "select * from webhook_deliveries where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// narrows the deliveries returned by ListDeliveries. zero values are ignored
+type DeliveryFilter struct {
+	SubscriptionID int
+	Event          string
+	Status         Status
+	Limit          int
+}
+
+// returns deliveries matching the filter, newest first
+func ListDeliveries(ctx context.Context, filter DeliveryFilter, pool *pgxpool.Pool) ([]*Delivery, error) {
+	var where utils.Where
+	if filter.SubscriptionID > 0 {
+		where.Add("d.subscription_id = $%d", filter.SubscriptionID)
+	}
+	if len(filter.Event) > 0 {
+		where.Add("d.event = $%d", filter.Event)
+	}
+	if filter.Status != UndefinedStatus {
+		where.Add("d.status = $%d", filter.Status)
+	}
+	query := `select d.*, s.url as subscription_url from webhook_deliveries d
+		join webhook_subscriptions s on s.id = d.subscription_id` + where.String() + " order by d.created_at desc, d.id desc"
+	query = where.Paginate(query, filter.Limit, 0)
+	var deliveries []*Delivery
+	if err := pgxscan.Select(ctx, pool, &deliveries, query, where.Args...); err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
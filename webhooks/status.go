@@ -0,0 +1,46 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Status int
+
+const (
+	UndefinedStatus Status = iota
+	// waiting for its first attempt, or for a retry
+	PendingStatus
+	SucceededStatus
+	// gave up after MaxAttempts
+	FailedStatus
+	// new statuses should go here so we don't change the int values associated with each status
+	endStatus
+)
+
+func (s Status) String() string {
+	switch s {
+	case PendingStatus:
+		return "pending"
+	case SucceededStatus:
+		return "succeeded"
+	case FailedStatus:
+		return "failed"
+	default:
+		return ""
+	}
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// parses a status from its string representation, e.g. "failed"
+func ParseStatus(str string) (Status, error) {
+	for s := UndefinedStatus + 1; s < endStatus; s++ {
+		if s.String() == str {
+			return s, nil
+		}
+	}
+	return UndefinedStatus, fmt.Errorf("unknown status %q", str)
+}
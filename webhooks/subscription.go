@@ -0,0 +1,165 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"scheduler/audit"
+
+	"github.com/georgysavva/scany/pgxscan"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// names of the events subscriptions can receive
+const (
+	BookingCreatedEvent   = "booking.created"
+	BookingCancelledEvent = "booking.cancelled"
+	// sent when a call's outcome is logged, or when it's marked a no-show because no outcome was logged
+	BookingOutcomeEvent      = "booking.outcome"
+	ShiftVolunteerAddedEvent = "shift.volunteer_added"
+	// sent when a volunteer leaves or is removed from a shift
+	ShiftVolunteerRemovedEvent = "shift.volunteer_removed"
+	UserStatusChangedEvent     = "user.status_changed"
+)
+
+// every event, in the order they're listed on the admin page
+var Events = []string{
+	BookingCreatedEvent,
+	BookingCancelledEvent,
+	BookingOutcomeEvent,
+	ShiftVolunteerAddedEvent,
+	ShiftVolunteerRemovedEvent,
+	UserStatusChangedEvent,
+}
+
+// target type used for audit events about webhook subscriptions
+const auditTarget = "webhook"
+
+// an admin-configured endpoint that's sent the events it subscribes to
+type Subscription struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	// used to sign payloads. excluded from audit snapshots
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// creates a new instance of a subscription struct with a random secret
+func NewSubscription(endpoint string, events []string) (*Subscription, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	sub := Subscription{
+		URL:    strings.TrimSpace(endpoint),
+		Secret: "whsec_" + hex.EncodeToString(b),
+		Events: events,
+		Active: true,
+	}
+	if err := sub.IsValid(); err != nil {
+		return nil, fmt.Errorf("invalid webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func (s *Subscription) IsValid() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) < 1 {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(s.Events) < 1 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range s.Events {
+		known := false
+		for _, e := range Events {
+			if e == event {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// inserts the subscription if it doesn't have an ID yet, otherwise updates its URL, events and active flag
+func (s *Subscription) Update(ctx context.Context, pool *pgxpool.Pool) error {
+	if err := s.IsValid(); err != nil {
+		return fmt.Errorf("invalid webhook subscription: %w", err)
+	}
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if s.ID < 1 {
+			if err := pgxscan.Get(
+				ctx,
+				tx,
+				s,
+				"insert into webhook_subscriptions(url, secret, events, active) values ($1, $2, $3, $4) returning *",
+				s.URL,
+				s.Secret,
+				s.Events,
+				s.Active,
+			); err != nil {
+				return fmt.Errorf("failed to insert webhook subscription: %w", err)
+			}
+			return audit.Record(ctx, tx, "webhook.create", auditTarget, s.ID, nil, s)
+		}
+		before, err := GetSubscriptionByID(ctx, s.ID, tx)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return fmt.Errorf("webhook subscription with ID %d not found", s.ID)
+		}
+		if _, err := tx.Exec(
+			ctx,
+			"update webhook_subscriptions set url = $1, events = $2, active = $3 where id = $4",
+			s.URL,
+			s.Events,
+			s.Active,
+			s.ID,
+		); err != nil {
+			return fmt.Errorf("failed to update webhook subscription: %w", err)
+		}
+		return audit.Record(ctx, tx, "webhook.update", auditTarget, s.ID, before, s)
+	})
+}
+
+// deletes the subscription along with its delivery log
+func (s *Subscription) Delete(ctx context.Context, pool *pgxpool.Pool) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "delete from webhook_subscriptions where id = $1", s.ID); err != nil {
+			return fmt.Errorf("failed to delete webhook subscription: %w", err)
+		}
+		return audit.Record(ctx, tx, "webhook.delete", auditTarget, s.ID, s, nil)
+	})
+}
+
+func GetSubscriptionByID(ctx context.Context, id int, db pgxscan.Querier) (*Subscription, error) {
+	var sub Subscription
+	if err := pgxscan.Get(ctx, db, &sub, "select * from webhook_subscriptions where id=$1", id); err != nil {
+		if err == pgx.ErrNoRows || strings.Contains(err.Error(), "no rows in result") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func GetSubscriptions(ctx context.Context, pool *pgxpool.Pool) ([]*Subscription, error) {
+	var subs []*Subscription
+	if err := pgxscan.Select(ctx, pool, &subs, "select * from webhook_subscriptions order by id"); err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions from db: %w", err)
+	}
+	return subs, nil
+}
@@ -0,0 +1,137 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	// how often the queue is checked for due deliveries
+	pollInterval = 5 * time.Second
+	// number of deliveries claimed per poll
+	batchSize      = 20
+	requestTimeout = 10 * time.Second
+	// how long a claimed delivery is hidden from other workers. a batch is sent one delivery after another, so the
+	// lease covers every request in it timing out, plus a margin for the db
+	leaseDuration = batchSize*requestTimeout + time.Minute
+	// amount of a failed response body kept in the delivery log
+	maxErrorBody = 512
+)
+
+// sends queued deliveries in the background. any number of workers can run against the same db
+type Worker struct {
+	pool   *pgxpool.Pool
+	client *http.Client
+}
+
+func NewWorker(pool *pgxpool.Pool) *Worker {
+	return &Worker{
+		pool: pool,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// a redirect usually means a misconfigured URL, so it's treated as a failed attempt
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// polls for due deliveries until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.sendDue(ctx); err != nil {
+			fmt.Println(fmt.Errorf("failed to send webhooks: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) sendDue(ctx context.Context) error {
+	deliveries, err := claimDue(ctx, batchSize, leaseDuration, w.pool)
+	if err != nil {
+		return err
+	}
+	// stop while there's still time for a request before the lease runs out, so another worker never claims a
+	// delivery this one is still sending. the rest are claimed again once their lease expires
+	deadline := time.Now().Add(leaseDuration - requestTimeout)
+	subs := map[int]*Subscription{}
+	for _, d := range deliveries {
+		if time.Now().After(deadline) {
+			break
+		}
+		sub, ok := subs[d.SubscriptionID]
+		if !ok {
+			if sub, err = GetSubscriptionByID(ctx, d.SubscriptionID, w.pool); err != nil {
+				return err
+			}
+			subs[d.SubscriptionID] = sub
+		}
+		if sub == nil || !sub.Active {
+			// give up straight away rather than retrying until the subscription is turned back on
+			if err := d.abandon(ctx, "subscription is inactive", w.pool); err != nil {
+				return err
+			}
+			continue
+		}
+		code, attemptErr := w.send(ctx, sub, d)
+		if err := d.recordAttempt(ctx, code, attemptErr, w.pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// posts the delivery's payload to the subscriber. any 2xx response is a success.
+// returns the response code, or nil if no response was received
+func (w *Worker) send(ctx context.Context, sub *Subscription, d *Delivery) (*int, error) {
+	payload := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	timestamp := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "JD-Scheduler-Webhooks/1.0")
+	req.Header.Set("X-Scheduler-Event", d.Event)
+	req.Header.Set("X-Scheduler-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Scheduler-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set("X-Scheduler-Signature", "sha256="+Sign(sub.Secret, timestamp, payload))
+	res, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	code := res.StatusCode
+	if code < 200 || code > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		return &code, fmt.Errorf("unexpected response %d: %s", code, string(body))
+	}
+	return &code, nil
+}
+
+// returns the hex encoded HMAC-SHA256 of "<unix timestamp>.<payload>", keyed with the subscription's secret.
+// subscribers should recompute it to verify requests, and reject old timestamps to prevent replays
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,26 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"event":"booking.created","data":{"id":42}}`)
+	timestamp := time.Unix(1700000000, 0)
+	// computed independently with python's hmac module over "1700000000.<payload>"
+	want := "6874e725d95452a1be4bbd559f5bdf809371b9705e8629edc5374709fd817931"
+	if got := Sign("whsec_test", timestamp, payload); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	// the timestamp is signed as unix seconds, whatever its location
+	if got := Sign("whsec_test", timestamp.In(time.FixedZone("EST", -5*60*60)), payload); got != want {
+		t.Errorf("expected the signature not to depend on the timestamp's location, got %s", got)
+	}
+	if got := Sign("whsec_test", timestamp.Add(time.Second), payload); got != "d2172ee65a1551e5f19c8657547a11506a3d8a354c7be3036e78a485ebe4ad0e" {
+		t.Errorf("expected a different signature a second later, got %s", got)
+	}
+	if got := Sign("whsec_other", timestamp, payload); got == want {
+		t.Errorf("expected a different secret to change the signature")
+	}
+}